@@ -0,0 +1,235 @@
+---@brief [[
+--- Buffer Module
+--- Reads buffer content and cursor state on behalf of the MCP server.
+---@brief ]]
+
+---@module 'gemini-cli.buffer'
+local M = {}
+
+-- Buffer change subscription state. Bumping the generation invalidates
+-- existing attachments, which detach themselves on their next callback.
+local subscription_generation = 0
+---@type table<number, number>
+local attached = {}
+
+---Find the buffer whose name is exactly a file path. vim.fn.bufnr() treats
+---its argument as a pattern, so /x/a.go could match /x/a.go.orig and the
+---[id] in app/[id]/page.tsx would be a character class.
+---@param file_path string
+---@return number|nil bufnr The buffer number, or nil if no buffer has the name
+function M.bufnr(file_path)
+  local name = vim.fn.fnamemodify(file_path, ':p')
+  for _, bufnr in ipairs(vim.api.nvim_list_bufs()) do
+    if vim.api.nvim_buf_get_name(bufnr) == name then
+      return bufnr
+    end
+  end
+  return nil
+end
+
+-- Helper: Find the loaded buffer for a file path
+---@param file_path string
+---@return number|nil bufnr The buffer number, or nil if the file is not loaded
+local function find_buffer(file_path)
+  local bufnr = M.bufnr(file_path)
+  if not bufnr or not vim.api.nvim_buf_is_loaded(bufnr) then
+    return nil
+  end
+  return bufnr
+end
+
+-- Helper: Get the cursor line for a buffer, preferring a window that displays it
+---@param bufnr number
+---@return number line The 1-based cursor line
+local function cursor_line(bufnr)
+  local win = vim.fn.bufwinid(bufnr)
+  if win ~= -1 then
+    return vim.api.nvim_win_get_cursor(win)[1]
+  end
+  -- Fall back to the last known cursor position in the buffer
+  local mark = vim.api.nvim_buf_get_mark(bufnr, '"')
+  return math.max(mark[1], 1)
+end
+
+---Get the lines within radius of the cursor
+---@param file_path string The path to the file
+---@param radius number Number of lines to include on each side of the cursor
+---@return table|nil window The context window, or nil if the file is not loaded
+function M.get_context_window(file_path, radius)
+  local bufnr = find_buffer(file_path)
+  if not bufnr then
+    return nil
+  end
+
+  local line_count = vim.api.nvim_buf_line_count(bufnr)
+  local cursor = math.min(cursor_line(bufnr), line_count)
+  local start_line = math.max(cursor - radius, 1)
+  local end_line = math.min(cursor + radius, line_count)
+
+  local lines = {}
+  for i, text in ipairs(vim.api.nvim_buf_get_lines(bufnr, start_line - 1, end_line, false)) do
+    table.insert(lines, { line = start_line + i - 1, text = text })
+  end
+
+  return {
+    path = vim.api.nvim_buf_get_name(bufnr),
+    cursorLine = cursor,
+    startLine = start_line,
+    endLine = end_line,
+    lines = lines,
+  }
+end
+
+---Get a range of lines, clamped to the buffer's bounds
+---@param file_path string The path to the file
+---@param start_line number 1-based first line
+---@param end_line number 1-based last line, inclusive
+---@return table|nil range The lines read, or nil if the file is not loaded
+function M.get_range(file_path, start_line, end_line)
+  local bufnr = find_buffer(file_path)
+  if not bufnr then
+    return nil
+  end
+
+  local line_count = vim.api.nvim_buf_line_count(bufnr)
+  start_line = math.max(start_line, 1)
+  end_line = math.min(end_line, line_count)
+
+  local lines = {}
+  if start_line <= end_line then
+    for i, text in ipairs(vim.api.nvim_buf_get_lines(bufnr, start_line - 1, end_line, false)) do
+      table.insert(lines, { line = start_line + i - 1, text = text })
+    end
+  end
+
+  return {
+    path = vim.api.nvim_buf_get_name(bufnr),
+    startLine = start_line,
+    endLine = end_line,
+    totalLines = line_count,
+    lines = lines,
+    encoding = vim.bo[bufnr].fileencoding ~= '' and vim.bo[bufnr].fileencoding or vim.o.encoding,
+  }
+end
+
+---Get the content of loaded buffers
+---@param file_paths string[] Paths to read; empty selects every open file buffer
+---@return table[] contents List of { path, content } for each loaded buffer
+function M.get_contents(file_paths)
+  local bufnrs = {}
+  if #file_paths == 0 then
+    for _, bufnr in ipairs(vim.api.nvim_list_bufs()) do
+      local is_file = vim.api.nvim_buf_get_name(bufnr) ~= '' and vim.bo[bufnr].buftype == ''
+      if vim.api.nvim_buf_is_loaded(bufnr) and is_file then
+        table.insert(bufnrs, bufnr)
+      end
+    end
+  else
+    for _, file_path in ipairs(file_paths) do
+      local bufnr = find_buffer(file_path)
+      if bufnr then
+        table.insert(bufnrs, bufnr)
+      end
+    end
+  end
+
+  local contents = {}
+  for _, bufnr in ipairs(bufnrs) do
+    table.insert(contents, {
+      path = vim.api.nvim_buf_get_name(bufnr),
+      content = table.concat(vim.api.nvim_buf_get_lines(bufnr, 0, -1, false), '\n'),
+    })
+  end
+  return contents
+end
+
+-- Helper: Attach change forwarding to a file buffer for the current subscription
+---@param bufnr number
+local function attach_changes(bufnr)
+  local generation = subscription_generation
+  local is_file = vim.api.nvim_buf_get_name(bufnr) ~= '' and vim.bo[bufnr].buftype == ''
+  if attached[bufnr] == generation or not vim.api.nvim_buf_is_loaded(bufnr) or not is_file then
+    return
+  end
+
+  attached[bufnr] = generation
+  vim.api.nvim_buf_attach(bufnr, false, {
+    on_lines = function(_, buf, changedtick)
+      if attached[buf] ~= generation then
+        return true -- Detach stale attachment
+      end
+      pcall(function()
+        vim.fn.rpcnotify(0, 'gemini_buffer_changed', vim.api.nvim_buf_get_name(buf), changedtick)
+      end)
+    end,
+    on_detach = function(_, buf)
+      if attached[buf] == generation then
+        attached[buf] = nil
+      end
+    end,
+  })
+end
+
+---Forward change ticks of all file buffers (current and future) to the MCP server
+function M.subscribe_changes()
+  subscription_generation = subscription_generation + 1
+  attached = {}
+
+  for _, bufnr in ipairs(vim.api.nvim_list_bufs()) do
+    attach_changes(bufnr)
+  end
+
+  local group = vim.api.nvim_create_augroup('GeminiCliBufferEvents', { clear = true })
+  vim.api.nvim_create_autocmd({ 'BufReadPost', 'BufNewFile' }, {
+    group = group,
+    callback = function(args)
+      attach_changes(args.buf)
+    end,
+  })
+end
+
+---Stop forwarding buffer change ticks
+function M.unsubscribe_changes()
+  subscription_generation = subscription_generation + 1
+  attached = {}
+  vim.api.nvim_create_augroup('GeminiCliBufferEvents', { clear = true })
+end
+
+-- Helper: Describe a buffer for the MCP server
+---@param bufnr number
+---@return table buffer { buffer, path, filetype, modified }
+local function describe_buffer(bufnr)
+  return {
+    buffer = bufnr,
+    path = vim.api.nvim_buf_get_name(bufnr),
+    filetype = vim.bo[bufnr].filetype,
+    modified = vim.bo[bufnr].modified,
+  }
+end
+
+---Get the buffer shown in the current window
+---@return table buffer { buffer, path, filetype, modified }
+function M.get_active()
+  return describe_buffer(vim.api.nvim_get_current_buf())
+end
+
+---Make the buffer for a file the active one, focusing a window that already
+---shows it or else switching the current window to it
+---@param file_path string The path to the file
+---@return table|nil buffer The new active buffer, or nil if the file is not loaded
+function M.set_active(file_path)
+  local bufnr = find_buffer(file_path)
+  if not bufnr then
+    return nil
+  end
+
+  local win = vim.fn.bufwinid(bufnr)
+  if win ~= -1 then
+    vim.api.nvim_set_current_win(win)
+  else
+    vim.api.nvim_set_current_buf(bufnr)
+  end
+  return describe_buffer(bufnr)
+end
+
+return M
@@ -0,0 +1,23 @@
+---@brief [[
+--- Confirm Module
+--- Asks the user to approve an action on behalf of the MCP server.
+---@brief ]]
+
+---@module 'gemini-cli.confirm'
+local M = {}
+
+---Show a Yes/No prompt without blocking the RPC caller. The answer is sent
+---back as a gemini_confirm_result notification tagged with id.
+---@param id number Request id echoed back to the server
+---@param prompt string Question shown to the user
+function M.request(id, prompt)
+  vim.schedule(function()
+    local ok, choice = pcall(vim.fn.confirm, prompt, '&Yes\n&No', 2, 'Question')
+    if not ok then
+      choice = 0
+    end
+    vim.fn.rpcnotify(0, 'gemini_confirm_result', id, choice)
+  end)
+end
+
+return M
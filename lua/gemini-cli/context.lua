@@ -38,6 +38,10 @@ function M.get_context()
             line = cursor[1],
             character = cursor[2] + 1, -- Convert to 1-based
           }
+          file.visibleRange = {
+            start = vim.fn.line('w0'),
+            ['end'] = vim.fn.line('w$'),
+          }
 
           -- Get selected text if in visual mode
           local mode = vim.api.nvim_get_mode().mode
@@ -114,8 +118,8 @@ function M.setup_tracking()
     callback = debounced_update,
   })
 
-  -- Track cursor movement
-  vim.api.nvim_create_autocmd({ 'CursorMoved', 'CursorMovedI' }, {
+  -- Track cursor movement and scrolling
+  vim.api.nvim_create_autocmd({ 'CursorMoved', 'CursorMovedI', 'WinScrolled' }, {
     group = group,
     callback = debounced_update,
   })
@@ -0,0 +1,103 @@
+---@brief [[
+--- Diagnostics Module
+--- Toggles how diagnostics are displayed, summarizes them and moves between them on behalf of the MCP server.
+---@brief ]]
+
+---@module 'gemini-cli.diagnostics'
+local M = {}
+
+-- Display settings from before the first change, restored by M.restore
+---@type table|nil
+local saved = nil
+
+-- Helper: Whether a vim.diagnostic.config() display value is enabled
+---@param value any
+---@return boolean
+local function enabled(value)
+  return value ~= nil and value ~= false
+end
+
+---Enable or disable diagnostic virtual text and signs
+---@param opts table { virtualText = boolean|nil, signs = boolean|nil }; nil leaves a setting alone
+---@return table previous { virtualText = boolean, signs = boolean } before the change
+function M.set_display(opts)
+  local config = vim.diagnostic.config() or {}
+  if not saved then
+    saved = { virtual_text = config.virtual_text, signs = config.signs }
+  end
+
+  vim.diagnostic.config({ virtual_text = opts.virtualText, signs = opts.signs })
+  return { virtualText = enabled(config.virtual_text), signs = enabled(config.signs) }
+end
+
+---Restore the display settings from before the first set_display call
+function M.restore()
+  if saved then
+    vim.diagnostic.config({
+      -- false rather than nil so a setting that was unset is switched back off
+      virtual_text = saved.virtual_text or false,
+      signs = saved.signs or false,
+    })
+    saved = nil
+  end
+end
+
+---Count the diagnostics of every loaded file buffer by severity
+---@return table[] counts { path, error, warning, info, hint } for buffers with any diagnostics
+function M.summary()
+  local severity = vim.diagnostic.severity
+  local counts = {}
+  for _, bufnr in ipairs(vim.api.nvim_list_bufs()) do
+    local path = vim.api.nvim_buf_get_name(bufnr)
+    if vim.api.nvim_buf_is_loaded(bufnr) and path ~= '' and vim.bo[bufnr].buftype == '' then
+      local count = vim.diagnostic.count(bufnr)
+      if next(count) then
+        table.insert(counts, {
+          path = path,
+          error = count[severity.ERROR] or 0,
+          warning = count[severity.WARN] or 0,
+          info = count[severity.INFO] or 0,
+          hint = count[severity.HINT] or 0,
+        })
+      end
+    end
+  end
+  return counts
+end
+
+-- Severity names reported to the MCP server, by vim.diagnostic.severity value
+local severity_names = { 'error', 'warning', 'info', 'hint' }
+
+---Move the cursor to the next or previous diagnostic in the current buffer,
+---without wrapping around
+---@param forward boolean true for the next diagnostic, false for the previous one
+---@param severity string|nil Only stop at diagnostics of this severity ("ERROR", "WARN", "INFO" or "HINT")
+---@return table|nil location { path, line, column, severity, message, source }, or nil if there are no more
+function M.jump(forward, severity)
+  local opts = { wrap = false }
+  if severity then
+    opts.severity = vim.diagnostic.severity[severity]
+  end
+
+  local diagnostic
+  if forward then
+    diagnostic = vim.diagnostic.get_next(opts)
+  else
+    diagnostic = vim.diagnostic.get_prev(opts)
+  end
+  if not diagnostic then
+    return nil
+  end
+
+  vim.api.nvim_win_set_cursor(0, { diagnostic.lnum + 1, diagnostic.col })
+  return {
+    path = vim.api.nvim_buf_get_name(diagnostic.bufnr),
+    line = diagnostic.lnum + 1,
+    column = diagnostic.col + 1,
+    severity = severity_names[diagnostic.severity] or '',
+    message = diagnostic.message,
+    source = diagnostic.source or '',
+  }
+end
+
+return M
@@ -11,6 +11,30 @@ local log = require('gemini-cli.log')
 ---@type table<string, {original_buf: number, original_win: number, diff_buf: number, diff_win: number}>
 local active_diffs = {}
 
+-- Track multi-file edits: each file maps to the list of files accepted or rejected with it
+---@type table<string, string[]>
+local diff_groups = {}
+
+-- Helper: Compute the hunks between a diff's original buffer and its proposed content
+---@param diff table An entry of active_diffs
+---@return table[] hunks List of { oldStart, oldCount, newStart, newCount } (1-based)
+local function compute_hunks(diff)
+  local text_diff = vim.text and vim.text.diff or vim.diff
+  local old = table.concat(vim.api.nvim_buf_get_lines(diff.original_buf, 0, -1, false), '\n') .. '\n'
+  local new = table.concat(vim.api.nvim_buf_get_lines(diff.diff_buf, 0, -1, false), '\n') .. '\n'
+
+  local hunks = {}
+  for _, indices in ipairs(text_diff(old, new, { result_type = 'indices' })) do
+    table.insert(hunks, {
+      oldStart = indices[1],
+      oldCount = indices[2],
+      newStart = indices[3],
+      newCount = indices[4],
+    })
+  end
+  return hunks
+end
+
 -- Helper: Find a suitable editable window for opening diff
 -- Returns: window_id (or nil if no suitable window found)
 ---@return number|nil window_id The window ID of a suitable editable window, or nil
@@ -54,18 +78,37 @@ local function find_editable_window()
   return nil
 end
 
+-- Helper: Close a tab page opened for a diff. Modified buffers in it stay
+-- loaded, and the last tab page is left alone.
+---@param tab number|nil
+local function close_tab(tab)
+  if tab and vim.api.nvim_tabpage_is_valid(tab) and #vim.api.nvim_list_tabpages() > 1 then
+    pcall(vim.cmd, 'tabclose! ' .. vim.api.nvim_tabpage_get_number(tab))
+  end
+end
+
 ---Open a diff view for a file
 ---@param file_path string|table The path to the file (or a table of args from RPC)
 ---@param new_content string|nil The new content for the file (if file_path is string)
----@return boolean success Whether the operation was successful
-function M.open_diff(file_path, new_content)
+---@param filetype string|nil Filetype for the diff buffer (detected from file_path if empty)
+---@param accept_on_save boolean|nil Whether :w in the diff buffer accepts it (the allow_w_to_accept option if nil)
+---@param layout string|nil 'tab', 'vertical' or 'horizontal' (side by side in an editable window if nil)
+---@return table[] hunks The hunk layout of the diff (see compute_hunks)
+function M.open_diff(file_path, new_content, filetype, accept_on_save, layout)
   if type(file_path) == 'table' then
     -- Attempt to unpack if it looks like the args list
     if #file_path >= 2 and type(file_path[1]) == 'string' then
       new_content = file_path[2]
+      filetype = file_path[3]
+      accept_on_save = file_path[4]
+      layout = file_path[5]
       file_path = file_path[1]
     end
   end
+  -- The server sends nil to skip accept_on_save when only passing a layout
+  if accept_on_save == vim.NIL then
+    accept_on_save = nil
+  end
 
   -- Close existing diff for this file if any
   if active_diffs[file_path] then
@@ -94,68 +137,96 @@ function M.open_diff(file_path, new_content)
   -- Set new content
   local new_lines = vim.split(new_content, '\n')
   vim.api.nvim_buf_set_lines(new_buf, 0, -1, false, new_lines)
-  vim.api.nvim_buf_set_option(new_buf, 'filetype', vim.filetype.match({ filename = file_path }) or '')
+  if not filetype or filetype == '' then
+    filetype = vim.filetype.match({ filename = file_path }) or ''
+  end
+  vim.api.nvim_buf_set_option(new_buf, 'filetype', filetype)
   vim.api.nvim_buf_set_option(new_buf, 'modifiable', true)
   vim.api.nvim_buf_set_option(new_buf, 'buftype', 'acwrite') -- Virtual buffer that handles :w manually
 
-  -- Find or create an editable window
-  local editable_win = find_editable_window()
-
-  if editable_win then
-    -- Use existing editable window
-    vim.api.nvim_set_current_win(editable_win)
-    vim.cmd('edit ' .. vim.fn.fnameescape(file_path))
+  -- Find or create an editable window; a tab layout always gets a fresh tab page
+  local editable_win, tab = nil, nil
+  if layout == 'tab' then
+    vim.cmd('tabnew')
+    tab = vim.api.nvim_get_current_tabpage()
+    editable_win = vim.api.nvim_get_current_win()
   else
-    -- No editable window found, create a new split
-    -- First, try to find any non-special window to split from
-    local all_wins = vim.api.nvim_tabpage_list_wins(0)
-    local best_win = nil
-    for _, win in ipairs(all_wins) do
-      local buf = vim.api.nvim_win_get_buf(win)
-      local filetype = vim.api.nvim_buf_get_option(buf, 'filetype')
-      -- Avoid splitting from nvimtree/terminal
-      if filetype ~= 'NvimTree' and filetype ~= 'neo-tree' and filetype ~= 'terminal' then
-        best_win = win
-        break
+    editable_win = find_editable_window()
+  end
+
+  local original_win, original_buf, diff_win
+  local ok, err = pcall(function()
+    if editable_win then
+      -- Use existing editable window
+      vim.api.nvim_set_current_win(editable_win)
+      vim.cmd('edit ' .. vim.fn.fnameescape(file_path))
+    else
+      -- No editable window found, create a new split
+      -- First, try to find any non-special window to split from
+      local all_wins = vim.api.nvim_tabpage_list_wins(0)
+      local best_win = nil
+      for _, win in ipairs(all_wins) do
+        local buf = vim.api.nvim_win_get_buf(win)
+        local filetype = vim.api.nvim_buf_get_option(buf, 'filetype')
+        -- Avoid splitting from nvimtree/terminal
+        if filetype ~= 'NvimTree' and filetype ~= 'neo-tree' and filetype ~= 'terminal' then
+          best_win = win
+          break
+        end
       end
-    end
 
-    if best_win then
-      vim.api.nvim_set_current_win(best_win)
-    end
+      if best_win then
+        vim.api.nvim_set_current_win(best_win)
+      end
 
-    -- Create new split for the original file
-    vim.cmd('vsplit ' .. vim.fn.fnameescape(file_path))
-  end
+      -- Create new split for the original file
+      vim.cmd('vsplit ' .. vim.fn.fnameescape(file_path))
+    end
 
-  local original_win = vim.api.nvim_get_current_win()
-  local original_buf = vim.api.nvim_win_get_buf(original_win)
+    original_win = vim.api.nvim_get_current_win()
+    original_buf = vim.api.nvim_win_get_buf(original_win)
 
-  -- Ensure original buffer has the correct file path
-  local current_buf_name = vim.api.nvim_buf_get_name(original_buf)
-  if current_buf_name ~= file_path then
-    vim.api.nvim_buf_set_name(original_buf, file_path)
-  end
+    -- Ensure original buffer has the correct file path
+    local current_buf_name = vim.api.nvim_buf_get_name(original_buf)
+    if current_buf_name ~= file_path then
+      vim.api.nvim_buf_set_name(original_buf, file_path)
+    end
 
-  -- Split and show diff
-  vim.cmd('vertical split')
-  local diff_win = vim.api.nvim_get_current_win()
-  vim.api.nvim_win_set_buf(diff_win, new_buf)
+    -- Split and show diff
+    if layout == 'horizontal' then
+      vim.cmd('split')
+    else
+      vim.cmd('vertical split')
+    end
+    diff_win = vim.api.nvim_get_current_win()
+    vim.api.nvim_win_set_buf(diff_win, new_buf)
 
-  -- Enable diff mode ONLY on these two windows
-  vim.api.nvim_win_call(original_win, function()
-    vim.cmd('diffthis')
-  end)
-  vim.api.nvim_win_call(diff_win, function()
-    vim.cmd('diffthis')
+    -- Enable diff mode ONLY on these two windows
+    vim.api.nvim_win_call(original_win, function()
+      vim.cmd('diffthis')
+    end)
+    vim.api.nvim_win_call(diff_win, function()
+      vim.cmd('diffthis')
+    end)
   end)
+  if not ok then
+    -- Don't leave a half-built layout behind
+    close_tab(tab)
+    if vim.api.nvim_buf_is_valid(new_buf) then
+      vim.api.nvim_buf_delete(new_buf, { force = true })
+    end
+    error(err, 0)
+  end
 
   -- Set up :w (write) to accept changes
   vim.api.nvim_create_autocmd('BufWriteCmd', {
     buffer = new_buf,
     callback = function()
-      local config = require('gemini-cli').get_config()
-      if config.allow_w_to_accept then
+      local accept = accept_on_save
+      if accept == nil then
+        accept = require('gemini-cli').get_config().allow_w_to_accept
+      end
+      if accept then
         M.accept_diff(file_path)
       else
         log.info('Please accept changes in the Gemini CLI')
@@ -173,12 +244,13 @@ function M.open_diff(file_path, new_content)
     original_win = original_win,
     diff_buf = new_buf,
     diff_win = diff_win,
+    tab = tab,
   }
 
   -- Show instructions (non-blocking)
   log.info_silent('Gemini diff opened. Press :w in the diff window to accept changes.')
 
-  return true
+  return compute_hunks(active_diffs[file_path])
 end
 
 ---Close diff view and return final content
@@ -208,18 +280,73 @@ function M.close_diff(file_path)
     end)
   end
 
+  -- A tab page opened for the diff goes with it
+  close_tab(diff.tab)
+
   active_diffs[file_path] = nil
+  diff_groups[file_path] = nil
   return content
 end
 
+-- Helper: Accept every diff of a multi-file edit, or none of them
+---@param group string[] File paths of the multi-file edit
+local function accept_group(group)
+  -- Verify all diffs are still open before touching any buffer
+  for _, path in ipairs(group) do
+    if not active_diffs[path] then
+      log.error('Cannot apply multi-file edit: diff for ' .. path .. ' is no longer open')
+      return
+    end
+  end
+
+  -- Apply all changes, restoring the originals if any buffer refuses them
+  local applied = {}
+  for _, path in ipairs(group) do
+    local diff = active_diffs[path]
+    local original_lines = vim.api.nvim_buf_get_lines(diff.original_buf, 0, -1, false)
+    local new_lines = vim.api.nvim_buf_get_lines(diff.diff_buf, 0, -1, false)
+    local ok, err = pcall(vim.api.nvim_buf_set_lines, diff.original_buf, 0, -1, false, new_lines)
+    if not ok then
+      for _, done in ipairs(applied) do
+        vim.api.nvim_buf_set_lines(done.buf, 0, -1, false, done.lines)
+      end
+      log.error('Multi-file edit rolled back, ' .. path .. ' could not be changed: ' .. tostring(err))
+      return
+    end
+    table.insert(applied, { buf = diff.original_buf, lines = original_lines })
+  end
+
+  -- Every buffer holds its new content; accept each to save, notify and close
+  for _, path in ipairs(group) do
+    diff_groups[path] = nil
+    M.accept_diff(path)
+  end
+end
+
 ---Accept diff changes
 ---@param file_path string The path to the file
-function M.accept_diff(file_path)
+---@param encoding string|nil 'fileencoding' to write the file in (the buffer's own if nil)
+function M.accept_diff(file_path, encoding)
   local diff = active_diffs[file_path]
   if not diff then
     return
   end
 
+  if diff_groups[file_path] then
+    accept_group(diff_groups[file_path])
+    return
+  end
+
+  -- Refuse up front rather than failing halfway; the server matches this message
+  if not vim.bo[diff.original_buf].modifiable or vim.bo[diff.original_buf].readonly then
+    error('buffer is not modifiable: ' .. file_path, 0)
+  end
+
+  -- Written below, so the file is saved in this encoding
+  if encoding and encoding ~= '' then
+    vim.bo[diff.original_buf].fileencoding = encoding
+  end
+
   -- Get new content from diff buffer
   local new_lines = vim.api.nvim_buf_get_lines(diff.diff_buf, 0, -1, false)
 
@@ -240,9 +367,12 @@ function M.accept_diff(file_path)
 
   -- Notify server immediately (synchronous)
   -- Since we just saved, the file on disk is fresh.
+  -- Include the file's line endings and BOM so the server can reproduce the bytes on disk
   local content = table.concat(new_lines, '\n')
+  local fileformat = vim.bo[diff.original_buf].fileformat
+  local bomb = vim.bo[diff.original_buf].bomb
   local ok, err = pcall(function()
-    vim.fn.rpcnotify(0, 'gemini_diff_accepted', file_path, content)
+    vim.fn.rpcnotify(0, 'gemini_diff_accepted', file_path, content, fileformat, bomb)
   end)
   if not ok then
     log.error('RPC notification failed: ' .. tostring(err))
@@ -255,9 +385,57 @@ function M.accept_diff(file_path)
   log.info_silent('Gemini changes accepted and saved.')
 end
 
+---Apply selected hunks to the original buffer, keeping the diff open for the rest
+---@param file_path string The path to the file
+---@param indices number[] 0-based indices into the current hunk layout
+---@return table|nil result { hunks = remaining hunk layout }, or nil if no diff was active
+function M.accept_hunks(file_path, indices)
+  local diff = active_diffs[file_path]
+  if not diff then
+    return nil
+  end
+
+  local hunks = compute_hunks(diff)
+  local selected = {}
+  for _, index in ipairs(indices) do
+    table.insert(selected, hunks[index + 1])
+  end
+
+  -- Apply bottom-up so earlier hunks keep their line numbers
+  table.sort(selected, function(a, b)
+    return a.oldStart > b.oldStart
+  end)
+
+  local new_lines = vim.api.nvim_buf_get_lines(diff.diff_buf, 0, -1, false)
+  for _, hunk in ipairs(selected) do
+    local replacement = vim.list_slice(new_lines, hunk.newStart, hunk.newStart + hunk.newCount - 1)
+    -- Pure insertions (oldCount == 0) go after oldStart
+    local first = hunk.oldCount == 0 and hunk.oldStart or hunk.oldStart - 1
+    vim.api.nvim_buf_set_lines(diff.original_buf, first, first + hunk.oldCount, false, replacement)
+  end
+
+  vim.api.nvim_win_call(diff.original_win, function()
+    vim.cmd('diffupdate')
+  end)
+
+  return { hunks = compute_hunks(diff) }
+end
+
 ---Reject diff changes
 ---@param file_path string The path to the file
 function M.reject_diff(file_path)
+  -- Rejecting any file of a multi-file edit rejects all of them
+  local group = diff_groups[file_path]
+  if group then
+    for _, path in ipairs(group) do
+      diff_groups[path] = nil
+    end
+    for _, path in ipairs(group) do
+      M.reject_diff(path)
+    end
+    return
+  end
+
   -- Close diff
   M.close_diff(file_path)
 
@@ -270,6 +448,56 @@ function M.reject_diff(file_path)
   log.info_silent('Gemini changes rejected')
 end
 
+---Open diffs for several files that are accepted or rejected together
+---@param edits table[] List of { filePath, newContent, filetype }
+---@param accept_on_save boolean|nil Whether :w in each diff buffer accepts it (see open_diff)
+---@return table[] results List of { filePath, success, error } in edit order
+function M.open_multi_diff(edits, accept_on_save)
+  local results = {}
+  local opened = {}
+  for _, edit in ipairs(edits) do
+    -- Give each file its own tab so the diffs don't pile up as splits; the
+    -- tab closes with the diff, including on rollback
+    local ok, err = pcall(M.open_diff, edit.filePath, edit.newContent, edit.filetype, accept_on_save, 'tab')
+    table.insert(results, { filePath = edit.filePath, success = ok, error = ok and '' or tostring(err) })
+    if ok then
+      table.insert(opened, edit.filePath)
+    end
+  end
+
+  if #opened < #edits then
+    -- All or nothing: close the diffs that did open
+    for _, path in ipairs(opened) do
+      M.close_diff(path)
+    end
+    for _, result in ipairs(results) do
+      if result.success then
+        result.success = false
+        result.error = 'not opened because another file in the edit failed'
+      end
+    end
+    return results
+  end
+
+  for _, path in ipairs(opened) do
+    diff_groups[path] = opened
+  end
+  return results
+end
+
+---Bring a diff's window to the foreground, switching to its tab page
+---@param file_path string The path to the file
+---@return boolean focused Whether the diff is open and its window still exists
+function M.focus_diff(file_path)
+  local diff = active_diffs[file_path]
+  if not diff or not vim.api.nvim_win_is_valid(diff.diff_win) then
+    return false
+  end
+  vim.api.nvim_set_current_tabpage(vim.api.nvim_win_get_tabpage(diff.diff_win))
+  vim.api.nvim_set_current_win(diff.diff_win)
+  return true
+end
+
 ---Get list of active diffs
 ---@return string[] diffs List of file paths with active diffs
 function M.get_active_diffs()
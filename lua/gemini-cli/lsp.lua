@@ -0,0 +1,452 @@
+---@brief [[
+--- LSP Module
+--- Answers language server queries (symbols, ...) on behalf of the MCP server.
+---@brief ]]
+
+---@module 'gemini-cli.lsp'
+local M = {}
+local buffer = require('gemini-cli.buffer')
+
+-- Timeout for synchronous LSP requests
+local request_timeout_ms = 2000
+
+-- The last rename computed by prepare_rename, kept until the server applies it
+---@type {id: number, edit: table, encoding: string, files: string[]}|nil
+local pending_rename = nil
+local next_rename_id = 0
+
+-- Helper: Find a buffer attached to the given client
+---@param client vim.lsp.Client
+---@return number|nil bufnr
+local function attached_buffer(client)
+  for bufnr, _ in pairs(client.attached_buffers or {}) do
+    if vim.api.nvim_buf_is_valid(bufnr) then
+      return bufnr
+    end
+  end
+  return nil
+end
+
+---Search workspace symbols across all LSP clients supporting workspace/symbol
+---@param query string The symbol query
+---@param limit number Maximum number of symbols to return
+---@return table result { supported = boolean, symbols = {name, kind, path, line}[] }
+function M.workspace_symbols(query, limit)
+  local clients = vim.lsp.get_clients({ method = 'workspace/symbol' })
+  if #clients == 0 then
+    return { supported = false, symbols = {} }
+  end
+
+  local symbols = {}
+  for _, client in ipairs(clients) do
+    local bufnr = attached_buffer(client)
+    local response = bufnr and client.request_sync('workspace/symbol', { query = query }, request_timeout_ms, bufnr)
+    for _, symbol in ipairs(response and response.result or {}) do
+      if #symbols >= limit then
+        break
+      end
+      local location = symbol.location or {}
+      local line = location.range and location.range.start.line + 1 or 1
+      table.insert(symbols, {
+        name = symbol.name,
+        kind = vim.lsp.protocol.SymbolKind[symbol.kind] or 'Unknown',
+        path = location.uri and vim.uri_to_fname(location.uri) or '',
+        line = line,
+      })
+    end
+  end
+
+  return { supported = true, symbols = symbols }
+end
+
+-- Helper: Check whether an LSP range contains a 0-based position
+---@param range table LSP range
+---@param line number
+---@param character number
+---@return boolean
+local function range_contains(range, line, character)
+  local s, e = range.start, range['end']
+  if line < s.line or line > e.line then
+    return false
+  end
+  if line == s.line and character < s.character then
+    return false
+  end
+  if line == e.line and character > e.character then
+    return false
+  end
+  return true
+end
+
+-- Helper: Find the innermost document symbol containing a position. Handles
+-- both hierarchical DocumentSymbol[] and flat SymbolInformation[] results.
+---@param symbols table[]
+---@param line number 0-based
+---@param character number 0-based
+---@return table|nil symbol, table|nil range
+local function innermost_symbol(symbols, line, character)
+  local best, best_range
+  for _, symbol in ipairs(symbols or {}) do
+    local range = symbol.range or (symbol.location and symbol.location.range)
+    if range and range_contains(range, line, character) then
+      local candidate, candidate_range = symbol, range
+      local child, child_range = innermost_symbol(symbol.children, line, character)
+      if child then
+        candidate, candidate_range = child, child_range
+      end
+      -- Keep the narrowest match; flat results list nested symbols side by side
+      local span = candidate_range['end'].line - candidate_range.start.line
+      if not best or span < best_range['end'].line - best_range.start.line then
+        best, best_range = candidate, candidate_range
+      end
+    end
+  end
+  return best, best_range
+end
+
+-- Helper: Find the enclosing symbol through the buffer's language servers
+---@param bufnr number
+---@param line number 0-based
+---@param character number 0-based
+---@return table|nil symbol
+local function lsp_enclosing_symbol(bufnr, line, character)
+  local params = { textDocument = vim.lsp.util.make_text_document_params(bufnr) }
+  for _, client in ipairs(vim.lsp.get_clients({ bufnr = bufnr, method = 'textDocument/documentSymbol' })) do
+    local response = client.request_sync('textDocument/documentSymbol', params, request_timeout_ms, bufnr)
+    local symbol, range = innermost_symbol(response and response.result, line, character)
+    if symbol then
+      return {
+        name = symbol.name,
+        kind = vim.lsp.protocol.SymbolKind[symbol.kind] or 'Unknown',
+        startLine = range.start.line + 1,
+        endLine = range['end'].line + 1,
+        source = 'lsp',
+      }
+    end
+  end
+  return nil
+end
+
+-- Tree-sitter scope node types are named <kind>_<role>, e.g. function_definition,
+-- method_declaration or impl_item; Ruby uses the bare kind (method, class,
+-- module). Whole words are compared, so function_call and implements_clause
+-- are not scopes.
+local scope_kinds = {
+  ['function'] = true,
+  method = true,
+  class = true,
+  struct = true,
+  impl = true,
+  interface = true,
+  module = true,
+}
+local scope_roles = { definition = true, declaration = true, item = true, specifier = true }
+
+-- Helper: Check whether a tree-sitter node type is a scope
+---@param node_type string
+---@return boolean
+local function is_scope_node(node_type)
+  if scope_kinds[node_type] then
+    return true
+  end
+  local kind, role = node_type:match('(%a+)_(%a+)$')
+  return kind ~= nil and scope_kinds[kind] == true and scope_roles[role] == true
+end
+
+-- Helper: Describe a tree-sitter scope node as a symbol
+---@param node TSNode
+---@param bufnr number
+---@return table symbol { name, kind, startLine, endLine }
+local function treesitter_symbol(node, bufnr)
+  local start_row, _, end_row, _ = node:range()
+  local name_node = node:field('name')[1]
+  return {
+    name = name_node and vim.treesitter.get_node_text(name_node, bufnr) or '',
+    kind = node:type(),
+    startLine = start_row + 1,
+    endLine = end_row + 1,
+  }
+end
+
+-- Helper: Find the enclosing function-like node through tree-sitter
+---@param bufnr number
+---@param line number 0-based
+---@param character number 0-based
+---@return table|nil symbol
+local function treesitter_enclosing_symbol(bufnr, line, character)
+  local ok, node = pcall(vim.treesitter.get_node, { bufnr = bufnr, pos = { line, character } })
+  if not ok then
+    return nil
+  end
+  while node do
+    if is_scope_node(node:type()) then
+      local symbol = treesitter_symbol(node, bufnr)
+      symbol.source = 'treesitter'
+      return symbol
+    end
+    node = node:parent()
+  end
+  return nil
+end
+
+---Find the symbol (function, method, class, ...) enclosing the cursor in the
+---current buffer, using LSP document symbols and falling back to tree-sitter.
+---When neither finds one, the whole file is returned.
+---@return table symbol { name, kind, path, startLine, endLine, source }
+function M.enclosing_symbol()
+  local bufnr = vim.api.nvim_get_current_buf()
+  local cursor = vim.api.nvim_win_get_cursor(0)
+  local line, character = cursor[1] - 1, cursor[2]
+  local path = vim.api.nvim_buf_get_name(bufnr)
+
+  local symbol = lsp_enclosing_symbol(bufnr, line, character)
+    or treesitter_enclosing_symbol(bufnr, line, character)
+    or {
+      name = vim.fn.fnamemodify(path, ':t'),
+      kind = 'File',
+      startLine = 1,
+      endLine = vim.api.nvim_buf_line_count(bufnr),
+      source = 'file',
+    }
+  symbol.path = path
+  symbol.cursorLine = cursor[1]
+  return symbol
+end
+
+-- Helper: Flatten LSP document symbols in document order, recording how
+-- deeply each is nested. Flat SymbolInformation[] results are all at depth 0.
+---@param symbols table[]|nil
+---@param depth number
+---@param out table[] Receives { name, kind, startLine, endLine, depth }
+---@param limit number Maximum length of out
+local function flatten_lsp_symbols(symbols, depth, out, limit)
+  for _, symbol in ipairs(symbols or {}) do
+    if #out >= limit then
+      return
+    end
+    local range = symbol.range or (symbol.location and symbol.location.range)
+    if range then
+      table.insert(out, {
+        name = symbol.name,
+        kind = vim.lsp.protocol.SymbolKind[symbol.kind] or 'Unknown',
+        startLine = range.start.line + 1,
+        endLine = range['end'].line + 1,
+        depth = depth,
+      })
+    end
+    flatten_lsp_symbols(symbol.children, depth + 1, out, limit)
+  end
+end
+
+-- Helper: Get the document symbols from the buffer's language servers
+---@param bufnr number
+---@param limit number
+---@return table[]|nil symbols, or nil if no language server answered
+local function lsp_document_symbols(bufnr, limit)
+  local params = { textDocument = vim.lsp.util.make_text_document_params(bufnr) }
+  for _, client in ipairs(vim.lsp.get_clients({ bufnr = bufnr, method = 'textDocument/documentSymbol' })) do
+    local response = client.request_sync('textDocument/documentSymbol', params, request_timeout_ms, bufnr)
+    if response and response.result then
+      local symbols = {}
+      flatten_lsp_symbols(response.result, 0, symbols, limit)
+      return symbols
+    end
+  end
+  return nil
+end
+
+-- Helper: Get the scope nodes of the buffer's syntax tree as symbols
+---@param bufnr number
+---@param limit number
+---@return table[]|nil symbols, or nil if the buffer has no tree-sitter parser
+local function treesitter_document_symbols(bufnr, limit)
+  local ok, parser = pcall(vim.treesitter.get_parser, bufnr)
+  if not ok or not parser then
+    return nil
+  end
+  local tree = parser:parse()[1]
+  if not tree then
+    return nil
+  end
+
+  local symbols = {}
+  local function walk(node, depth)
+    for child in node:iter_children() do
+      if #symbols >= limit then
+        return
+      end
+      local child_depth = depth
+      if child:named() and is_scope_node(child:type()) then
+        local symbol = treesitter_symbol(child, bufnr)
+        symbol.depth = depth
+        table.insert(symbols, symbol)
+        child_depth = depth + 1
+      end
+      walk(child, child_depth)
+    end
+  end
+  walk(tree:root(), 0)
+  return symbols
+end
+
+---Get the outline of a file as a flat list of symbols in document order, each
+---with its nesting depth, using LSP document symbols and falling back to tree-sitter
+---@param file_path string The path to the file
+---@param limit number Maximum number of symbols to return
+---@return table|nil outline { source, symbols = { name, kind, startLine, endLine, depth }[] }, or nil if the file is not loaded
+function M.document_symbols(file_path, limit)
+  local bufnr = buffer.bufnr(file_path)
+  if not bufnr or not vim.api.nvim_buf_is_loaded(bufnr) then
+    return nil
+  end
+
+  local symbols = lsp_document_symbols(bufnr, limit)
+  if symbols then
+    return { source = 'lsp', symbols = symbols }
+  end
+  symbols = treesitter_document_symbols(bufnr, limit)
+  if symbols then
+    return { source = 'treesitter', symbols = symbols }
+  end
+  return { source = 'none', symbols = {} }
+end
+
+---List the language servers attached to a file's buffer and the providers they advertise
+---@param file_path string The path to the file
+---@return table|nil result { clients = { id, name, capabilities = string[] }[] }, or nil if the file is not loaded
+function M.clients(file_path)
+  local bufnr = buffer.bufnr(file_path)
+  if not bufnr or not vim.api.nvim_buf_is_loaded(bufnr) then
+    return nil
+  end
+
+  local clients = {}
+  for _, client in ipairs(vim.lsp.get_clients({ bufnr = bufnr })) do
+    -- Report each enabled *Provider capability, e.g. renameProvider
+    local capabilities = {}
+    for name, value in pairs(client.server_capabilities or {}) do
+      if name:match('Provider$') and value ~= false and value ~= vim.NIL then
+        table.insert(capabilities, name)
+      end
+    end
+    table.sort(capabilities)
+    table.insert(clients, { id = client.id, name = client.name, capabilities = capabilities })
+  end
+  return { clients = clients }
+end
+
+-- Helper: List the files a workspace edit touches, including renamed files' new paths
+---@param edit table LSP WorkspaceEdit
+---@return string[] files
+local function workspace_edit_files(edit)
+  local files, seen = {}, {}
+  local function add(uri)
+    if uri and not seen[uri] then
+      seen[uri] = true
+      table.insert(files, vim.uri_to_fname(uri))
+    end
+  end
+  for uri, _ in pairs(edit.changes or {}) do
+    add(uri)
+  end
+  for _, change in ipairs(edit.documentChanges or {}) do
+    if change.textDocument then
+      add(change.textDocument.uri)
+    end
+    add(change.uri)
+    add(change.oldUri)
+    add(change.newUri)
+  end
+  table.sort(files)
+  return files
+end
+
+---Ask the language server to rename the symbol at a 1-based line and byte column,
+---without applying the edit; apply_rename applies it
+---@param file_path string The path to the file
+---@param line number 1-based line
+---@param column number 1-based byte column
+---@param new_name string The new name of the symbol
+---@return table|nil result { supported, id, files }, or nil if the file is not loaded
+function M.prepare_rename(file_path, line, column, new_name)
+  local bufnr = buffer.bufnr(file_path)
+  if not bufnr or not vim.api.nvim_buf_is_loaded(bufnr) then
+    return nil
+  end
+  if line > vim.api.nvim_buf_line_count(bufnr) then
+    error('line ' .. line .. ' is past the end of the buffer', 0)
+  end
+
+  local client = vim.lsp.get_clients({ bufnr = bufnr, method = 'textDocument/rename' })[1]
+  if not client then
+    return { supported = false, files = {} }
+  end
+
+  local params = {
+    textDocument = vim.lsp.util.make_text_document_params(bufnr),
+    position = {
+      line = line - 1,
+      character = vim.lsp.util.character_offset(bufnr, line - 1, column - 1, client.offset_encoding),
+    },
+    newName = new_name,
+  }
+  local response, err = client.request_sync('textDocument/rename', params, request_timeout_ms, bufnr)
+  if not response then
+    error('rename request failed: ' .. tostring(err), 0)
+  end
+  if response.err then
+    error(response.err.message or tostring(response.err), 0)
+  end
+  if not response.result then
+    error('no symbol to rename at ' .. line .. ':' .. column, 0)
+  end
+
+  next_rename_id = next_rename_id + 1
+  pending_rename = {
+    id = next_rename_id,
+    edit = response.result,
+    encoding = client.offset_encoding,
+    files = workspace_edit_files(response.result),
+  }
+  return { supported = true, id = pending_rename.id, files = pending_rename.files }
+end
+
+---Apply the rename computed by prepare_rename, saving each changed buffer that
+---had no unsaved changes of its own
+---@param id number The id returned by prepare_rename
+---@return table result { unsaved = string[] } files left modified but not written
+function M.apply_rename(id)
+  local rename = pending_rename
+  if not rename or rename.id ~= id then
+    error('rename ' .. id .. ' is no longer pending', 0)
+  end
+  pending_rename = nil
+
+  -- Don't write the user's own unsaved edits along with the rename
+  local modified = {}
+  for _, path in ipairs(rename.files) do
+    local bufnr = buffer.bufnr(path)
+    if bufnr and vim.bo[bufnr].modified then
+      modified[path] = true
+    end
+  end
+
+  vim.lsp.util.apply_workspace_edit(rename.edit, rename.encoding)
+
+  local unsaved = {}
+  for _, path in ipairs(rename.files) do
+    local bufnr = buffer.bufnr(path)
+    if bufnr and vim.api.nvim_buf_is_loaded(bufnr) and vim.bo[bufnr].modified then
+      if modified[path] then
+        table.insert(unsaved, path)
+      else
+        vim.api.nvim_buf_call(bufnr, function()
+          vim.cmd('silent update')
+        end)
+      end
+    end
+  end
+  return { unsaved = unsaved }
+end
+
+return M
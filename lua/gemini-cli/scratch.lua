@@ -0,0 +1,85 @@
+---@brief [[
+--- Scratch Module
+--- Shows throwaway buffers (explanations, plans, ...) on behalf of the MCP server.
+---@brief ]]
+
+---@module 'gemini-cli.scratch'
+local M = {}
+
+-- Scratch buffers created by this module; only these may be updated or closed
+---@type table<number, boolean>
+local scratch_buffers = {}
+
+-- Helper: Replace a scratch buffer's content
+---@param bufnr number
+---@param content string
+local function set_content(bufnr, content)
+  vim.bo[bufnr].modifiable = true
+  vim.api.nvim_buf_set_lines(bufnr, 0, -1, false, vim.split(content, '\n', { plain = true }))
+  vim.bo[bufnr].modifiable = false
+  vim.bo[bufnr].modified = false
+end
+
+-- Helper: Look up a scratch buffer created by this module
+---@param bufnr number
+---@return number bufnr
+local function existing_scratch(bufnr)
+  if not scratch_buffers[bufnr] or not vim.api.nvim_buf_is_valid(bufnr) then
+    scratch_buffers[bufnr] = nil
+    error('not a scratch buffer: ' .. bufnr, 0)
+  end
+  return bufnr
+end
+
+---Show content in a scratch buffer, creating it in a split unless bufnr
+---names an existing scratch buffer to update
+---@param title string Buffer name
+---@param content string Text to show
+---@param filetype string Filetype for highlighting, or '' for none
+---@param bufnr number Scratch buffer to update, or 0 to create one
+---@return number bufnr The scratch buffer
+function M.show(title, content, filetype, bufnr)
+  if bufnr ~= 0 then
+    existing_scratch(bufnr)
+  else
+    bufnr = vim.api.nvim_create_buf(false, true)
+    scratch_buffers[bufnr] = true
+    vim.bo[bufnr].bufhidden = 'wipe'
+    vim.api.nvim_create_autocmd('BufWipeout', {
+      buffer = bufnr,
+      once = true,
+      callback = function()
+        scratch_buffers[bufnr] = nil
+      end,
+    })
+  end
+
+  if title ~= '' then
+    -- Buffer names must be unique; suffix the buffer number on a clash
+    local ok = pcall(vim.api.nvim_buf_set_name, bufnr, 'gemini://' .. title)
+    if not ok then
+      pcall(vim.api.nvim_buf_set_name, bufnr, 'gemini://' .. title .. ' (' .. bufnr .. ')')
+    end
+  end
+  set_content(bufnr, content)
+  if filetype ~= '' then
+    vim.bo[bufnr].filetype = filetype
+  end
+
+  if vim.fn.bufwinid(bufnr) == -1 then
+    local current = vim.api.nvim_get_current_win()
+    vim.cmd('split')
+    vim.api.nvim_win_set_buf(0, bufnr)
+    -- Leave the user where they were
+    vim.api.nvim_set_current_win(current)
+  end
+  return bufnr
+end
+
+---Close a scratch buffer created by show
+---@param bufnr number
+function M.close(bufnr)
+  vim.api.nvim_buf_delete(existing_scratch(bufnr), { force = true })
+end
+
+return M
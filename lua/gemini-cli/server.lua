@@ -219,42 +219,18 @@ function M.status()
         table.insert(status_msg, '    [main] ' .. main_path)
       end
 
-      -- Get parent PID for correct labeling
-      local parent_pid = nil
-      if vim.fn.has('linux') == 1 then
-        -- Linux: read from /proc
-        local stat_file = '/proc/' .. pid .. '/stat'
-        if vim.fn.filereadable(stat_file) == 1 then
-          local stat_content = vim.fn.readfile(stat_file)
-          if #stat_content > 0 then
-            -- Parse PPID from stat file: PID (comm) state PPID ...
-            local stat_line = stat_content[1]
-            local after_comm = stat_line:match('%)%s+(.+)')
-            if after_comm then
-              local fields = {}
-              for field in after_comm:gmatch('%S+') do
-                table.insert(fields, field)
-              end
-              if #fields >= 2 then
-                parent_pid = tonumber(fields[2])
-              end
-            end
-          end
-        end
-      elseif vim.fn.has('mac') == 1 then
-        -- macOS: use ps command
-        local result = vim.system({ 'ps', '-o', 'ppid=', '-p', tostring(pid) }):wait()
-        if result.code == 0 and result.stdout then
-          parent_pid = tonumber(vim.trim(result.stdout))
-        end
+      -- Legacy discovery file (-discovery-format=legacy)
+      local legacy_path = string.format('%s/gemini-ide-server-%d.json', tmpdir, pid)
+      if vim.fn.filereadable(legacy_path) == 1 then
+        table.insert(status_msg, '    [legacy] ' .. legacy_path)
       end
 
-      -- Check for parent discovery file
-      if parent_pid then
-        local parent_file = string.format('gemini-ide-server-%d-%d.json', parent_pid, server_port)
-        local parent_path = discovery_dir .. '/' .. parent_file
-        if vim.fn.filereadable(parent_path) == 1 then
-          table.insert(status_msg, '    [parent] ' .. parent_path)
+      -- Discovery files for the nvim process that launched the server, which
+      -- may be the parent or, behind wrapper scripts, a further ancestor
+      local pattern = string.format('%s/gemini-ide-server-*-%d.json', discovery_dir, server_port)
+      for _, path in ipairs(vim.fn.glob(pattern, false, true)) do
+        if path ~= main_path then
+          table.insert(status_msg, '    [ancestor] ' .. path)
         end
       end
     end
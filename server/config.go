@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envNames lists flags whose environment variable doesn't follow the
+// GEMINI_<FLAG_NAME> pattern
+var envNames = map[string]string{
+	"nvim": "GEMINI_NVIM_ADDR",
+}
+
+// envName returns the environment variable that provides a default for a flag
+func envName(flagName string) string {
+	if name, ok := envNames[flagName]; ok {
+		return name
+	}
+	return "GEMINI_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnvDefaults sets every flag not given on the command line from its
+// environment variable, so flags take precedence over the environment
+func applyEnvDefaults() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok && value != "" {
+			if setErr := flag.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s=%q: %w", envName(f.Name), value, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// usage prints the flags along with their environment variable fallbacks
+func usage() {
+	out := flag.CommandLine.Output()
+	_, _ = fmt.Fprintf(out, "Usage: gemini-mcp-server -nvim=<addr> -workspace=<path> -pid=<pid> [options]\n\n")
+	_, _ = fmt.Fprintf(out, "Each flag can also be set through the environment variable shown;\n")
+	_, _ = fmt.Fprintf(out, "a flag given on the command line takes precedence over the environment.\n\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		_, _ = fmt.Fprintf(out, "  -%s (env %s)\n    \t%s", f.Name, envName(f.Name), f.Usage)
+		if f.DefValue != "" {
+			_, _ = fmt.Fprintf(out, " (default %q)", f.DefValue)
+		}
+		_, _ = fmt.Fprintln(out)
+	})
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// nvimNetwork classifies a -nvim address as "pipe" (Windows named pipe),
+// "tcp" (host:port) or "unix" (socket path)
+func nvimNetwork(addr string) string {
+	if runtime.GOOS == "windows" && (strings.HasPrefix(addr, `\\.\pipe\`) || strings.HasPrefix(addr, `\\?\pipe\`)) {
+		return "pipe"
+	}
+
+	// Only treat it as host:port when the port is numeric and the host isn't a path,
+	// so socket paths (or Windows drive letters) containing ':' still dial as unix
+	host, port, err := net.SplitHostPort(addr)
+	if err == nil && !strings.ContainsAny(host, `/\`) {
+		if _, err := strconv.Atoi(port); err == nil {
+			return "tcp"
+		}
+	}
+
+	return "unix"
+}
+
+// dialNvim connects to Neovim at the given socket path, host:port or named pipe
+func dialNvim(addr string) (io.ReadWriteCloser, error) {
+	network := nvimNetwork(addr)
+	if network == "pipe" {
+		// Named pipes open like regular files on Windows
+		return os.OpenFile(addr, os.O_RDWR, 0)
+	}
+	return net.Dial(network, addr)
+}
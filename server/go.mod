@@ -5,4 +5,5 @@ go 1.21
 require (
 	github.com/google/uuid v1.6.0
 	github.com/neovim/go-client v1.2.1
+	golang.org/x/text v0.14.0
 )
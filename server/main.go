@@ -4,17 +4,20 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -30,21 +33,76 @@ var (
 	nvimAddr      = flag.String("nvim", "", "Neovim address (socket path or host:port)")
 	workspacePath = flag.String("workspace", "", "Workspace path(s), colon-separated")
 	pid           = flag.Int("pid", 0, "Neovim PID")
+	corsOrigin    = flag.String("cors-origin", "*", "Allowed CORS origin for the HTTP endpoints")
+	relativePaths = flag.Bool("relative-paths", false, "Report paths in tool results relative to their workspace root")
+	idleTimeout   = flag.Duration("idle-timeout", 0, "Shut down after this long without SSE clients or tool calls (0 disables)")
+	// Defaults pass gemini-cli's IDE whitelist (Antigravity, VS Code, or VS Code forks)
+	ideName        = flag.String("ide-name", "vscodefork", "IDE name advertised in the discovery file")
+	ideDisplayName = flag.String("ide-display-name", "IDE", "IDE display name advertised in the discovery file")
+	heartbeat      = flag.Duration("heartbeat-interval", 30*time.Second, "Interval between ide/heartbeat notifications (0 disables)")
+	maxDiff        = flag.Int("max-diff-bytes", mcp.DefaultMaxDiffBytes, "Maximum size of a diff's new content in bytes")
+	maxRequest     = flag.Int64("max-request-bytes", mcp.DefaultMaxRequestBytes, "Maximum size of an MCP request body in bytes")
+	sseTimeout     = flag.Duration("sse-write-timeout", mcp.DefaultSSEWriteTimeout, "Disconnect SSE clients whose writes take longer than this")
+	tokenFile      = flag.String("token-file", "", "Reuse the auth token stored in this file across restarts (created with mode 0600 if absent)")
+	requirePlugin  = flag.Bool("require-plugin", false, "Exit at startup if the gemini-cli Lua plugin can't be loaded")
+	enabledTools   = flag.String("tools", "", "Comma-separated tools to enable (default: all)")
+	acceptOnSave   = flag.Bool("accept-on-save", false, "Accept a diff when its buffer is written with :w, whatever the plugin's allow_w_to_accept")
+	notifyLog      = flag.String("notification-log", "", "Append every outgoing notification (redacted) to this file as JSON lines")
+	instructions   = flag.String("instructions", "", "Guidance for the model sent in the initialize result (omitted when empty)")
+	strictCT       = flag.Bool("strict-content-type", false, "Reject MCP POST requests whose Content-Type isn't application/json")
+	discoveryFmt   = flag.String("discovery-format", "current", "Comma-separated discovery file schemes to write: current (gemini-ide-server-<pid>-<port>.json) and/or legacy (gemini-ide-server-<pid>.json, for older Gemini CLI versions)")
+	shutdownGrace  = flag.Duration("shutdown-grace", 5*time.Second, "How long to wait for in-flight requests and SSE streams to finish at shutdown")
+	maxToolCalls   = flag.Int("max-concurrent-tools", mcp.DefaultMaxConcurrentToolCalls, "Maximum number of tool calls run at once; further calls wait for a slot (confirm prompts are not counted)")
+	rejectBusy     = flag.Bool("reject-when-busy", false, "Reject tool calls beyond -max-concurrent-tools with a server busy error instead of queuing them")
+	ancestorDepth  = flag.Int("discovery-ancestor-depth", 3, "How many levels up the process tree to look for the nvim process that also gets a discovery file (0 disables)")
+	readOnly       = flag.Bool("read-only", false, "Refuse tools that modify files or editor state")
+	allowedCmds    = flag.String("allowed-commands", strings.Join(mcp.DefaultAllowedCommands, ","), "Comma-separated Ex commands runCommand may execute (a trailing * matches by prefix)")
+)
+
+// Exit codes for startup validation failures, distinct for scripting
+const (
+	exitMissingFlags  = 2
+	exitInvalidPID    = 3
+	exitInvalidNvim   = 4
+	exitInvalidEnv    = 5
+	exitInvalidTools  = 6
+	exitPluginMissing = 7
+	exitNoWorkspace   = 8
+	exitInvalidFormat = 9
 )
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
-	if *nvimAddr == "" || *workspacePath == "" || *pid == 0 {
-		log.Fatal("Usage: gemini-mcp-server -nvim=<addr> -workspace=<path> -pid=<pid>")
+	if err := applyEnvDefaults(); err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(exitInvalidEnv)
+	}
+
+	if code, err := validateFlags(); err != nil {
+		log.Printf("Error: %v", err)
+		log.Printf("Usage: gemini-mcp-server -nvim=<addr> -workspace=<path> -pid=<pid>")
+		os.Exit(code)
+	}
+
+	workspaceRoots, err := existingWorkspaceRoots(mcp.ParseWorkspaceRoots(*workspacePath))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(exitNoWorkspace)
+	}
+
+	discoveryFormats, err := parseDiscoveryFormats(*discoveryFmt)
+	if err != nil {
+		log.Printf("Error: invalid -discovery-format: %v", err)
+		os.Exit(exitInvalidFormat)
 	}
 
-	// Connect to Neovim via unix socket
-	conn, err := net.Dial("unix", *nvimAddr)
+	// Connect to Neovim via unix socket, TCP or named pipe
+	conn, err := dialNvim(*nvimAddr)
 	if err != nil {
 		log.Fatalf("Failed to connect to Neovim: %v", err)
 	}
-	defer func() { _ = conn.Close() }()
 
 	// Create Neovim client
 	v, err := nvimclient.New(conn, conn, conn, nil)
@@ -52,30 +110,65 @@ func main() {
 		log.Fatalf("Failed to create Neovim client: %v", err)
 	}
 
+	nvimClient := nvim.NewClient(v)
+
 	// Create shutdown channel
 	shutdownChan := make(chan string)
 
-	// Goroutine: Serve Neovim RPC (if connection dies, we shutdown)
+	// Goroutine: Serve Neovim RPC (if connection dies, we shutdown).
+	// Serve returns nil once nvimClient.Close is called during shutdown.
 	go func() {
-		if err := v.Serve(); err != nil {
-			// Silence "use of closed network connection" error during shutdown
-			if !strings.Contains(err.Error(), "use of closed network connection") {
-				log.Printf("Neovim client serve ended with error: %v", err)
-			}
+		if err := nvimClient.Serve(); err != nil {
+			log.Printf("Neovim client serve ended with error: %v", err)
 		} else {
 			log.Printf("Neovim client serve ended")
 		}
 		shutdownChan <- "nvim-connection-closed"
 	}()
 
-	nvimClient := nvim.NewClient(v)
-
-	// Generate auth token
+	// Generate auth token, or reuse the persisted one
 	authToken := uuid.New().String()
+	if *tokenFile != "" {
+		authToken, err = loadOrCreateToken(*tokenFile)
+		if err != nil {
+			log.Fatalf("Failed to load auth token: %v", err)
+		}
+	}
 	log.Printf("Auth token: %s", authToken)
 
+	// Mirror notifications to a file for debugging
+	var notificationLog io.Writer
+	if *notifyLog != "" {
+		file, err := os.OpenFile(*notifyLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			log.Fatalf("Failed to open notification log: %v", err)
+		}
+		defer func() { _ = file.Close() }()
+		notificationLog = file
+	}
+
 	// Create MCP server
-	mcpServer := mcp.NewServer(authToken, nvimClient)
+	mcpServer, err := mcp.NewServer(authToken, nvimClient, mcp.Config{
+		CORSOrigin:             *corsOrigin,
+		WorkspaceRoots:         workspaceRoots,
+		RelativePaths:          *relativePaths,
+		ReadOnly:               *readOnly,
+		MaxRequestBytes:        *maxRequest,
+		MaxDiffBytes:           *maxDiff,
+		SSEWriteTimeout:        *sseTimeout,
+		AllowedCommands:        splitList(*allowedCmds),
+		EnabledTools:           splitList(*enabledTools),
+		Instructions:           *instructions,
+		NotificationLog:        notificationLog,
+		AcceptOnSave:           *acceptOnSave,
+		StrictContentType:      *strictCT,
+		MaxConcurrentToolCalls: *maxToolCalls,
+		RejectWhenBusy:         *rejectBusy,
+	})
+	if err != nil {
+		log.Printf("Error: invalid -tools: %v", err)
+		os.Exit(exitInvalidTools)
+	}
 
 	// Register callbacks for Neovim notifications
 	err = nvimClient.RegisterCallbacks(
@@ -92,15 +185,17 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to register callbacks: %v", err)
 	}
+	if err := nvimClient.RegisterBufferChangeHandler(mcpServer.HandleBufferChanged); err != nil {
+		log.Fatalf("Failed to register buffer change handler: %v", err)
+	}
 
 	// Create HTTP server on random port
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	listener, port, err := listen()
 	if err != nil {
 		log.Fatalf("Failed to create listener: %v", err)
 	}
 	// We don't defer listener.Close() because http.Serve closes it, or we rely on Shutdown
 
-	port := listener.Addr().(*net.TCPAddr).Port
 	log.Printf("MCP server listening on port %d", port)
 
 	// Notify Neovim that server is ready via RPC
@@ -108,8 +203,22 @@ func main() {
 		log.Printf("Warning: failed to notify Neovim: %v", err)
 	}
 
+	// Catch a missing or partial plugin install now instead of on the first tool call
+	if missing, err := nvimClient.CheckPlugin(); err != nil || len(missing) > 0 {
+		if err == nil {
+			err = fmt.Errorf("cannot load Lua modules %s", strings.Join(missing, ", "))
+		}
+		log.Printf("Error: the gemini-cli Neovim plugin is not usable: %v", err)
+		log.Printf("Make sure the plugin is installed and on Neovim's runtimepath")
+		if *requirePlugin {
+			os.Exit(exitPluginMissing)
+		}
+	}
+
 	// Create discovery file
-	if err := createDiscoveryFile(*pid, port, *workspacePath, authToken); err != nil {
+	ideInfo := types.IdeInfo{Name: *ideName, DisplayName: *ideDisplayName}
+	discoveryDir, err := createDiscoveryFile(discoveryFormats, *pid, port, *workspacePath, authToken, ideInfo)
+	if err != nil {
 		log.Fatalf("Failed to create discovery file: %v", err)
 	}
 	// We handle removal manually on shutdown
@@ -117,22 +226,27 @@ func main() {
 	// Set up HTTP handlers
 	http.HandleFunc("/mcp", mcpServer.AuthMiddleware(mcpServer.HandleMCP))
 	http.HandleFunc("/events", mcpServer.HandleSSE) // Auth handled internally
+	http.HandleFunc("/events/history", mcpServer.AuthMiddleware(mcpServer.HandleEventHistory))
 	http.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("OK"))
 	})
 
-	// Goroutine: Monitor Parent PID (Double safety for :qa)
-	go func() {
-		ticker := time.NewTicker(2 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			if !isProcessAlive(*pid) {
-				shutdownChan <- "parent-process-dead"
-				return
-			}
-		}
-	}()
+	// Goroutine: Send liveness heartbeats to SSE subscribers
+	go mcpServer.RunHeartbeat(*heartbeat)
+
+	// Goroutine: Log SSE and event history memory at DEBUG
+	go mcpServer.RunJanitor(time.Minute)
+
+	// Goroutine: Shut down when no client has used the server for a while
+	go mcpServer.RunIdleTimeout(*idleTimeout, func() {
+		shutdownChan <- "idle-timeout"
+	})
+
+	// Goroutine: Monitor Parent PID and RPC keepalive (Double safety for :qa)
+	go monitorParent(*pid, nvimClient.Ping, func(reason string) {
+		shutdownChan <- reason
+	})
 
 	// Goroutine: Handle OS Signals (SIGINT, SIGTERM)
 	go func() {
@@ -147,9 +261,33 @@ func main() {
 		Handler: nil, // Use DefaultServeMux
 	}
 
-	// Goroutine: Start HTTP server
+	// Goroutine: Start HTTP server, moving to a new port if the listener fails.
+	// discoveryMu guards port and discoveryDir, which change when it does,
+	// and shuttingDown, which stops a late restart from recreating the
+	// discovery file after shutdown has removed it.
+	var discoveryMu sync.Mutex
+	shuttingDown := false
 	go func() {
-		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+		err := serveHTTP(httpServer, listener, func(newPort int) {
+			discoveryMu.Lock()
+			defer discoveryMu.Unlock()
+			if shuttingDown {
+				return
+			}
+
+			removeDiscoveryFile(discoveryFormats, discoveryDir, *pid, port)
+			removeLatestDiscoveryFile(discoveryDir, port, authToken)
+			port = newPort
+			if dir, err := createDiscoveryFile(discoveryFormats, *pid, port, *workspacePath, authToken, ideInfo); err != nil {
+				log.Printf("Warning: failed to update discovery file: %v", err)
+			} else {
+				discoveryDir = dir
+			}
+			if err := nvimClient.NotifyReady(port, authToken, *workspacePath); err != nil {
+				log.Printf("Warning: failed to notify Neovim: %v", err)
+			}
+		})
+		if err != nil {
 			log.Printf("HTTP server error: %v", err)
 			shutdownChan <- "http-server-error"
 		}
@@ -158,20 +296,93 @@ func main() {
 	// Wait for any shutdown signal
 	reason := <-shutdownChan
 	log.Printf("Shutting down (reason: %s)...", reason)
+	discoveryMu.Lock()
+	shuttingDown = true
+	discoveryMu.Unlock()
+
+	// Tell SSE clients first so their streams end before the grace period starts
+	mcpServer.SendShutdown(reason)
 
 	// Perform Cleanup
-	cleanupCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), *shutdownGrace)
 	defer cancel()
 
 	if err := httpServer.Shutdown(cleanupCtx); err != nil {
 		log.Printf("HTTP server shutdown error: %v", err)
 	}
 
+	if err := mcpServer.RestoreDiagnosticsDisplay(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	if err := nvimClient.Close(); err != nil {
+		log.Printf("Warning: failed to close Neovim connection: %v", err)
+	}
+
 	// Manually call removeDiscoveryFile
-	removeDiscoveryFile(*pid, port, *workspacePath)
+	discoveryMu.Lock()
+	removeDiscoveryFile(discoveryFormats, discoveryDir, *pid, port)
+	removeLatestDiscoveryFile(discoveryDir, port, authToken)
+	discoveryMu.Unlock()
 	log.Println("Server shutdown complete")
 }
 
+// validateFlags checks the required flags, returning the exit code to use on failure
+func validateFlags() (int, error) {
+	var missing []string
+	if *nvimAddr == "" {
+		missing = append(missing, "-nvim")
+	}
+	if *workspacePath == "" {
+		missing = append(missing, "-workspace")
+	}
+	if *pid == 0 {
+		missing = append(missing, "-pid")
+	}
+	if len(missing) > 0 {
+		return exitMissingFlags, fmt.Errorf("missing required flags: %s", strings.Join(missing, ", "))
+	}
+
+	if *pid < 0 || !isProcessAlive(*pid) {
+		return exitInvalidPID, fmt.Errorf("-pid %d does not refer to a running process", *pid)
+	}
+
+	if nvimNetwork(*nvimAddr) == "unix" {
+		info, err := os.Stat(*nvimAddr)
+		if err != nil {
+			return exitInvalidNvim, fmt.Errorf("-nvim socket %s: %w", *nvimAddr, err)
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return exitInvalidNvim, fmt.Errorf("-nvim %s is not a socket", *nvimAddr)
+		}
+	}
+
+	return 0, nil
+}
+
+// existingWorkspaceRoots returns the roots that are existing directories,
+// warning about the others. It fails only when none of them is usable, so a
+// typo in one root of several doesn't stop the server.
+func existingWorkspaceRoots(roots []string) ([]string, error) {
+	var existing []string
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			log.Printf("Warning: ignoring workspace root %s: %v", root, err)
+			continue
+		}
+		if !info.IsDir() {
+			log.Printf("Warning: ignoring workspace root %s: not a directory", root)
+			continue
+		}
+		existing = append(existing, root)
+	}
+	if len(existing) == 0 {
+		return nil, fmt.Errorf("no workspace root exists: %s", strings.Join(roots, ", "))
+	}
+	return existing, nil
+}
+
 // isProcessAlive checks if a process with the given PID is running
 func isProcessAlive(pid int) bool {
 	proc, err := os.FindProcess(pid)
@@ -183,80 +394,111 @@ func isProcessAlive(pid int) bool {
 	if err == nil {
 		return true
 	}
-	if err == syscall.ESRCH {
+	if err == syscall.ESRCH || errors.Is(err, os.ErrProcessDone) {
 		return false
 	}
 	// EPERM means it exists but we can't signal it (still alive)
 	return true
 }
 
-func createDiscoveryFile(pid, port int, workspacePath, authToken string) error {
-	// Create directory
-	tmpDir := os.TempDir()
-	geminiDir := filepath.Join(tmpDir, "gemini", "ide")
-	if err := os.MkdirAll(geminiDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-
+func createDiscoveryFile(formats []discoveryFormat, pid, port int, workspacePath, authToken string, ideInfo types.IdeInfo) (string, error) {
 	discovery := types.DiscoveryFile{
 		Port:          port,
 		WorkspacePath: workspacePath,
 		AuthToken:     authToken,
-		IdeInfo: types.IdeInfo{
-			// Try "vscodefork" to pass gemini-cli's whitelist check
-			// (gemini-cli accepts: Antigravity, VS Code, or VS Code forks)
-			Name:        "vscodefork",
-			DisplayName: "IDE",
-		},
+		IdeInfo:       ideInfo,
 	}
 
 	data, err := json.MarshalIndent(discovery, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal discovery file: %w", err)
+		return "", fmt.Errorf("failed to marshal discovery file: %w", err)
 	}
 
-	// Create discovery file for main PID
-	mainFilename := fmt.Sprintf("gemini-ide-server-%d-%d.json", pid, port)
-	mainFilepath := filepath.Join(geminiDir, mainFilename)
+	// Create discovery files for main PID
+	geminiDir := ideDiscoveryDir()
+	if err := writeDiscoveryFiles(formats, geminiDir, pid, port, data); err != nil {
+		return "", fmt.Errorf("failed to write discovery file: %w", err)
+	}
 
-	if err := os.WriteFile(mainFilepath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write discovery file: %w", err)
+	// Stable fallback for clients that don't scan the per-PID files
+	latestPath := filepath.Join(geminiDir, latestDiscoveryFilename)
+	if err := writeFileAtomic(latestPath, data, 0644); err != nil {
+		log.Printf("Warning: failed to write discovery file %s: %v", latestPath, err)
+	} else {
+		log.Printf("Updated discovery file: %s", latestPath)
 	}
-	log.Printf("Created discovery file: %s", mainFilepath)
 
-	// Also create discovery file for parent process if it's a nvim process
+	// Also create discovery files for the nvim process that launched us.
 	// When Neovim is run directly, vim.fn.getpid() may return nvim --embed PID,
-	// but gemini-cli finds the parent nvim PID. We need files for both.
-	parentPid := getParentPid(pid)
-	log.Printf("Debug: Current PID=%d, Parent PID=%d", pid, parentPid)
-
-	if parentPid > 0 {
-		log.Printf("Debug: parentPid > 0: true")
-		if parentPid != pid {
-			log.Printf("Debug: parentPid != pid: true")
-			isNvim := isNvimProcess(parentPid)
-			log.Printf("Debug: isNvimProcess(%d) = %v", parentPid, isNvim)
-
-			if isNvim {
-				parentFilename := fmt.Sprintf("gemini-ide-server-%d-%d.json", parentPid, port)
-				parentFilepath := filepath.Join(geminiDir, parentFilename)
-
-				if err := os.WriteFile(parentFilepath, data, 0644); err != nil {
-					log.Printf("Warning: failed to create discovery file for parent PID %d: %v", parentPid, err)
-				} else {
-					log.Printf("Created discovery file for parent process: %s (PID %d)", parentFilepath, parentPid)
-				}
+	// but gemini-cli finds the parent nvim PID; wrapper scripts can sit in
+	// between as well. We need files for both.
+	if ancestorPid := nvimAncestor(pid); ancestorPid > 0 {
+		for _, format := range formats {
+			ancestorPath := format.path(geminiDir, ancestorPid, port)
+			if err := writeFileAtomic(ancestorPath, data, 0644); err != nil {
+				log.Printf("Warning: failed to create discovery file for ancestor PID %d: %v", ancestorPid, err)
 			} else {
-				log.Printf("Debug: Skipping parent discovery file - parent is not a nvim process")
+				log.Printf("Created discovery file for ancestor nvim process: %s (PID %d)", ancestorPath, ancestorPid)
 			}
-		} else {
-			log.Printf("Debug: Skipping parent discovery file - parentPid == pid")
 		}
-	} else {
-		log.Printf("Debug: Skipping parent discovery file - parentPid <= 0")
 	}
 
-	return nil
+	return geminiDir, nil
+}
+
+// parseStatPPID returns the parent PID from the contents of /proc/<pid>/stat,
+// or 0 when it can't be parsed or the process is a zombie or dead, whose
+// parent PID may be stale
+func parseStatPPID(stat string) int {
+	// The command name is in parentheses and may itself contain ")" or spaces,
+	// so the fields start after the last ")"
+	lastParen := strings.LastIndexByte(stat, ')')
+	if lastParen == -1 {
+		return 0
+	}
+
+	// "<state> <ppid> ..."
+	fields := strings.Fields(stat[lastParen+1:])
+	if len(fields) < 2 {
+		return 0
+	}
+	switch fields[0] {
+	case "Z", "X", "x":
+		return 0
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil || ppid < 0 {
+		return 0
+	}
+	return ppid
+}
+
+// nvimAncestor returns the closest nvim process above pid, looking at most
+// -discovery-ancestor-depth levels up, or 0 if there is none
+func nvimAncestor(pid int) int {
+	return findNvimAncestor(pid, *ancestorDepth, getParentPid, isNvimProcess)
+}
+
+// findNvimAncestor walks up to depth levels of the process tree from pid and
+// returns the first ancestor isNvim accepts, or 0. It stops at a PID it has
+// already seen, as some launchers report a process as its own parent.
+func findNvimAncestor(pid, depth int, parentOf func(int) int, isNvim func(int) bool) int {
+	seen := map[int]bool{pid: true}
+	for level := 1; level <= depth; level++ {
+		parent := parentOf(pid)
+		if parent <= 0 || seen[parent] {
+			log.Printf("Debug: No nvim ancestor above PID %d (parent %d)", pid, parent)
+			return 0
+		}
+		seen[parent] = true
+		if isNvim(parent) {
+			log.Printf("Debug: Found nvim ancestor PID %d, %d level(s) up", parent, level)
+			return parent
+		}
+		pid = parent
+	}
+	return 0
 }
 
 // getParentPid gets the parent PID of the given process
@@ -268,27 +510,7 @@ func getParentPid(pid int) int {
 			return 0
 		}
 
-		// Parse stat file to get PPID
-		statStr := string(statData)
-		lastParen := -1
-		for i := len(statStr) - 1; i >= 0; i-- {
-			if statStr[i] == ')' {
-				lastParen = i
-				break
-			}
-		}
-		if lastParen == -1 {
-			return 0
-		}
-
-		fields := strings.Fields(statStr[lastParen+1:])
-		if len(fields) < 2 {
-			return 0
-		}
-
-		var ppid int
-		_, _ = fmt.Sscanf(fields[1], "%d", &ppid)
-		return ppid
+		return parseStatPPID(string(statData))
 	} else if runtime.GOOS == "darwin" {
 		// macOS: use ps command
 		cmd := fmt.Sprintf("ps -o ppid= -p %d", pid)
@@ -332,30 +554,163 @@ func isNvimProcess(pid int) bool {
 	return false
 }
 
-func removeDiscoveryFile(pid, port int, _ string) {
-	tmpDir := os.TempDir()
-	geminiDir := filepath.Join(tmpDir, "gemini", "ide")
+// removeDiscoveryFile removes the discovery files createDiscoveryFile wrote to geminiDir
+func removeDiscoveryFile(formats []discoveryFormat, geminiDir string, pid, port int) {
+	// Remove main PID discovery files
+	for _, format := range formats {
+		mainPath := format.path(geminiDir, pid, port)
+		if err := os.Remove(mainPath); err != nil {
+			log.Printf("Warning: failed to remove discovery file: %v", err)
+		} else {
+			log.Printf("Removed discovery file: %s", mainPath)
+		}
+	}
 
-	// Remove main PID discovery file
-	mainFilename := fmt.Sprintf("gemini-ide-server-%d-%d.json", pid, port)
-	mainPath := filepath.Join(geminiDir, mainFilename)
+	// Remove the ancestor nvim process's discovery files
+	if ancestorPid := nvimAncestor(pid); ancestorPid > 0 {
+		for _, format := range formats {
+			ancestorPath := format.path(geminiDir, ancestorPid, port)
+			if err := os.Remove(ancestorPath); err != nil {
+				log.Printf("Warning: failed to remove ancestor discovery file (PID %d): %v", ancestorPid, err)
+			} else {
+				log.Printf("Removed ancestor discovery file: %s (PID %d)", ancestorPath, ancestorPid)
+			}
+		}
+	}
+}
 
-	if err := os.Remove(mainPath); err != nil {
-		log.Printf("Warning: failed to remove discovery file: %v", err)
-	} else {
-		log.Printf("Removed discovery file: %s", mainPath)
+// discoveryFormat is a discovery file naming scheme; different Gemini CLI
+// versions look for different ones
+type discoveryFormat string
+
+const (
+	// discoveryFormatCurrent is gemini-ide-server-<pid>-<port>.json in the
+	// discovery directory
+	discoveryFormatCurrent discoveryFormat = "current"
+	// discoveryFormatLegacy is gemini-ide-server-<pid>.json directly in the
+	// temp directory, where older Gemini CLI versions look
+	discoveryFormatLegacy discoveryFormat = "legacy"
+)
+
+// parseDiscoveryFormats parses the comma-separated -discovery-format value
+func parseDiscoveryFormats(value string) ([]discoveryFormat, error) {
+	var formats []discoveryFormat
+	seen := make(map[discoveryFormat]bool)
+	for _, name := range splitList(value) {
+		format := discoveryFormat(name)
+		if format != discoveryFormatCurrent && format != discoveryFormatLegacy {
+			return nil, fmt.Errorf("unknown format %q (want current or legacy)", name)
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
 	}
+	if len(formats) == 0 {
+		return nil, errors.New("no format given")
+	}
+	return formats, nil
+}
 
-	// Remove parent PID discovery file if it's a nvim process
-	parentPid := getParentPid(pid)
-	if parentPid > 0 && parentPid != pid && isNvimProcess(parentPid) {
-		parentFilename := fmt.Sprintf("gemini-ide-server-%d-%d.json", parentPid, port)
-		parentPath := filepath.Join(geminiDir, parentFilename)
+// path returns where the discovery file of this format goes for pid
+func (f discoveryFormat) path(geminiDir string, pid, port int) string {
+	if f == discoveryFormatLegacy {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("gemini-ide-server-%d.json", pid))
+	}
+	return filepath.Join(geminiDir, fmt.Sprintf("gemini-ide-server-%d-%d.json", pid, port))
+}
 
-		if err := os.Remove(parentPath); err != nil {
-			log.Printf("Warning: failed to remove parent discovery file (PID %d): %v", parentPid, err)
-		} else {
-			log.Printf("Removed parent discovery file: %s (PID %d)", parentPath, parentPid)
+// writeDiscoveryFiles writes data to the discovery file of each format for
+// pid, with current-format files going to dir
+func writeDiscoveryFiles(formats []discoveryFormat, dir string, pid, port int, data []byte) error {
+	for _, format := range formats {
+		path := format.path(dir, pid, port)
+		if err := writeDiscoveryFile(path, data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		log.Printf("Created discovery file: %s", path)
+	}
+	return nil
+}
+
+// latestDiscoveryFilename names the discovery file that always points at the
+// most recently started server
+const latestDiscoveryFilename = "gemini-ide-server-latest.json"
+
+// Retry policy for discovery file writes, which can fail transiently
+const (
+	discoveryWriteAttempts       = 3
+	discoveryWriteInitialBackoff = 100 * time.Millisecond
+)
+
+// ideDiscoveryDir returns the directory Gemini CLI scans for discovery files.
+// It only looks in the temp directory, so there is no point writing elsewhere.
+func ideDiscoveryDir() string {
+	return filepath.Join(os.TempDir(), "gemini", "ide")
+}
+
+// writeDiscoveryFile creates the directory of path and writes data to it,
+// retrying with exponential backoff
+func writeDiscoveryFile(path string, data []byte) error {
+	backoff := discoveryWriteInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = writeFileAtomic(path, data, 0644)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt == discoveryWriteAttempts {
+			return fmt.Errorf("after %d attempts: %w", attempt, err)
 		}
+
+		log.Printf("Debug: discovery file write attempt %d failed, retrying in %v: %v", attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeLatestDiscoveryFile removes the latest discovery file, unless a newer
+// server has replaced it in the meantime
+func removeLatestDiscoveryFile(geminiDir string, port int, authToken string) {
+	latestPath := filepath.Join(geminiDir, latestDiscoveryFilename)
+
+	data, err := os.ReadFile(latestPath)
+	if err != nil {
+		return
+	}
+	var discovery types.DiscoveryFile
+	if err := json.Unmarshal(data, &discovery); err != nil || discovery.Port != port || discovery.AuthToken != authToken {
+		return
+	}
+
+	if err := os.Remove(latestPath); err != nil {
+		log.Printf("Warning: failed to remove discovery file: %v", err)
+	} else {
+		log.Printf("Removed discovery file: %s", latestPath)
 	}
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseStatPPID(t *testing.T) {
+	tests := []struct {
+		name string
+		stat string
+		want int
+	}{
+		{name: "running", stat: "1234 (nvim) S 1200 1234 1200 0 -1 4194560", want: 1200},
+		{name: "name with spaces", stat: "1234 (my editor) R 42 1234", want: 42},
+		{name: "name with parentheses", stat: "1234 (a) b) (c)) S 77 1234", want: 77},
+		{name: "zombie", stat: "1234 (nvim) Z 1200 1234", want: 0},
+		{name: "dead", stat: "1234 (nvim) X 1200 1234", want: 0},
+		{name: "no command", stat: "1234 nvim S 1200", want: 0},
+		{name: "truncated", stat: "1234 (nvim) S", want: 0},
+		{name: "bad ppid", stat: "1234 (nvim) S abc", want: 0},
+		{name: "empty", stat: "", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseStatPPID(tt.stat); got != tt.want {
+				t.Errorf("parseStatPPID(%q) = %d, want %d", tt.stat, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExistingWorkspaceRoots(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	roots, err := existingWorkspaceRoots([]string{missing, dir, file})
+	if err != nil || !reflect.DeepEqual(roots, []string{dir}) {
+		t.Errorf("existingWorkspaceRoots() = %v, %v; want [%s]", roots, err, dir)
+	}
+
+	if _, err := existingWorkspaceRoots([]string{missing, file}); err == nil {
+		t.Errorf("existingWorkspaceRoots(%v) error = nil, want an error when no root exists", []string{missing, file})
+	}
+}
+
+func TestParseDiscoveryFormats(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []discoveryFormat
+		wantErr bool
+	}{
+		{value: "current", want: []discoveryFormat{discoveryFormatCurrent}},
+		{value: "legacy, current,legacy", want: []discoveryFormat{discoveryFormatLegacy, discoveryFormatCurrent}},
+		{value: "", wantErr: true},
+		{value: "current,v2", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDiscoveryFormats(tt.value)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDiscoveryFormats(%q) = %v, %v; want %v (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDiscoveryFilesAllFormats(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	dir := filepath.Join(tmp, "gemini", "ide")
+	formats := []discoveryFormat{discoveryFormatCurrent, discoveryFormatLegacy}
+	const pid, port = 999999999, 4242
+
+	if err := writeDiscoveryFiles(formats, dir, pid, port, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{
+		filepath.Join(dir, "gemini-ide-server-999999999-4242.json"),
+		filepath.Join(tmp, "gemini-ide-server-999999999.json"),
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("writeDiscoveryFiles() did not create %s: %v", path, err)
+		}
+	}
+
+	removeDiscoveryFile(formats, dir, pid, port)
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("removeDiscoveryFile() stat %s = %v, want not exist", path, err)
+		}
+	}
+}
+
+func TestFindNvimAncestor(t *testing.T) {
+	// 100 -> 50 (wrapper) -> 20 (wrapper) -> 10 (nvim) -> 1
+	parents := map[int]int{100: 50, 50: 20, 20: 10, 10: 1, 7: 7, 8: 9, 9: 8}
+	parentOf := func(pid int) int { return parents[pid] }
+	isNvim := func(pid int) bool { return pid == 10 }
+
+	tests := []struct {
+		name       string
+		pid, depth int
+		want       int
+	}{
+		{"found within depth", 100, 3, 10},
+		{"beyond depth", 100, 2, 0},
+		{"disabled", 20, 0, 0},
+		{"direct parent", 20, 1, 10},
+		{"own parent", 7, 3, 0},
+		{"cycle", 8, 10, 0},
+		{"no parent", 1, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findNvimAncestor(tt.pid, tt.depth, parentOf, isNvim); got != tt.want {
+				t.Errorf("findNvimAncestor(%d, %d) = %d, want %d", tt.pid, tt.depth, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+const (
+	// defaultContextRadius is the number of lines returned on each side of the cursor
+	defaultContextRadius = 50
+	// maxOpenFilesContentBytes is the total content budget for getOpenFilesContent
+	maxOpenFilesContentBytes = 256 * 1024
+	// maxRangeLines caps the number of lines readFileRange returns
+	maxRangeLines = 2000
+	// maxLineBytes is the longest line readFileRange reads from disk
+	maxLineBytes = 1024 * 1024
+)
+
+// handleGetContextWindow handles the getContextWindow tool call
+func (s *Server) handleGetContextWindow(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok {
+		return errorResult("Invalid filePath"), nil
+	}
+
+	radius, ok := intArg(args, "radius", defaultContextRadius)
+	if !ok || radius < 0 {
+		return errorResult("Invalid radius"), nil
+	}
+
+	window, err := s.nvimClient.GetContextWindow(filePath, radius)
+	if errors.Is(err, nvim.ErrBufferNotOpen) {
+		return codedErrorResult(types.ErrorCodeNotFound, "File is not open in Neovim: %s", filePath), nil
+	}
+	if err != nil {
+		return errorResult("Failed to get context window: %v", err), nil
+	}
+	window.Path = s.displayPath(window.Path)
+
+	return jsonResult(window)
+}
+
+// handleReadFileRange handles the readFileRange tool call. Lines come from
+// the file's buffer when it is open, so unsaved edits are included, and
+// otherwise from disk, decoded from the given encoding. Neovim has already
+// decoded a buffer using its 'fileencoding', which is reported instead.
+func (s *Server) handleReadFileRange(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+	startLine, ok := intArg(args, "startLine", 1)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid startLine"), nil
+	}
+	endLine, ok := intArg(args, "endLine", 0)
+	if !ok || endLine < 1 || endLine < startLine {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid endLine"), nil
+	}
+	if endLine-startLine >= maxRangeLines {
+		endLine = startLine + maxRangeLines - 1
+	}
+	encodingName, _ := args["encoding"].(string)
+	var enc encoding.Encoding
+	if encodingName != "" {
+		var err error
+		if enc, err = lookupEncoding(encodingName); err != nil {
+			return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid encoding: %v", err), nil
+		}
+	}
+
+	// The hash lets the caller skip rereading a file it already has
+	hash, _, err := s.currentFileHash(filePath)
+	if err != nil {
+		return hashError(filePath, err), nil
+	}
+	if ifChangedFrom, _ := args["ifChangedFrom"].(string); ifChangedFrom != "" && strings.EqualFold(ifChangedFrom, hash) {
+		return jsonResult(map[string]interface{}{
+			"path":      s.displayPath(filePath),
+			"sha256":    hash,
+			"unchanged": true,
+		})
+	}
+
+	fileRange, err := s.nvimClient.GetBufferRange(filePath, startLine, endLine)
+	switch {
+	case err == nil:
+		fileRange.Source = "buffer"
+	case errors.Is(err, nvim.ErrBufferNotOpen):
+		if _, ok := s.workspaceRootFor(filePath); !ok {
+			return codedErrorResult(types.ErrorCodeOutOfWorkspace, "File is not open and is outside the workspace: %s", filePath), nil
+		}
+		fileRange, err = readLineRange(filePath, startLine, endLine, enc)
+		if errors.Is(err, fs.ErrNotExist) {
+			return codedErrorResult(types.ErrorCodeNotFound, "File not found: %s", filePath), nil
+		}
+		if err != nil {
+			return errorResult("Failed to read file: %v", err), nil
+		}
+		fileRange.Encoding = "utf-8"
+		if enc != nil {
+			fileRange.Encoding = encodingName
+		}
+	default:
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to read buffer: %v", err), nil
+	}
+
+	if fileRange.Lines == nil {
+		fileRange.Lines = []types.NumberedLine{}
+	}
+	fileRange.Path = s.displayPath(fileRange.Path)
+	fileRange.Sha256 = hash
+	return jsonResult(fileRange)
+}
+
+// readLineRange reads lines startLine to endLine (1-based, inclusive) of a
+// file on disk, clamped to the file's bounds. A non-nil enc decodes the file
+// into UTF-8.
+func readLineRange(filePath string, startLine, endLine int, enc encoding.Encoding) (*types.FileRange, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var reader io.Reader = file
+	if enc != nil {
+		reader = transform.NewReader(file, enc.NewDecoder())
+	}
+
+	if startLine < 1 {
+		startLine = 1
+	}
+	fileRange := &types.FileRange{Path: filePath, StartLine: startLine, Source: "disk"}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		fileRange.TotalLines++
+		if n := fileRange.TotalLines; n >= startLine && n <= endLine {
+			text := strings.TrimSuffix(scanner.Text(), "\r")
+			fileRange.Lines = append(fileRange.Lines, types.NumberedLine{Line: n, Text: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	fileRange.EndLine = endLine
+	if fileRange.EndLine > fileRange.TotalLines {
+		fileRange.EndLine = fileRange.TotalLines
+	}
+	return fileRange, nil
+}
+
+// handleGetActiveBuffer handles the getActiveBuffer tool call
+func (s *Server) handleGetActiveBuffer(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	buffer, err := s.nvimClient.GetActiveBuffer()
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get active buffer: %v", err), nil
+	}
+	if buffer.Path != "" {
+		buffer.Path = s.displayPath(buffer.Path)
+	}
+	return jsonResult(buffer)
+}
+
+// handleSetActiveBuffer handles the setActiveBuffer tool call
+func (s *Server) handleSetActiveBuffer(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+
+	buffer, err := s.nvimClient.SetActiveBuffer(filePath)
+	if errors.Is(err, nvim.ErrBufferNotOpen) {
+		return codedErrorResult(types.ErrorCodeNotFound, "File is not open in Neovim: %s", filePath), nil
+	}
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to set active buffer: %v", err), nil
+	}
+	buffer.Path = s.displayPath(buffer.Path)
+	return jsonResult(buffer)
+}
+
+// handleGetOpenFilesContent handles the getOpenFilesContent tool call
+func (s *Server) handleGetOpenFilesContent(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePaths, ok := stringSliceArg(args, "filePaths")
+	if !ok {
+		return errorResult("Invalid filePaths"), nil
+	}
+
+	contents, err := s.nvimClient.GetBufferContents(filePaths)
+	if err != nil {
+		return errorResult("Failed to read open files: %v", err), nil
+	}
+
+	// Share the byte budget across all files in order; once it runs out,
+	// later files are returned empty and marked truncated
+	budget := maxOpenFilesContentBytes
+	for i := range contents {
+		contents[i].Path = s.displayPath(contents[i].Path)
+		if len(contents[i].Content) > budget {
+			contents[i].Content = truncateUTF8(contents[i].Content, budget)
+			contents[i].Truncated = true
+		}
+		budget -= len(contents[i].Content)
+	}
+
+	if contents == nil {
+		contents = []types.FileContent{}
+	}
+	return jsonResult(contents)
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a multi-byte rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
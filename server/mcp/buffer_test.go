@@ -0,0 +1,220 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleReadFileRangeFromDisk(t *testing.T) {
+	root := t.TempDir()
+	filePath := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(filePath, []byte("one\r\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake leaves the result nil, as Lua does for a file that isn't open
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			return nil
+		}),
+	}
+
+	result, err := s.handleReadFileRange(map[string]interface{}{"filePath": filePath, "startLine": float64(1), "endLine": float64(10)})
+	if err != nil || result.IsError {
+		t.Fatalf("handleReadFileRange failed: %v %+v", err, result)
+	}
+	var fileRange types.FileRange
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &fileRange); err != nil {
+		t.Fatal(err)
+	}
+	if fileRange.Source != "disk" || fileRange.StartLine != 1 || fileRange.EndLine != 3 || fileRange.TotalLines != 3 {
+		t.Errorf("handleReadFileRange() = %+v, want lines 1-3 of 3 from disk", fileRange)
+	}
+	if len(fileRange.Lines) != 3 || fileRange.Lines[0].Text != "one" || fileRange.Lines[2].Line != 3 {
+		t.Errorf("handleReadFileRange() lines = %+v, want one..three numbered from 1", fileRange.Lines)
+	}
+
+	outside := filepath.Join(t.TempDir(), "b.txt")
+	result, _ = s.handleReadFileRange(map[string]interface{}{"filePath": outside, "startLine": float64(1), "endLine": float64(1)})
+	if result.Code != types.ErrorCodeOutOfWorkspace {
+		t.Errorf("handleReadFileRange(%s) code = %q, want %q", outside, result.Code, types.ErrorCodeOutOfWorkspace)
+	}
+}
+
+func TestHandleReadFileRangeSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	real := t.TempDir()
+	if err := os.WriteFile(filepath.Join(real, "a.txt"), []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The workspace root is itself reached through a link, which is fine
+	root := filepath.Join(t.TempDir(), "work")
+	for link, target := range map[string]string{
+		root:                            real,
+		filepath.Join(real, "file.txt"): secret,
+		filepath.Join(real, "dir"):      outside,
+		filepath.Join(real, "dangling"): filepath.Join(outside, "new.txt"),
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			return nil
+		}),
+	}
+	read := func(path string) *types.ToolCallResult {
+		result, err := s.handleReadFileRange(map[string]interface{}{"filePath": path, "startLine": float64(1), "endLine": float64(1)})
+		if err != nil {
+			t.Fatalf("handleReadFileRange(%s) failed: %v", path, err)
+		}
+		return result
+	}
+
+	if result := read(filepath.Join(root, "a.txt")); result.IsError {
+		t.Errorf("handleReadFileRange() under a linked root = %+v, want success", result)
+	}
+	for _, path := range []string{
+		filepath.Join(root, "file.txt"),
+		filepath.Join(root, "dir", "secret.txt"),
+		filepath.Join(root, "dir", "missing.txt"),
+		filepath.Join(root, "dangling"),
+	} {
+		if result := read(path); result.Code != types.ErrorCodeOutOfWorkspace {
+			t.Errorf("handleReadFileRange(%s) = %+v, want code %q", path, result, types.ErrorCodeOutOfWorkspace)
+		}
+	}
+	if _, ok := s.workspaceRootFor(filepath.Join(root, "new", "file.txt")); !ok {
+		t.Errorf("workspaceRootFor() for a file that doesn't exist yet = false, want true")
+	}
+}
+
+func TestHandleReadFileRangeIfChangedFrom(t *testing.T) {
+	root := t.TempDir()
+	filePath := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(filePath, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			return nil
+		}),
+	}
+	read := func(ifChangedFrom string) map[string]interface{} {
+		result, err := s.handleReadFileRange(map[string]interface{}{
+			"filePath": filePath, "startLine": float64(1), "endLine": float64(10), "ifChangedFrom": ifChangedFrom,
+		})
+		if err != nil || result.IsError {
+			t.Fatalf("handleReadFileRange failed: %v %+v", err, result)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	first := read("")
+	hash, _ := first["sha256"].(string)
+	if hash != contentHash("one\ntwo\n") || first["lines"] == nil {
+		t.Fatalf("handleReadFileRange() = %v, want lines and the getFileHash hash", first)
+	}
+
+	if got := read(hash); got["unchanged"] != true || got["lines"] != nil {
+		t.Errorf("handleReadFileRange(ifChangedFrom) = %v, want unchanged without lines", got)
+	}
+
+	if err := os.WriteFile(filePath, []byte("one\n2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(hash); got["unchanged"] != nil || got["lines"] == nil || got["sha256"] == hash {
+		t.Errorf("handleReadFileRange(ifChangedFrom) after a change = %v, want fresh lines and hash", got)
+	}
+}
+
+func TestHandleGetFileHashAndStaleDiff(t *testing.T) {
+	root := t.TempDir()
+	filePath := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(filePath, []byte("one\r\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var opened bool
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			if strings.Contains(code, "open_diff") {
+				opened = true
+			}
+			return nil
+		}),
+	}
+
+	result, err := s.handleGetFileHash(map[string]interface{}{"filePath": filePath})
+	if err != nil || result.IsError {
+		t.Fatalf("handleGetFileHash failed: %v %+v", err, result)
+	}
+	var got map[string]string
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+		t.Fatal(err)
+	}
+	// Disk content hashes like the buffer Neovim would load for it
+	if got["source"] != "disk" || got["sha256"] != contentHash("one\ntwo") {
+		t.Errorf("handleGetFileHash() = %+v, want the disk hash of the normalized content", got)
+	}
+
+	diffArgs := map[string]interface{}{"filePath": filePath, "newContent": "three\n", "expectedHash": contentHash("old")}
+	result, _ = s.handleOpenDiff(diffArgs)
+	if result.Code != types.ErrorCodeStale || opened {
+		t.Errorf("handleOpenDiff(stale expectedHash) = %+v (opened %v), want a %q error without opening the diff", result, opened, types.ErrorCodeStale)
+	}
+
+	diffArgs["expectedHash"] = got["sha256"]
+	if result, _ = s.handleOpenDiff(diffArgs); result.IsError || !opened {
+		t.Errorf("handleOpenDiff(matching expectedHash) = %+v, want the diff opened", result)
+	}
+}
+
+func TestHandleSetActiveBufferNotOpen(t *testing.T) {
+	// The fake leaves the result nil, as Lua does for a file that isn't open
+	var gotPath interface{}
+	s := &Server{
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			gotPath = args[0]
+			return nil
+		}),
+	}
+
+	result, err := s.handleSetActiveBuffer(map[string]interface{}{"filePath": "/work/closed.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/work/closed.go" {
+		t.Errorf("handleSetActiveBuffer() filePath arg = %v, want %q", gotPath, "/work/closed.go")
+	}
+	if !result.IsError || result.Code != types.ErrorCodeNotFound {
+		t.Fatalf("handleSetActiveBuffer() = %+v, want a %q error", result, types.ErrorCodeNotFound)
+	}
+	if want := "File is not open in Neovim: /work/closed.go"; result.Content[0].Text != want {
+		t.Errorf("handleSetActiveBuffer() text = %q, want %q", result.Content[0].Text, want)
+	}
+
+	result, _ = s.handleSetActiveBuffer(map[string]interface{}{})
+	if result.Code != types.ErrorCodeInvalidArgument {
+		t.Errorf("handleSetActiveBuffer() without filePath code = %q, want %q", result.Code, types.ErrorCodeInvalidArgument)
+	}
+}
@@ -0,0 +1,68 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"time"
+
+	"gemini-cli/logger"
+)
+
+// bufferChangeDebounce coalesces bursts of buffer changes into a single context update
+const bufferChangeDebounce = 200 * time.Millisecond
+
+// HandleBufferChanged records a buffer change reported by Neovim and schedules
+// a coalesced context update
+func (s *Server) HandleBufferChanged(filePath string, changedtick int64) {
+	logger.Debug("Buffer changed: %s (tick %d)", filePath, changedtick)
+
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	if s.bufferTimer == nil {
+		s.bufferTimer = time.AfterFunc(bufferChangeDebounce, s.flushBufferChanges)
+	}
+}
+
+// flushBufferChanges pulls the current context from Neovim and pushes it to subscribers
+func (s *Server) flushBufferChanges() {
+	s.bufMu.Lock()
+	s.bufferTimer = nil
+	s.bufMu.Unlock()
+
+	context, err := s.nvimClient.GetContext()
+	if err != nil {
+		logger.Warn("Failed to refresh context after buffer change: %v", err)
+		return
+	}
+	s.SendContextUpdate(context)
+}
+
+// syncBufferSubscription forwards buffer changes from Neovim while any SSE
+// client is connected. It runs synchronously in the SSE handler and applies
+// the current subscriber count rather than the connect or disconnect that
+// called it, so a quick connect and disconnect can't be applied in reverse
+// and leave a stale subscription behind.
+func (s *Server) syncBufferSubscription() {
+	if s.nvimClient == nil {
+		return
+	}
+	s.bufSubMu.Lock()
+	defer s.bufSubMu.Unlock()
+
+	s.mu.RLock()
+	want := len(s.subscribers) > 0
+	s.mu.RUnlock()
+	if want == s.bufSubscribed {
+		return
+	}
+
+	if want {
+		if err := s.nvimClient.SubscribeBufferEvents(); err != nil {
+			logger.Warn("Failed to subscribe to buffer events: %v", err)
+			return
+		}
+	} else if err := s.nvimClient.UnsubscribeBufferEvents(); err != nil {
+		logger.Warn("Failed to unsubscribe from buffer events: %v", err)
+		return
+	}
+	s.bufSubscribed = want
+}
@@ -0,0 +1,47 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"log"
+
+	"gemini-cli/types"
+)
+
+// recordClient stores the clientInfo and capabilities from initialize params.
+// Capabilities are read from "capabilities", as in the MCP spec, or from
+// "clientCapabilities".
+func (s *Server) recordClient(params map[string]interface{}) {
+	var info types.ClientInfo
+	if raw, ok := params["clientInfo"].(map[string]interface{}); ok {
+		info.Name, _ = raw["name"].(string)
+		info.Version, _ = raw["version"].(string)
+	}
+	capabilities, ok := params["capabilities"].(map[string]interface{})
+	if !ok {
+		capabilities, _ = params["clientCapabilities"].(map[string]interface{})
+	}
+
+	s.clientMu.Lock()
+	s.clientInfo = info
+	s.clientCapabilities = capabilities
+	s.clientMu.Unlock()
+
+	log.Printf("Client initialized: %s %s", info.Name, info.Version)
+}
+
+// ClientInfo returns the name and version the client sent in initialize
+func (s *Server) ClientInfo() types.ClientInfo {
+	s.clientMu.RLock()
+	defer s.clientMu.RUnlock()
+	return s.clientInfo
+}
+
+// ClientSupports reports whether the client declared a capability in
+// initialize, so optional behavior can be enabled only for clients that
+// understand it
+func (s *Server) ClientSupports(capability string) bool {
+	s.clientMu.RLock()
+	defer s.clientMu.RUnlock()
+	_, ok := s.clientCapabilities[capability]
+	return ok
+}
@@ -0,0 +1,54 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"context"
+	"errors"
+)
+
+// DefaultMaxConcurrentToolCalls is the limit used when
+// Config.MaxConcurrentToolCalls is zero. Neovim runs Lua one call at a time,
+// so more parallelism only queues work on its RPC connection.
+const DefaultMaxConcurrentToolCalls = 4
+
+// errServerBusy is returned by acquireToolSlot when RejectWhenBusy is set and
+// every slot is taken
+var errServerBusy = errors.New("too many concurrent tool calls")
+
+// interactiveTools wait on the user rather than on Neovim, for up to minutes,
+// so they don't take a slot; otherwise a few pending prompts would block
+// every other tool, including the ones that close diffs
+var interactiveTools = map[string]bool{"confirm": true}
+
+// acquireToolSlot takes one of the MaxConcurrentToolCalls slots for a call to
+// toolName, waiting for one to free up unless RejectWhenBusy is set. It fails
+// with errServerBusy when rejected, or the context's error when the request
+// goes away while waiting; otherwise the returned function releases the slot.
+func (s *Server) acquireToolSlot(ctx context.Context, toolName string) (func(), error) {
+	if interactiveTools[toolName] {
+		return func() {}, nil
+	}
+	s.toolSlotsOnce.Do(func() {
+		limit := s.config.MaxConcurrentToolCalls
+		if limit <= 0 {
+			limit = DefaultMaxConcurrentToolCalls
+		}
+		s.toolSlots = make(chan struct{}, limit)
+	})
+
+	release := func() { <-s.toolSlots }
+	if s.config.RejectWhenBusy {
+		select {
+		case s.toolSlots <- struct{}{}:
+			return release, nil
+		default:
+			return nil, errServerBusy
+		}
+	}
+	select {
+	case s.toolSlots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
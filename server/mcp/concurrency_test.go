@@ -0,0 +1,142 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gemini-cli/types"
+)
+
+// blockingServer returns a server with a "block" tool that waits on release,
+// recording the most calls it saw running at once
+func blockingServer(config Config, release <-chan struct{}, running, peak *int32) *Server {
+	s := &Server{config: config, tools: make(map[string]Tool)}
+	s.tools["block"] = Tool{Name: "block", Handler: func(map[string]interface{}) (*types.ToolCallResult, error) {
+		n := atomic.AddInt32(running, 1)
+		for {
+			p := atomic.LoadInt32(peak)
+			if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(running, -1)
+		return textResult("done"), nil
+	}}
+	return s
+}
+
+func TestToolCallConcurrencyQueues(t *testing.T) {
+	release := make(chan struct{})
+	var running, peak int32
+	s := blockingServer(Config{MaxConcurrentToolCalls: 2}, release, &running, &peak)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = postMCP(s, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"block"}}`).Body.String()
+		}(i)
+	}
+
+	// Let the calls pile up, then check only two got to run
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&running) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&running); n != 2 {
+		t.Errorf("%d tool calls running, want the limit of 2", n)
+	}
+	close(release)
+	wg.Wait()
+
+	if peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak)
+	}
+	for _, body := range bodies {
+		if !strings.Contains(body, "done") {
+			t.Errorf("queued tools/call response = %s, want the call to finish", body)
+		}
+	}
+}
+
+func TestToolCallConcurrencyRejects(t *testing.T) {
+	release := make(chan struct{})
+	var running, peak int32
+	s := blockingServer(Config{MaxConcurrentToolCalls: 1, RejectWhenBusy: true}, release, &running, &peak)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		postMCP(s, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"block"}}`)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&running) < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	body := postMCP(s, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"block"}}`).Body.String()
+	if !strings.Contains(body, `"code":-32603`) || !strings.Contains(body, "Server busy") {
+		t.Errorf("tools/call beyond the limit = %s, want a server busy error", body)
+	}
+	close(release)
+	<-done
+
+	// The slot is free again once the first call finishes
+	body = postMCP(s, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"block"}}`).Body.String()
+	if !strings.Contains(body, "done") {
+		t.Errorf("tools/call after the slot was released = %s, want the call to run", body)
+	}
+}
+
+func TestToolCallConcurrencyQueueHonorsCancellation(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var running, peak int32
+	s := blockingServer(Config{MaxConcurrentToolCalls: 1}, release, &running, &peak)
+	s.tools["confirm"] = Tool{Name: "confirm", Handler: func(map[string]interface{}) (*types.ToolCallResult, error) {
+		return textResult("yes"), nil
+	}}
+
+	go postMCP(s, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"block"}}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&running) < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A queued call whose client goes away is dropped instead of running later
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"block"}}`))
+	rr := httptest.NewRecorder()
+	s.HandleMCP(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, "Request ended") {
+		t.Errorf("HandleMCP() after the client left = %s, want a request ended error", body)
+	}
+	if p := atomic.LoadInt32(&peak); p != 1 {
+		t.Errorf("peak concurrency = %d, want 1", p)
+	}
+
+	// Interactive tools don't wait for a slot
+	done := make(chan string)
+	go func() {
+		done <- postMCP(s, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"confirm"}}`).Body.String()
+	}()
+	select {
+	case body := <-done:
+		if !strings.Contains(body, "yes") {
+			t.Errorf("confirm = %s, want yes", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("confirm waited for a tool slot")
+	}
+}
@@ -0,0 +1,16 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"gemini-cli/types"
+)
+
+// handleGetContext handles the getContext tool call, letting clients pull the
+// same IdeContext that ide/contextUpdate pushes (e.g. to resync after reconnecting)
+func (s *Server) handleGetContext(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	context, err := s.nvimClient.GetContext()
+	if err != nil {
+		return errorResult("Failed to get context: %v", err), nil
+	}
+	return jsonResult(context)
+}
@@ -0,0 +1,191 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+// diffOp is one step of an edit script turning old lines into new ones
+type diffOp int
+
+const (
+	opEqual diffOp = iota
+	opDelete
+	opInsert
+)
+
+// maxDiffEdits caps the edit distance myersDiff searches. The snapshots it
+// keeps grow with the square of the distance, so beyond this the whole file
+// is reported as replaced.
+const maxDiffEdits = 2000
+
+// myersDiff returns a shortest edit script from a to b, using Myers'
+// O((N+M)D) algorithm. Past maxDiffEdits it gives up and returns a script
+// that deletes every old line and inserts every new one.
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	total := n + m
+	offset := total
+	// v[offset+k] is the furthest x reached on diagonal k = x - y
+	v := make([]int, 2*total+2)
+	// trace[d] holds v[offset-d-1 .. offset+d+1] as it was before step d,
+	// the only diagonals backtrackDiff reads for that step
+	var trace [][]int
+
+	for d := 0; d <= total && d <= maxDiffEdits; d++ {
+		lo, hi := offset-d-1, offset+d+2
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(v) {
+			hi = len(v)
+		}
+		trace = append(trace, append(make([]int, lo-(offset-d-1)), v[lo:hi]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // step down: insertion
+			} else {
+				x = v[offset+k-1] + 1 // step right: deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(trace, n, m)
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, total)
+	for i := 0; i < n; i++ {
+		ops = append(ops, opDelete)
+	}
+	for j := 0; j < m; j++ {
+		ops = append(ops, opInsert)
+	}
+	return ops
+}
+
+// backtrackDiff walks the snapshots recorded by myersDiff from the end back
+// to the start, recovering the edit script
+func backtrackDiff(trace [][]int, x, y int) []diffOp {
+	var ops []diffOp
+	for d := len(trace) - 1; d >= 0; d-- {
+		// Diagonal k of step d is at trace[d][k+d+1]
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, opEqual)
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, opInsert)
+			} else {
+				ops = append(ops, opDelete)
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// previewHunks groups the changes between old and new lines into hunks
+func previewHunks(oldLines, newLines []string) []types.PreviewHunk {
+	hunks := []types.PreviewHunk{}
+	var current *types.PreviewHunk
+	i, j := 0, 0
+	for _, op := range myersDiff(oldLines, newLines) {
+		if op == opEqual {
+			if current != nil {
+				hunks = append(hunks, *current)
+				current = nil
+			}
+			i++
+			j++
+			continue
+		}
+
+		if current == nil {
+			current = &types.PreviewHunk{StartLine: i + 1, OldLines: []string{}, NewLines: []string{}}
+		}
+		if op == opDelete {
+			current.OldLines = append(current.OldLines, oldLines[i])
+			i++
+		} else {
+			current.NewLines = append(current.NewLines, newLines[j])
+			j++
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+	return hunks
+}
+
+// contentLines splits content into lines the way Neovim holds them: without
+// a BOM, with LF line endings and without the final newline
+func contentLines(content string) []string {
+	content = strings.TrimSuffix(nvim.NormalizeContent(content), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// handleDiffPreview handles the diffPreview tool call. It compares newContent
+// with the file on disk without involving Neovim, so unsaved buffer changes
+// are not seen.
+func (s *Server) handleDiffPreview(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+	newContent, ok := args["newContent"].(string)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid newContent"), nil
+	}
+	if tooLarge := s.checkDiffSize(filePath, newContent); tooLarge != nil {
+		return tooLarge, nil
+	}
+	if _, ok := s.workspaceRootFor(filePath); !ok {
+		return codedErrorResult(types.ErrorCodeOutOfWorkspace, "File is outside the workspace: %s", filePath), nil
+	}
+
+	// A file that doesn't exist yet previews as a pure addition
+	data, err := os.ReadFile(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errorResult("Failed to read %s: %v", filePath, err), nil
+	}
+	if tooLarge := s.checkDiffSize(filePath, string(data)); tooLarge != nil {
+		return tooLarge, nil
+	}
+
+	return jsonResult(map[string]interface{}{
+		"path":  s.displayPath(filePath),
+		"hunks": previewHunks(contentLines(string(data)), contentLines(newContent)),
+	})
+}
@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestPreviewHunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []types.PreviewHunk
+	}{
+		{
+			name: "unchanged",
+			old:  "a\nb\n",
+			new:  "a\r\nb\r\n",
+			want: []types.PreviewHunk{},
+		},
+		{
+			name: "addition",
+			old:  "a\nc\n",
+			new:  "a\nb\nc\n",
+			want: []types.PreviewHunk{{StartLine: 2, OldLines: []string{}, NewLines: []string{"b"}}},
+		},
+		{
+			name: "append to end",
+			old:  "a\n",
+			new:  "a\nb\n",
+			want: []types.PreviewHunk{{StartLine: 2, OldLines: []string{}, NewLines: []string{"b"}}},
+		},
+		{
+			name: "deletion",
+			old:  "a\nb\nc\n",
+			new:  "a\nc\n",
+			want: []types.PreviewHunk{{StartLine: 2, OldLines: []string{"b"}, NewLines: []string{}}},
+		},
+		{
+			name: "modification",
+			old:  "a\nb\nc\nd\n",
+			new:  "a\nB\nc\nD\n",
+			want: []types.PreviewHunk{
+				{StartLine: 2, OldLines: []string{"b"}, NewLines: []string{"B"}},
+				{StartLine: 4, OldLines: []string{"d"}, NewLines: []string{"D"}},
+			},
+		},
+		{
+			name: "new file",
+			old:  "",
+			new:  "a\nb",
+			want: []types.PreviewHunk{{StartLine: 1, OldLines: []string{}, NewLines: []string{"a", "b"}}},
+		},
+		{
+			name: "emptied file",
+			old:  "a\nb\n",
+			new:  "",
+			want: []types.PreviewHunk{{StartLine: 1, OldLines: []string{"a", "b"}, NewLines: []string{}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := previewHunks(contentLines(tt.old), contentLines(tt.new))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("previewHunks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMyersDiffIsMinimal(t *testing.T) {
+	a := []string{"a", "b", "c", "a", "b", "b", "a"}
+	b := []string{"c", "b", "a", "b", "a", "c"}
+	edits := 0
+	for _, op := range myersDiff(a, b) {
+		if op != opEqual {
+			edits++
+		}
+	}
+	// The classic example from Myers' paper has an edit distance of 5
+	if edits != 5 {
+		t.Errorf("myersDiff made %d edits, want 5", edits)
+	}
+}
+
+func TestPreviewHunksLargeInput(t *testing.T) {
+	oldLines := make([]string, 5000)
+	newLines := make([]string, 5000)
+	for i := range oldLines {
+		oldLines[i] = fmt.Sprintf("old %d", i)
+		newLines[i] = fmt.Sprintf("new %d", i)
+	}
+
+	// A full rewrite is past maxDiffEdits and comes back as one hunk
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	got := previewHunks(oldLines, newLines)
+	runtime.ReadMemStats(&after)
+	if len(got) != 1 || len(got[0].OldLines) != 5000 || len(got[0].NewLines) != 5000 {
+		t.Errorf("previewHunks() of a full rewrite = %d hunks, want 1 replacing every line", len(got))
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 100<<20 {
+		t.Errorf("previewHunks() of a full rewrite allocated %d MiB, want at most 100", alloc>>20)
+	}
+
+	// A few edits in a large file still get their own hunks
+	edited := append([]string(nil), oldLines...)
+	edited[10], edited[4000] = "changed", "changed"
+	if got := previewHunks(oldLines, edited); len(got) != 2 || got[1].StartLine != 4001 {
+		t.Errorf("previewHunks() = %+v, want hunks at lines 11 and 4001", got)
+	}
+}
+
+func TestHandleDiffPreview(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{config: Config{WorkspaceRoots: []string{root}}}
+
+	result, err := s.handleDiffPreview(map[string]interface{}{"filePath": path, "newContent": "one\n2\n"})
+	if err != nil || result.IsError {
+		t.Fatalf("handleDiffPreview = %+v, %v", result, err)
+	}
+	var preview struct {
+		Hunks []types.PreviewHunk `json:"hunks"`
+	}
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &preview); err != nil {
+		t.Fatal(err)
+	}
+	want := []types.PreviewHunk{{StartLine: 2, OldLines: []string{"two"}, NewLines: []string{"2"}}}
+	if !reflect.DeepEqual(preview.Hunks, want) {
+		t.Errorf("hunks = %+v, want %+v", preview.Hunks, want)
+	}
+
+	result, err = s.handleDiffPreview(map[string]interface{}{"filePath": "/etc/passwd", "newContent": ""})
+	if err != nil || result.Code != types.ErrorCodeOutOfWorkspace {
+		t.Errorf("handleDiffPreview outside the workspace = %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,302 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gemini-cli/types"
+)
+
+// DiffSession tracks a diff opened through the server until it is accepted,
+// rejected or closed
+type DiffSession struct {
+	FilePath string
+	OpenedAt time.Time
+	// Hunks is the current hunk layout, nil when unknown (e.g. multi-file edits)
+	Hunks []types.Hunk
+	// RequestKey identifies the openDiff request that opened the diff, so
+	// cancelling that request closes it; empty for other diffs
+	RequestKey string
+}
+
+// pathLock is a per-file mutex with a count of the callers holding or
+// waiting on it, so the entry can be dropped once nobody needs it
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockPath serializes diff operations on filePath while leaving other files
+// parallel. The returned function releases the lock.
+func (s *Server) lockPath(filePath string) func() {
+	key := filepath.Clean(filePath)
+	s.pathLocksMu.Lock()
+	if s.pathLocks == nil {
+		s.pathLocks = make(map[string]*pathLock)
+	}
+	lock, ok := s.pathLocks[key]
+	if !ok {
+		lock = &pathLock{}
+		s.pathLocks[key] = lock
+	}
+	lock.refs++
+	s.pathLocksMu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		s.pathLocksMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(s.pathLocks, key)
+		}
+		s.pathLocksMu.Unlock()
+	}
+}
+
+// lockPaths locks several files in a consistent order to avoid deadlocks
+func (s *Server) lockPaths(filePaths []string) func() {
+	sorted := make([]string, len(filePaths))
+	for i, filePath := range filePaths {
+		sorted[i] = filepath.Clean(filePath)
+	}
+	sort.Strings(sorted)
+
+	unlocks := make([]func(), 0, len(sorted))
+	for i, filePath := range sorted {
+		if i > 0 && filePath == sorted[i-1] {
+			continue
+		}
+		unlocks = append(unlocks, s.lockPath(filePath))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// startDiffSession records a newly opened diff, replacing any previous one for the file
+func (s *Server) startDiffSession(filePath string, hunks []types.Hunk) {
+	s.diffMu.Lock()
+	defer s.diffMu.Unlock()
+	if s.diffs == nil {
+		s.diffs = make(map[string]*DiffSession)
+	}
+	s.diffs[filePath] = &DiffSession{FilePath: filePath, OpenedAt: time.Now(), Hunks: hunks}
+}
+
+// endDiffSession forgets the diff for filePath
+func (s *Server) endDiffSession(filePath string) {
+	s.diffMu.Lock()
+	defer s.diffMu.Unlock()
+	delete(s.diffs, filePath)
+}
+
+// diffSession returns a copy of the session for filePath
+func (s *Server) diffSession(filePath string) (DiffSession, bool) {
+	s.diffMu.Lock()
+	defer s.diffMu.Unlock()
+	session, ok := s.diffs[filePath]
+	if !ok {
+		return DiffSession{}, false
+	}
+	return *session, true
+}
+
+// diffStats summarizes the session of filePath's diff, if there is one
+func (s *Server) diffStats(filePath string) types.DiffStats {
+	stats := types.DiffStats{FilePath: s.displayPath(filePath)}
+	session, ok := s.diffSession(filePath)
+	if !ok || session.Hunks == nil {
+		return stats
+	}
+	stats.HunksKnown = true
+	stats.Hunks = len(session.Hunks)
+	for _, hunk := range session.Hunks {
+		stats.LinesAdded += hunk.NewCount
+		stats.LinesRemoved += hunk.OldCount
+	}
+	return stats
+}
+
+// describeDiff formats stats for the text block of a diff result
+func describeDiff(action string, stats types.DiffStats) string {
+	if !stats.HunksKnown {
+		return fmt.Sprintf("%s the diff for %s", action, stats.FilePath)
+	}
+	return fmt.Sprintf("%s the diff for %s: %d hunks, +%d -%d lines", action, stats.FilePath, stats.Hunks, stats.LinesAdded, stats.LinesRemoved)
+}
+
+// handleAcceptHunks handles the acceptHunks tool call
+func (s *Server) handleAcceptHunks(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok {
+		return errorResult("Invalid filePath"), nil
+	}
+
+	rawIndices, ok := args["hunks"].([]interface{})
+	if !ok || len(rawIndices) == 0 {
+		return errorResult("Invalid hunks"), nil
+	}
+
+	defer s.lockPath(filePath)()
+
+	session, ok := s.diffSession(filePath)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeNotFound, "No open diff for %s", filePath), nil
+	}
+
+	seen := make(map[int]bool, len(rawIndices))
+	indices := make([]int, 0, len(rawIndices))
+	for _, raw := range rawIndices {
+		f, ok := raw.(float64)
+		index := int(f)
+		if !ok || f != float64(index) || index < 0 || index >= len(session.Hunks) {
+			return errorResult("Invalid hunk index %v: diff has %d hunks", raw, len(session.Hunks)), nil
+		}
+		if !seen[index] {
+			seen[index] = true
+			indices = append(indices, index)
+		}
+	}
+
+	remaining, err := s.nvimClient.AcceptHunks(filePath, indices)
+	if err != nil {
+		return errorResult("Failed to accept hunks: %v", err), nil
+	}
+
+	s.diffMu.Lock()
+	if current, ok := s.diffs[filePath]; ok {
+		current.Hunks = remaining
+	}
+	s.diffMu.Unlock()
+
+	if remaining == nil {
+		remaining = []types.Hunk{}
+	}
+	return jsonResult(map[string]interface{}{
+		"applied":        len(indices),
+		"remainingHunks": remaining,
+	})
+}
+
+// handleFocusDiff handles the focusDiff tool call
+func (s *Server) handleFocusDiff(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+
+	defer s.lockPath(filePath)()
+
+	if _, ok := s.diffSession(filePath); !ok {
+		return codedErrorResult(types.ErrorCodeNotFound, "No open diff for %s", filePath), nil
+	}
+
+	focused, err := s.nvimClient.FocusDiff(filePath)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to focus diff: %v", err), nil
+	}
+	return jsonResult(map[string]interface{}{
+		"filePath": s.displayPath(filePath),
+		"focused":  focused,
+	})
+}
+
+// requestKey turns a JSON-RPC request id into a map key. Numbers and strings
+// stay distinct, so request 1 and request "1" don't collide. Notifications
+// have no id and no key.
+func requestKey(id interface{}) string {
+	if id == nil {
+		return ""
+	}
+	return fmt.Sprintf("%#v", id)
+}
+
+// beginOpenDiffCall records an openDiff request as in flight, so a
+// cancellation arriving before the diff is open isn't lost
+func (s *Server) beginOpenDiffCall(id interface{}) {
+	key := requestKey(id)
+	if key == "" {
+		return
+	}
+	s.diffMu.Lock()
+	defer s.diffMu.Unlock()
+	if s.openDiffCalls == nil {
+		s.openDiffCalls = make(map[string]bool)
+	}
+	s.openDiffCalls[key] = false
+}
+
+// endOpenDiffCall ties the diff opened by an openDiff request to its id.
+// If the request was cancelled while the diff was opening, the diff is
+// rejected straight away instead.
+func (s *Server) endOpenDiffCall(id interface{}, filePath string, opened bool) {
+	key := requestKey(id)
+	if key == "" {
+		return
+	}
+
+	s.diffMu.Lock()
+	cancelled := s.openDiffCalls[key]
+	delete(s.openDiffCalls, key)
+	session, ok := s.diffs[filePath]
+	if opened && ok {
+		session.RequestKey = key
+	}
+	s.diffMu.Unlock()
+
+	if opened && cancelled {
+		s.rejectCancelledDiff(filePath, key)
+	}
+}
+
+// cancelDiffRequest closes the diff opened by the cancelled request id, or
+// marks the request cancelled if its diff is still opening
+func (s *Server) cancelDiffRequest(id interface{}) {
+	key := requestKey(id)
+	if key == "" {
+		return
+	}
+
+	s.diffMu.Lock()
+	if _, inFlight := s.openDiffCalls[key]; inFlight {
+		s.openDiffCalls[key] = true
+		s.diffMu.Unlock()
+		return
+	}
+	var filePath string
+	for path, session := range s.diffs {
+		if session.RequestKey == key {
+			filePath = path
+			break
+		}
+	}
+	s.diffMu.Unlock()
+
+	if filePath != "" {
+		s.rejectCancelledDiff(filePath, key)
+	}
+}
+
+// rejectCancelledDiff rejects the diff for filePath if it is still the one
+// opened by the request with key; a newer diff for the file is left alone
+func (s *Server) rejectCancelledDiff(filePath, key string) {
+	defer s.lockPath(filePath)()
+
+	session, ok := s.diffSession(filePath)
+	if !ok || session.RequestKey != key {
+		return
+	}
+	if err := s.nvimClient.RejectDiff(filePath); err != nil {
+		log.Printf("ERROR: Failed to close diff for cancelled request %s: %v", key, err)
+		return
+	}
+	s.endDiffSession(filePath)
+	log.Printf("Closed diff for %s after its request was cancelled", filePath)
+}
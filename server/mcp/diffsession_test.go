@@ -0,0 +1,245 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gemini-cli/types"
+)
+
+func TestDiffOperationsSerializePerFile(t *testing.T) {
+	var mu sync.Mutex
+	inFlight := make(map[string]int)
+	var overlapped int32
+
+	// Each accept/reject holds the "Lua side" briefly and records overlap per file
+	client := newFakeClient(func(code string, _ interface{}, args ...interface{}) error {
+		if !strings.Contains(code, "accept_diff") && !strings.Contains(code, "reject_diff") {
+			return nil
+		}
+		filePath := args[0].(string)
+
+		mu.Lock()
+		inFlight[filePath]++
+		if inFlight[filePath] > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight[filePath]--
+		mu.Unlock()
+		return nil
+	})
+	s := &Server{nvimClient: client}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = s.handleAcceptDiff(map[string]interface{}{"filePath": "/tmp/same.go"})
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = s.handleRejectDiff(map[string]interface{}{"filePath": "/tmp/same.go"})
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&overlapped) != 0 {
+		t.Error("accept/reject for the same file ran concurrently, want them serialized")
+	}
+}
+
+func TestLockPathReleasesOnError(t *testing.T) {
+	client := newFakeClient(func(_ string, _ interface{}, _ ...interface{}) error {
+		return errFake
+	})
+	s := &Server{nvimClient: client}
+
+	result, _ := s.handleAcceptDiff(map[string]interface{}{"filePath": "/tmp/fail.go"})
+	if !result.IsError {
+		t.Fatal("handleAcceptDiff() with failing Neovim succeeded, want error result")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.lockPath("/tmp/fail.go")()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock for /tmp/fail.go still held after a failed handler")
+	}
+}
+
+func TestLockPathCleansAndPrunes(t *testing.T) {
+	s := &Server{}
+	unlock := s.lockPath("/tmp/dir/../a.go")
+
+	acquired := make(chan struct{})
+	go func() {
+		s.lockPath("/tmp/a.go")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock for /tmp/a.go acquired while /tmp/dir/../a.go was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock for /tmp/a.go not acquired after release")
+	}
+
+	s.lockPaths([]string{"/tmp/b.go", "/tmp/./b.go", "/tmp/c.go"})()
+	s.pathLocksMu.Lock()
+	defer s.pathLocksMu.Unlock()
+	if len(s.pathLocks) != 0 {
+		t.Errorf("pathLocks after release = %v, want empty", s.pathLocks)
+	}
+}
+
+// postMCP sends a JSON-RPC body to HandleMCP
+func postMCP(s *Server, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	s.HandleMCP(rr, req)
+	return rr
+}
+
+func TestCancelClosesOpenedDiff(t *testing.T) {
+	var rejected []string
+	s := &Server{tools: make(map[string]Tool), nvimClient: newFakeClient(func(code string, _ interface{}, args ...interface{}) error {
+		if strings.Contains(code, "reject_diff") {
+			rejected = append(rejected, args[0].(string))
+		}
+		return nil
+	})}
+	s.registerTools()
+
+	postMCP(s, `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"openDiff","arguments":{"filePath":"/tmp/a.go","newContent":"x"}}}`)
+	if session, ok := s.diffSession("/tmp/a.go"); !ok || session.RequestKey == "" {
+		t.Fatalf("diffSession(/tmp/a.go) = %+v, %v; want a session tied to request 7", session, ok)
+	}
+
+	// A string id naming the same number is a different request
+	postMCP(s, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"7"}}`)
+	if len(rejected) != 0 {
+		t.Fatalf("Cancelling another request rejected %v", rejected)
+	}
+
+	postMCP(s, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7}}`)
+	if len(rejected) != 1 || rejected[0] != "/tmp/a.go" {
+		t.Errorf("rejected = %v, want [/tmp/a.go]", rejected)
+	}
+	if _, ok := s.diffSession("/tmp/a.go"); ok {
+		t.Error("diffSession(/tmp/a.go) after cancellation = true, want false")
+	}
+}
+
+func TestCancelWhileDiffOpening(t *testing.T) {
+	var rejected []string
+	var s *Server
+	s = &Server{tools: make(map[string]Tool), nvimClient: newFakeClient(func(code string, _ interface{}, args ...interface{}) error {
+		switch {
+		case strings.Contains(code, "open_diff"):
+			// The client gives up while Neovim is still opening the diff
+			s.cancelDiffRequest(float64(3))
+		case strings.Contains(code, "reject_diff"):
+			rejected = append(rejected, args[0].(string))
+		}
+		return nil
+	})}
+	s.registerTools()
+
+	postMCP(s, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"openDiff","arguments":{"filePath":"/tmp/b.go","newContent":"x"}}}`)
+	if len(rejected) != 1 || rejected[0] != "/tmp/b.go" {
+		t.Errorf("rejected = %v, want [/tmp/b.go]", rejected)
+	}
+	if _, ok := s.diffSession("/tmp/b.go"); ok {
+		t.Error("diffSession(/tmp/b.go) after cancellation = true, want false")
+	}
+}
+
+func TestDiffResultsIncludeStats(t *testing.T) {
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		if strings.Contains(code, "close_diff") {
+			*result.(*string) = "final content"
+		}
+		return nil
+	})}
+	s.startDiffSession("/tmp/a.go", []types.Hunk{
+		{OldStart: 1, OldCount: 1, NewStart: 1, NewCount: 2},
+		{OldStart: 5, OldCount: 3, NewStart: 6, NewCount: 0},
+	})
+
+	result, err := s.handleAcceptDiff(map[string]interface{}{"filePath": "/tmp/a.go"})
+	if err != nil || result.IsError || len(result.Content) != 2 {
+		t.Fatalf("handleAcceptDiff = %+v, %v; want a text and a JSON block", result, err)
+	}
+	if result.Content[0].Text != "Accepted the diff for /tmp/a.go: 2 hunks, +2 -4 lines" {
+		t.Errorf("handleAcceptDiff() summary = %q, want %q", result.Content[0].Text, "Accepted the diff for /tmp/a.go: 2 hunks, +2 -4 lines")
+	}
+	var stats types.DiffStats
+	if err := json.Unmarshal([]byte(result.Content[1].Text), &stats); err != nil {
+		t.Fatal(err)
+	}
+	want := types.DiffStats{FilePath: "/tmp/a.go", HunksKnown: true, Hunks: 2, LinesAdded: 2, LinesRemoved: 4}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	// closeDiff keeps the final content as its first block
+	s.startDiffSession("/tmp/b.go", nil)
+	result, err = s.handleCloseDiff(map[string]interface{}{"filePath": "/tmp/b.go"})
+	if err != nil || result.IsError || len(result.Content) != 2 || result.Content[0].Text != "final content" {
+		t.Errorf("handleCloseDiff = %+v, %v", result, err)
+	}
+}
+
+func TestHandleFocusDiff(t *testing.T) {
+	windowOpen := true
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		if strings.Contains(code, "focus_diff") {
+			*result.(*bool) = windowOpen
+		}
+		return nil
+	})}
+	focus := func() *types.ToolCallResult {
+		result, err := s.handleFocusDiff(map[string]interface{}{"filePath": "/tmp/a.go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if result := focus(); result.Code != types.ErrorCodeNotFound {
+		t.Errorf("handleFocusDiff() without a diff = %+v, want code %q", result, types.ErrorCodeNotFound)
+	}
+
+	s.startDiffSession("/tmp/a.go", nil)
+	for _, open := range []bool{true, false} {
+		windowOpen = open
+		result := focus()
+		var got struct {
+			Focused bool `json:"focused"`
+		}
+		if result.IsError || json.Unmarshal([]byte(result.Content[0].Text), &got) != nil || got.Focused != open {
+			t.Errorf("focusDiff with window open=%v = %+v", open, result)
+		}
+	}
+}
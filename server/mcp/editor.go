@@ -0,0 +1,441 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+const (
+	// defaultMessageLines is the number of :messages lines returned by default
+	defaultMessageLines = 50
+	// maxMessageLines caps the number of :messages lines per call
+	maxMessageLines = 500
+
+	// defaultConfirmTimeout is how long confirm waits for an answer by default
+	defaultConfirmTimeout = 60
+	// maxConfirmTimeout caps the confirm timeout, in seconds
+	maxConfirmTimeout = 600
+)
+
+// settableOptions is the allowlist of options setOption may change: formatting
+// and display settings that can't affect files beyond how they are edited
+var settableOptions = map[string]bool{
+	"colorcolumn":    true,
+	"expandtab":      true,
+	"list":           true,
+	"number":         true,
+	"relativenumber": true,
+	"shiftwidth":     true,
+	"softtabstop":    true,
+	"spell":          true,
+	"spelllang":      true,
+	"tabstop":        true,
+	"textwidth":      true,
+	"wrap":           true,
+}
+
+// DefaultAllowedCommands are the Ex commands runCommand accepts when
+// Config.AllowedCommands is empty: saving, building and the plugin's own commands
+var DefaultAllowedCommands = []string{"write", "update", "make", "Gemini*"}
+
+// handleGetNvimMessages handles the getNvimMessages tool call
+func (s *Server) handleGetNvimMessages(args map[string]interface{}) (*types.ToolCallResult, error) {
+	lines, ok := intArg(args, "lines", defaultMessageLines)
+	if !ok || lines <= 0 {
+		return errorResult("Invalid lines"), nil
+	}
+	if lines > maxMessageLines {
+		lines = maxMessageLines
+	}
+
+	messages, err := s.nvimClient.GetMessages(lines)
+	if err != nil {
+		return errorResult("Failed to get Neovim messages: %v", err), nil
+	}
+	return textResult(strings.Join(messages, "\n")), nil
+}
+
+// handleGetOption handles the getOption tool call
+func (s *Server) handleGetOption(args map[string]interface{}) (*types.ToolCallResult, error) {
+	name, ok := args["name"].(string)
+	if !ok || name == "" {
+		return errorResult("Invalid name"), nil
+	}
+	filePath, _ := args["filePath"].(string)
+
+	value, err := s.nvimClient.GetOption(name, filePath)
+	if err != nil {
+		return errorResult("Failed to get option: %v", err), nil
+	}
+	return jsonResult(map[string]interface{}{"name": name, "value": value})
+}
+
+// handleSetOption handles the setOption tool call
+func (s *Server) handleSetOption(args map[string]interface{}) (*types.ToolCallResult, error) {
+	name, ok := args["name"].(string)
+	if !ok || name == "" {
+		return errorResult("Invalid name"), nil
+	}
+	if !settableOptions[name] {
+		allowed := make([]string, 0, len(settableOptions))
+		for option := range settableOptions {
+			allowed = append(allowed, option)
+		}
+		sort.Strings(allowed)
+		return errorResult("Option %q cannot be set; allowed options: %s", name, strings.Join(allowed, ", ")), nil
+	}
+	filePath, _ := args["filePath"].(string)
+
+	value := args["value"]
+	switch v := value.(type) {
+	case bool, string:
+	case float64:
+		if v != float64(int(v)) {
+			return errorResult("Invalid value: options take integers, not %v", v), nil
+		}
+		value = int(v)
+	default:
+		return errorResult("Invalid value: expected a boolean, integer or string"), nil
+	}
+
+	if err := s.nvimClient.SetOption(name, filePath, value); err != nil {
+		return errorResult("Failed to set option: %v", err), nil
+	}
+	return textResult(fmt.Sprintf("Set %s to %v", name, value)), nil
+}
+
+// handleGetRegister handles the getRegister tool call
+func (s *Server) handleGetRegister(args map[string]interface{}) (*types.ToolCallResult, error) {
+	register, _ := args["register"].(string)
+	if register == "" {
+		register = "\""
+	}
+	if len([]rune(register)) != 1 {
+		return errorResult("Invalid register: %q", register), nil
+	}
+
+	content, err := s.nvimClient.GetRegister(register)
+	if err != nil {
+		return errorResult("Failed to get register: %v", err), nil
+	}
+	return textResult(content), nil
+}
+
+// noClipboardMessage explains an unavailable clipboard; it is informational,
+// not an error, since headless or remote sessions commonly have none
+const noClipboardMessage = "No clipboard provider is available in Neovim (see :help clipboard)"
+
+// clipboardRegister reads the optional register argument: "+" (default) or "*"
+func clipboardRegister(args map[string]interface{}) (string, bool) {
+	register, _ := args["register"].(string)
+	switch register {
+	case "":
+		return "+", true
+	case "+", "*":
+		return register, true
+	}
+	return "", false
+}
+
+// handleGetClipboard handles the getClipboard tool call
+func (s *Server) handleGetClipboard(args map[string]interface{}) (*types.ToolCallResult, error) {
+	register, ok := clipboardRegister(args)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid register: must be + or *"), nil
+	}
+
+	content, err := s.nvimClient.GetClipboard(register)
+	if errors.Is(err, nvim.ErrNoClipboard) {
+		return textResult(noClipboardMessage), nil
+	}
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get clipboard: %v", err), nil
+	}
+	return textResult(content), nil
+}
+
+// handleSetClipboard handles the setClipboard tool call
+func (s *Server) handleSetClipboard(args map[string]interface{}) (*types.ToolCallResult, error) {
+	content, ok := args["content"].(string)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid content"), nil
+	}
+	register, ok := clipboardRegister(args)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid register: must be + or *"), nil
+	}
+
+	err := s.nvimClient.SetClipboard(register, content)
+	if errors.Is(err, nvim.ErrNoClipboard) {
+		return textResult(noClipboardMessage), nil
+	}
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to set clipboard: %v", err), nil
+	}
+	return textResult(fmt.Sprintf("Copied %d bytes to the %s register", len(content), register)), nil
+}
+
+// handleConfirm handles the confirm tool call
+func (s *Server) handleConfirm(args map[string]interface{}) (*types.ToolCallResult, error) {
+	prompt, ok := args["prompt"].(string)
+	if !ok || prompt == "" {
+		return errorResult("Invalid prompt"), nil
+	}
+	timeout, ok := intArg(args, "timeoutSeconds", defaultConfirmTimeout)
+	if !ok || timeout <= 0 {
+		return errorResult("Invalid timeoutSeconds"), nil
+	}
+	if timeout > maxConfirmTimeout {
+		timeout = maxConfirmTimeout
+	}
+
+	choice, err := s.nvimClient.Confirm(prompt, time.Duration(timeout)*time.Second)
+	if err != nil {
+		return errorResult("Failed to ask for confirmation: %v", err), nil
+	}
+	return jsonResult(map[string]string{"choice": string(choice)})
+}
+
+// allowedCommands returns the configured runCommand allowlist
+func (s *Server) allowedCommands() []string {
+	if len(s.config.AllowedCommands) > 0 {
+		return s.config.AllowedCommands
+	}
+	return DefaultAllowedCommands
+}
+
+// commandAllowed reports whether the command name matches an allowlist entry
+func commandAllowed(name string, allowed []string) bool {
+	for _, entry := range allowed {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommand splits an Ex command into its name, without a leading colon or
+// trailing bang, and its arguments
+func splitCommand(command string) (name, rest string) {
+	command = strings.TrimLeft(strings.TrimSpace(command), ":")
+	name, rest = command, ""
+	if i := strings.IndexFunc(command, unicode.IsSpace); i >= 0 {
+		name, rest = command[:i], command[i:]
+	}
+	return strings.TrimSuffix(name, "!"), strings.TrimSpace(rest)
+}
+
+// shellCommands pass their arguments to the shell ('makeprg', 'grepprg')
+var shellCommands = map[string]bool{"make": true, "lmake": true, "grep": true, "lgrep": true}
+
+// writeCommands take a file name to write the buffer to
+var writeCommands = map[string]bool{"write": true, "update": true, "saveas": true}
+
+// shellMetachars would let arguments of a shell command run other commands
+const shellMetachars = ";&$`\\<>()"
+
+// checkCommandArgs vets the arguments of an allowlisted command that could
+// otherwise reach beyond it: shell commands may not carry metacharacters, and
+// write commands may only write to an absolute path inside the workspace. It
+// returns why the arguments are refused, or "" if they are fine.
+func (s *Server) checkCommandArgs(name, rest string) string {
+	if shellCommands[name] && strings.ContainsAny(rest, shellMetachars) {
+		return "its arguments are passed to the shell and may not contain any of " + shellMetachars
+	}
+	if !writeCommands[name] || rest == "" {
+		return ""
+	}
+
+	// ++opt arguments (e.g. ++enc=latin1) set how the file is written
+	var paths []string
+	for _, field := range strings.Fields(rest) {
+		if !strings.HasPrefix(field, "++") {
+			paths = append(paths, field)
+		}
+	}
+	switch {
+	case strings.Contains(rest, ">"):
+		return "appending with >> is not allowed"
+	case strings.Contains(rest, "`"):
+		// `cmd` and `=expr` in a file name run a shell command or Vim expression
+		return "backticks are not allowed"
+	case len(paths) > 1:
+		return "it may write to one file only"
+	case len(paths) == 0:
+		return ""
+	}
+	// Neovim expands ~, $VAR, %, # and wildcards in file names, which this
+	// check can't follow
+	path := paths[0]
+	if strings.ContainsAny(path, "~$%#<\\*?[{") || !filepath.IsAbs(path) {
+		return "the file must be an absolute path without ~, $, %, #, < or wildcards"
+	}
+	if _, ok := s.workspaceRootFor(path); !ok {
+		return "the file is outside the workspace"
+	}
+	return ""
+}
+
+// handleRunCommand handles the runCommand tool call
+func (s *Server) handleRunCommand(args map[string]interface{}) (*types.ToolCallResult, error) {
+	command, ok := args["command"].(string)
+	if !ok || strings.TrimSpace(command) == "" {
+		return errorResult("Invalid command"), nil
+	}
+
+	// Chained commands and shell escapes in the arguments (e.g. ":write !cmd")
+	// would run commands the allowlist doesn't cover
+	name, rest := splitCommand(command)
+	if strings.ContainsAny(command, "|\n") || strings.Contains(rest, "!") {
+		return errorResult("Command %q may not contain '|', newlines or shell escapes", command), nil
+	}
+	if !commandAllowed(name, s.allowedCommands()) {
+		return errorResult("Command %q is not allowed; allowed commands: %s", name, strings.Join(s.allowedCommands(), ", ")), nil
+	}
+	if msg := s.checkCommandArgs(name, rest); msg != "" {
+		return errorResult("Command %q is not allowed: %s", command, msg), nil
+	}
+
+	output, err := s.nvimClient.RunCommand(command)
+	if err != nil {
+		return errorResult("Failed to run command: %v", err), nil
+	}
+	return textResult(output), nil
+}
+
+// handleSetDiagnosticsDisplay handles the setDiagnosticsDisplay tool call
+func (s *Server) handleSetDiagnosticsDisplay(args map[string]interface{}) (*types.ToolCallResult, error) {
+	var settings [2]*bool
+	for i, name := range []string{"virtualText", "signs"} {
+		raw, present := args[name]
+		if !present || raw == nil {
+			continue
+		}
+		value, ok := raw.(bool)
+		if !ok {
+			return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid %s", name), nil
+		}
+		settings[i] = &value
+	}
+	if settings[0] == nil && settings[1] == nil {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Set virtualText, signs, or both"), nil
+	}
+
+	previous, err := s.nvimClient.SetDiagnosticsDisplay(settings[0], settings[1])
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to set diagnostics display: %v", err), nil
+	}
+	s.diagnosticsChanged.Store(true)
+	return jsonResult(map[string]interface{}{"previous": previous})
+}
+
+// RestoreDiagnosticsDisplay undoes setDiagnosticsDisplay changes made during
+// this session; it does nothing if the tool was never used
+func (s *Server) RestoreDiagnosticsDisplay() error {
+	if !s.diagnosticsChanged.Swap(false) {
+		return nil
+	}
+	return s.nvimClient.RestoreDiagnosticsDisplay()
+}
+
+// handleGetWorkspaceDiagnosticsSummary handles the getWorkspaceDiagnosticsSummary tool call
+func (s *Server) handleGetWorkspaceDiagnosticsSummary(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	counts, err := s.nvimClient.GetDiagnosticCounts()
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to count diagnostics: %v", err), nil
+	}
+
+	summary := types.DiagnosticsSummary{Files: make(map[string]types.DiagnosticCounts, len(counts))}
+	for _, buffer := range counts {
+		summary.Files[s.displayPath(buffer.Path)] = buffer.DiagnosticCounts
+		summary.Total.Error += buffer.Error
+		summary.Total.Warning += buffer.Warning
+		summary.Total.Info += buffer.Info
+		summary.Total.Hint += buffer.Hint
+	}
+	return jsonResult(summary)
+}
+
+// handleGetEditorConfig handles the getEditorConfig tool call
+func (s *Server) handleGetEditorConfig(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+
+	config, err := s.nvimClient.GetEditorConfig(filePath)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get editor config: %v", err), nil
+	}
+	config.Path = s.displayPath(config.Path)
+	return jsonResult(config)
+}
+
+// diagnosticSeverities maps the severity argument of the diagnostic
+// navigation tools to vim.diagnostic.severity names
+var diagnosticSeverities = map[string]string{
+	"error":   "ERROR",
+	"warning": "WARN",
+	"info":    "INFO",
+	"hint":    "HINT",
+}
+
+// handleGotoNextDiagnostic handles the gotoNextDiagnostic tool call
+func (s *Server) handleGotoNextDiagnostic(args map[string]interface{}) (*types.ToolCallResult, error) {
+	return s.gotoDiagnostic(args, true)
+}
+
+// handleGotoPrevDiagnostic handles the gotoPrevDiagnostic tool call
+func (s *Server) handleGotoPrevDiagnostic(args map[string]interface{}) (*types.ToolCallResult, error) {
+	return s.gotoDiagnostic(args, false)
+}
+
+// gotoDiagnostic moves the cursor to the next or previous diagnostic
+func (s *Server) gotoDiagnostic(args map[string]interface{}, forward bool) (*types.ToolCallResult, error) {
+	var severity string
+	if raw, present := args["severity"]; present && raw != nil {
+		name, _ := raw.(string)
+		if severity = diagnosticSeverities[name]; severity == "" {
+			return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid severity %v: use error, warning, info or hint", raw), nil
+		}
+	}
+
+	location, err := s.nvimClient.GotoDiagnostic(forward, severity)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to move to diagnostic: %v", err), nil
+	}
+	if location == nil {
+		direction := "after"
+		if !forward {
+			direction = "before"
+		}
+		return textResult(fmt.Sprintf("No more diagnostics %s the cursor", direction)), nil
+	}
+	location.Path = s.displayPath(location.Path)
+	return jsonResult(location)
+}
+
+// handleGetWordUnderCursor handles the getWordUnderCursor tool call
+func (s *Server) handleGetWordUnderCursor(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	word, err := s.nvimClient.WordUnderCursor()
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get word under cursor: %v", err), nil
+	}
+	if word.Path != "" {
+		word.Path = s.displayPath(word.Path)
+	}
+	return jsonResult(word)
+}
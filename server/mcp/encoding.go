@@ -0,0 +1,102 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// vimEncodingAliases maps Neovim 'fileencoding' names that aren't WHATWG
+// encoding labels to one that is
+var vimEncodingAliases = map[string]string{
+	"cp932":    "shift_jis",
+	"cp936":    "gbk",
+	"cp949":    "euc-kr",
+	"cp950":    "big5",
+	"cp874":    "windows-874",
+	"macroman": "macintosh",
+	"utf-16":   "utf-16be", // Vim's utf-16 is big endian; WHATWG's is little
+}
+
+// vimEncodingNames maps a WHATWG encoding name to the 'fileencoding' Neovim
+// uses for the same bytes. The names differ in meaning as well as spelling:
+// WHATWG's latin1 and shift_jis are Windows code pages cp1252 and cp932.
+var vimEncodingNames = map[string]string{
+	"utf-8":        "utf-8",
+	"utf-16be":     "utf-16",
+	"utf-16le":     "utf-16le",
+	"ibm866":       "cp866",
+	"iso-8859-2":   "iso-8859-2",
+	"iso-8859-3":   "iso-8859-3",
+	"iso-8859-4":   "iso-8859-4",
+	"iso-8859-5":   "iso-8859-5",
+	"iso-8859-6":   "iso-8859-6",
+	"iso-8859-7":   "iso-8859-7",
+	"iso-8859-8":   "iso-8859-8",
+	"iso-8859-10":  "iso-8859-10",
+	"iso-8859-13":  "iso-8859-13",
+	"iso-8859-14":  "iso-8859-14",
+	"iso-8859-15":  "iso-8859-15",
+	"koi8-r":       "koi8-r",
+	"koi8-u":       "koi8-u",
+	"macintosh":    "macroman",
+	"windows-874":  "cp874",
+	"windows-1250": "cp1250",
+	"windows-1251": "cp1251",
+	"windows-1252": "cp1252",
+	"windows-1253": "cp1253",
+	"windows-1254": "cp1254",
+	"windows-1255": "cp1255",
+	"windows-1256": "cp1256",
+	"windows-1257": "cp1257",
+	"windows-1258": "cp1258",
+	"gbk":          "cp936",
+	"gb18030":      "gb18030",
+	"big5":         "cp950",
+	"euc-jp":       "euc-jp",
+	"iso-2022-jp":  "iso-2022-jp",
+	"shift_jis":    "cp932",
+	"euc-kr":       "cp949",
+}
+
+// lookupEncoding returns the character encoding for a name such as "latin1",
+// "shift_jis" or a Neovim 'fileencoding' value. UTF-8 needs no decoding and
+// returns nil.
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	enc, canonical, err := resolveEncoding(name)
+	if err != nil || canonical == "utf-8" {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// vimEncoding returns the Neovim 'fileencoding' that writes the bytes
+// lookupEncoding decodes name as
+func vimEncoding(name string) (string, error) {
+	_, canonical, err := resolveEncoding(name)
+	if err != nil {
+		return "", err
+	}
+	vimName, ok := vimEncodingNames[canonical]
+	if !ok {
+		return "", fmt.Errorf("encoding %q has no Neovim equivalent", name)
+	}
+	return vimName, nil
+}
+
+// resolveEncoding returns the encoding for name and its WHATWG name
+func resolveEncoding(name string) (encoding.Encoding, string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := vimEncodingAliases[name]; ok {
+		name = alias
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported encoding %q", name)
+	}
+	canonical, _ := htmlindex.Name(enc)
+	return enc, canonical, nil
+}
@@ -0,0 +1,142 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestLookupEncoding(t *testing.T) {
+	for _, name := range []string{"latin1", "ISO-8859-1", "shift_jis", "cp932", "euc-jp"} {
+		if enc, err := lookupEncoding(name); err != nil || enc == nil {
+			t.Errorf("lookupEncoding(%q) = %v, %v; want an encoding", name, enc, err)
+		}
+	}
+	if enc, err := lookupEncoding("utf-8"); err != nil || enc != nil {
+		t.Errorf("lookupEncoding(utf-8) = %v, %v; want no decoding", enc, err)
+	}
+	if _, err := lookupEncoding("klingon"); err == nil {
+		t.Error("lookupEncoding(klingon) succeeded, want an error")
+	}
+}
+
+func TestHandleReadFileRangeEncoding(t *testing.T) {
+	root, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			return nil
+		}),
+	}
+	read := func(encoding string) *types.ToolCallResult {
+		result, err := s.handleReadFileRange(map[string]interface{}{
+			"filePath": filepath.Join(root, "latin1.txt"), "startLine": float64(1), "endLine": float64(2), "encoding": encoding,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := read("latin1")
+	var fileRange types.FileRange
+	if result.IsError || json.Unmarshal([]byte(result.Content[0].Text), &fileRange) != nil {
+		t.Fatalf("readFileRange(latin1) = %+v", result)
+	}
+	if len(fileRange.Lines) != 2 || fileRange.Lines[0].Text != "café" || fileRange.Lines[1].Text != "naïve «quoted»" {
+		t.Errorf("handleReadFileRange(latin1) lines = %+v, want the latin1 text decoded to UTF-8", fileRange.Lines)
+	}
+	if fileRange.Encoding != "latin1" {
+		t.Errorf("handleReadFileRange(latin1) encoding = %q, want latin1", fileRange.Encoding)
+	}
+
+	// Without an encoding the bytes are read as UTF-8, as before
+	if result := read(""); result.IsError || strings.Contains(result.Content[0].Text, "café") {
+		t.Errorf("handleReadFileRange() without an encoding = %+v, want the bytes read as UTF-8", result)
+	}
+
+	if result := read("klingon"); result.Code != types.ErrorCodeInvalidArgument {
+		t.Errorf("handleReadFileRange(klingon) = %+v, want code %q", result, types.ErrorCodeInvalidArgument)
+	}
+}
+
+func TestHandleAcceptDiffEncoding(t *testing.T) {
+	var passed []interface{}
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		if strings.Contains(code, "accept_diff") {
+			passed = args
+		}
+		return nil
+	})}
+
+	if result, _ := s.handleAcceptDiff(map[string]interface{}{"filePath": "/tmp/a.txt", "encoding": "klingon"}); result.Code != types.ErrorCodeInvalidArgument || passed != nil {
+		t.Errorf("handleAcceptDiff(klingon) = %+v (args %v), want %q before calling Neovim", result, passed, types.ErrorCodeInvalidArgument)
+	}
+	// WHATWG's latin1 is windows-1252, which Neovim calls cp1252
+	if result, _ := s.handleAcceptDiff(map[string]interface{}{"filePath": "/tmp/a.txt", "encoding": "latin1"}); result.IsError || len(passed) != 2 || passed[1] != "cp1252" {
+		t.Errorf("handleAcceptDiff(latin1) = %+v with args %v, want Neovim's cp1252", result, passed)
+	}
+	if result, _ := s.handleAcceptDiff(map[string]interface{}{"filePath": "/tmp/a.txt", "encoding": "shift_jis"}); result.IsError || passed[1] != "cp932" {
+		t.Errorf("handleAcceptDiff(shift_jis) = %+v with args %v, want Neovim's cp932", result, passed)
+	}
+}
+
+func TestVimEncodingRoundTrips(t *testing.T) {
+	// Each Neovim name reads back as the encoding it was chosen for
+	for canonical, vimName := range vimEncodingNames {
+		if _, got, err := resolveEncoding(vimName); err != nil || got != canonical {
+			t.Errorf("resolveEncoding(%q) = %q, %v; want %q", vimName, got, err, canonical)
+		}
+	}
+
+	// A latin1 file read with readFileRange and written back by acceptDiff
+	// keeps its bytes
+	root, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.ReadFile(filepath.Join(root, "latin1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vimName string
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			if strings.Contains(code, "accept_diff") {
+				vimName = args[1].(string)
+			}
+			return nil
+		}),
+	}
+	result, _ := s.handleReadFileRange(map[string]interface{}{
+		"filePath": filepath.Join(root, "latin1.txt"), "startLine": float64(1), "endLine": float64(100), "encoding": "latin1",
+	})
+	var fileRange types.FileRange
+	if result.IsError || json.Unmarshal([]byte(result.Content[0].Text), &fileRange) != nil {
+		t.Fatalf("handleReadFileRange(latin1) = %+v", result)
+	}
+	if result, _ := s.handleAcceptDiff(map[string]interface{}{"filePath": filepath.Join(root, "latin1.txt"), "encoding": "latin1"}); result.IsError {
+		t.Fatalf("handleAcceptDiff(latin1) = %+v", result)
+	}
+
+	enc, err := lookupEncoding(vimName)
+	if err != nil || enc == nil {
+		t.Fatalf("lookupEncoding(%q) = %v, %v", vimName, enc, err)
+	}
+	var text strings.Builder
+	for _, line := range fileRange.Lines {
+		text.WriteString(line.Text + "\n")
+	}
+	written, err := enc.NewEncoder().String(text.String())
+	if err != nil || written != string(original) {
+		t.Errorf("latin1.txt written as %q = %q, %v; want %q", vimName, written, err, original)
+	}
+}
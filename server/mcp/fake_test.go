@@ -0,0 +1,31 @@
+package mcp
+
+import (
+	"fmt"
+
+	"gemini-cli/nvim"
+)
+
+// fakeRPC stands in for the Neovim connection, answering ExecLua with exec
+type fakeRPC struct {
+	exec func(code string, result interface{}, args ...interface{}) error
+}
+
+func (f *fakeRPC) ExecLua(code string, result interface{}, args ...interface{}) error {
+	if f.exec == nil {
+		return nil
+	}
+	return f.exec(code, result, args...)
+}
+
+func (f *fakeRPC) RegisterHandler(_ string, _ interface{}) error {
+	return nil
+}
+
+// newFakeClient returns an nvim.Client backed by a fakeRPC using exec
+func newFakeClient(exec func(code string, result interface{}, args ...interface{}) error) *nvim.Client {
+	return nvim.NewClient(&fakeRPC{exec: exec})
+}
+
+// errFake is returned by fakes simulating a Neovim-side failure
+var errFake = fmt.Errorf("fake neovim failure")
@@ -0,0 +1,162 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gemini-cli/types"
+)
+
+// Limits for listFiles
+const (
+	defaultListFiles = 1000
+	maxListFiles     = 5000
+	// maxListedFileBytes skips files too large to be worth reading as source
+	maxListedFileBytes = 1024 * 1024
+	// binarySniffBytes is how much of a file is checked for NUL bytes, as git does
+	binarySniffBytes = 8000
+)
+
+// junkDirs are directories never descended into when listing files
+var junkDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	"node_modules": true,
+	"__pycache__":  true,
+	".venv":        true,
+}
+
+// handleListFiles handles the listFiles tool call
+func (s *Server) handleListFiles(args map[string]interface{}) (*types.ToolCallResult, error) {
+	glob, _ := args["glob"].(string)
+	if _, err := path.Match(glob, ""); err != nil {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid glob: %v", err), nil
+	}
+	maxEntries, ok := intArg(args, "maxEntries", defaultListFiles)
+	if !ok || maxEntries <= 0 || maxEntries > maxListFiles {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "maxEntries must be between 1 and %d", maxListFiles), nil
+	}
+	if len(s.config.WorkspaceRoots) == 0 {
+		return codedErrorResult(types.ErrorCodeNotFound, "No workspace roots are configured"), nil
+	}
+
+	listing := types.FileListing{Roots: []types.WorkspaceFiles{}}
+	remaining := maxEntries
+	for _, root := range s.config.WorkspaceRoots {
+		candidates, err := workspaceFiles(root)
+		if err != nil {
+			return codedErrorResult(types.ErrorCodeNotFound, "Failed to list %s: %v", root, err), nil
+		}
+
+		files := []string{}
+		for _, rel := range candidates {
+			if !matchesGlob(glob, rel) || !isListableFile(filepath.Join(root, filepath.FromSlash(rel))) {
+				continue
+			}
+			if remaining == 0 {
+				listing.Truncated = true
+				break
+			}
+			files = append(files, rel)
+			remaining--
+		}
+		listing.Roots = append(listing.Roots, types.WorkspaceFiles{Root: root, Files: files})
+	}
+	return jsonResult(listing)
+}
+
+// workspaceFiles returns the slash-separated paths of the files under root.
+// In a git work tree, git decides which files are ignored; otherwise the
+// tree is walked. Either way junk directories are left out.
+func workspaceFiles(root string) ([]string, error) {
+	if isGitRepo(root) {
+		out, err := runGit(root, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+		if err == nil {
+			var files []string
+			for _, rel := range strings.Split(out, "\x00") {
+				if rel != "" && !inJunkDir(rel) {
+					files = append(files, rel)
+				}
+			}
+			return files, nil
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable directories rather than failing the whole listing
+			if d != nil && d.IsDir() && p != root {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != root && junkDirs[d.Name()] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// inJunkDir reports whether a slash-separated relative path lies in a junk directory
+func inJunkDir(rel string) bool {
+	dirs := strings.Split(rel, "/")
+	for _, dir := range dirs[:len(dirs)-1] {
+		if junkDirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesGlob reports whether rel matches glob. A glob without a slash is
+// matched against the file name, otherwise against the whole relative path.
+// An empty glob matches everything.
+func matchesGlob(glob, rel string) bool {
+	if glob == "" {
+		return true
+	}
+	if !strings.Contains(glob, "/") {
+		rel = path.Base(rel)
+	}
+	matched, _ := path.Match(glob, rel)
+	return matched
+}
+
+// isListableFile reports whether the file at p is a regular text file small
+// enough to list. Symlinks are left out: they could point outside the workspace.
+func isListableFile(p string) bool {
+	info, err := os.Lstat(p)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxListedFileBytes {
+		return false
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = file.Close() }()
+
+	head := make([]byte, binarySniffBytes)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	return !bytes.Contains(head[:n], []byte{0})
+}
@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestMatchesGlob(t *testing.T) {
+	tests := []struct {
+		glob, rel string
+		want      bool
+	}{
+		{"", "a/b.go", true},
+		{"*.go", "a/b.go", true},
+		{"*.go", "a/b.lua", false},
+		{"a/*.go", "a/b.go", true},
+		{"a/*.go", "c/a/b.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchesGlob(tt.glob, tt.rel); got != tt.want {
+			t.Errorf("matchesGlob(%q, %q) = %v, want %v", tt.glob, tt.rel, got, tt.want)
+		}
+	}
+}
+
+// writeFiles creates files under root, making parent directories as needed
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listFiles calls handleListFiles and decodes its result
+func listFiles(t *testing.T, s *Server, args map[string]interface{}) types.FileListing {
+	t.Helper()
+	result, err := s.handleListFiles(args)
+	if err != nil || result.IsError {
+		t.Fatalf("handleListFiles failed: %v %+v", err, result)
+	}
+	var listing types.FileListing
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &listing); err != nil {
+		t.Fatal(err)
+	}
+	return listing
+}
+
+func TestHandleListFilesWalk(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.go":               "package main\n",
+		"pkg/util.go":           "package pkg\n",
+		"pkg/data.bin":          "\x00\x01",
+		"big.txt":               strings.Repeat("x", maxListedFileBytes+1),
+		"node_modules/dep/a.js": "",
+		"sub/.git/config":       "",
+		"README.md":             "# readme\n",
+	})
+	s := &Server{config: Config{WorkspaceRoots: []string{root}}}
+
+	listing := listFiles(t, s, nil)
+	want := []string{"README.md", "main.go", "pkg/util.go"}
+	if len(listing.Roots) != 1 || !reflect.DeepEqual(listing.Roots[0].Files, want) || listing.Truncated {
+		t.Errorf("listFiles() = %+v, want files %v", listing, want)
+	}
+
+	listing = listFiles(t, s, map[string]interface{}{"glob": "*.go", "maxEntries": float64(1)})
+	if !reflect.DeepEqual(listing.Roots[0].Files, []string{"main.go"}) || !listing.Truncated {
+		t.Errorf("listFiles(*.go, 1) = %+v, want main.go truncated", listing)
+	}
+}
+
+func TestHandleListFilesGitignore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Skipf("git init failed: %v %s", err, out)
+	}
+	writeFiles(t, root, map[string]string{
+		".gitignore":    "build/\n",
+		"main.go":       "package main\n",
+		"build/out.txt": "ignored\n",
+	})
+	s := &Server{config: Config{WorkspaceRoots: []string{root}}}
+
+	listing := listFiles(t, s, nil)
+	want := []string{".gitignore", "main.go"}
+	if !reflect.DeepEqual(listing.Roots[0].Files, want) {
+		t.Errorf("listFiles() = %v, want %v", listing.Roots[0].Files, want)
+	}
+}
+
+func TestHandleListFilesInvalidArguments(t *testing.T) {
+	s := &Server{config: Config{WorkspaceRoots: []string{t.TempDir()}}}
+	for _, args := range []map[string]interface{}{
+		{"glob": "["},
+		{"maxEntries": float64(0)},
+		{"maxEntries": float64(maxListFiles + 1)},
+	} {
+		result, err := s.handleListFiles(args)
+		if err != nil || result.Code != types.ErrorCodeInvalidArgument {
+			t.Errorf("handleListFiles(%v) = %+v, %v; want %q", args, result, err, types.ErrorCodeInvalidArgument)
+		}
+	}
+}
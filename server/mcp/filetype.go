@@ -0,0 +1,49 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// extensionFiletypes maps common file extensions to Neovim filetypes
+var extensionFiletypes = map[string]string{
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "cs",
+	".css":   "css",
+	".go":    "go",
+	".html":  "html",
+	".java":  "java",
+	".js":    "javascript",
+	".jsx":   "javascriptreact",
+	".json":  "json",
+	".kt":    "kotlin",
+	".lua":   "lua",
+	".md":    "markdown",
+	".php":   "php",
+	".py":    "python",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".scss":  "scss",
+	".sh":    "sh",
+	".sql":   "sql",
+	".swift": "swift",
+	".toml":  "toml",
+	".ts":    "typescript",
+	".tsx":   "typescriptreact",
+	".vim":   "vim",
+	".xml":   "xml",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".zig":   "zig",
+}
+
+// filetypeForPath infers the Neovim filetype from a file's extension,
+// returning "" when unknown so Neovim's own detection can take over
+func filetypeForPath(filePath string) string {
+	return extensionFiletypes[strings.ToLower(filepath.Ext(filePath))]
+}
@@ -0,0 +1,284 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gemini-cli/types"
+)
+
+// gitTimeout bounds each git invocation
+const gitTimeout = 10 * time.Second
+
+// runGit runs git with args inside dir and returns its stdout
+func runGit(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return string(output), &gitError{
+				command:  args[0],
+				stderr:   strings.TrimSpace(string(exitErr.Stderr)),
+				exitCode: exitErr.ExitCode(),
+			}
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(output), nil
+}
+
+// gitError is a git command that ran but exited with a non-zero status; some
+// commands, like check-ignore, use the status to answer
+type gitError struct {
+	command  string
+	stderr   string
+	exitCode int
+}
+
+func (e *gitError) Error() string {
+	return fmt.Sprintf("git %s: %s", e.command, e.stderr)
+}
+
+// isGitRepo reports whether dir is inside a git work tree
+func isGitRepo(dir string) bool {
+	out, err := runGit(dir, "rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// handleGitContext handles the gitContext tool call
+func (s *Server) handleGitContext(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok {
+		return errorResult("Invalid filePath"), nil
+	}
+
+	startLine, ok := intArg(args, "startLine", 0)
+	if !ok || startLine < 0 {
+		return errorResult("Invalid startLine"), nil
+	}
+	endLine, ok := intArg(args, "endLine", 0)
+	if !ok || endLine < 0 || (endLine > 0 && endLine < startLine) {
+		return errorResult("Invalid endLine"), nil
+	}
+
+	root, ok := s.workspaceRootFor(filePath)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeOutOfWorkspace, "File is outside the workspace: %s", filePath), nil
+	}
+
+	result := types.GitContext{Path: s.displayPath(filePath), StartLine: startLine, EndLine: endLine}
+	if !isGitRepo(root) {
+		result.Note = "Workspace is not a git repository"
+		return jsonResult(result)
+	}
+	result.IsGitRepo = true
+
+	relPath, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return errorResult("Failed to resolve path: %v", err), nil
+	}
+
+	if _, err := runGit(root, "rev-parse", "--verify", "-q", "HEAD"); err != nil {
+		// A repository without commits has no HEAD to diff or blame against,
+		// so report what has been staged for the first commit
+		diff, err := runGit(root, "diff", "--cached", "--", relPath)
+		if err != nil {
+			return errorResult("Failed to get diff: %v", err), nil
+		}
+		result.Diff = diff
+		result.Note = "Repository has no commits yet; diff shows staged changes"
+		return jsonResult(result)
+	}
+
+	// Working tree changes, staged or not, relative to HEAD
+	diff, err := runGit(root, "diff", "HEAD", "--", relPath)
+	if err != nil {
+		return errorResult("Failed to get diff: %v", err), nil
+	}
+	result.Diff = diff
+
+	blameArgs := []string{"blame", "--porcelain"}
+	if startLine > 0 {
+		if endLine == 0 {
+			endLine = startLine
+		}
+		blameArgs = append(blameArgs, "-L", fmt.Sprintf("%d,%d", startLine, endLine))
+	}
+	blame, err := runGit(root, append(blameArgs, "--", relPath)...)
+	if err != nil {
+		// Untracked files have no history yet
+		result.Note = fmt.Sprintf("No commit history: %v", err)
+		return jsonResult(result)
+	}
+	result.LastCommit = newestBlameCommit(blame)
+
+	return jsonResult(result)
+}
+
+// handleGitStatus handles the gitStatus tool call
+func (s *Server) handleGitStatus(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	if len(s.config.WorkspaceRoots) == 0 {
+		return codedErrorResult(types.ErrorCodeNotFound, "No workspace roots are configured"), nil
+	}
+	root := s.config.WorkspaceRoots[0]
+
+	result := types.GitStatus{Root: root}
+	if !isGitRepo(root) {
+		result.Note = "Workspace is not a git repository"
+		return jsonResult(result)
+	}
+	result.IsGitRepo = true
+
+	branch, err := runGit(root, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		// A branch without commits yet has no HEAD to resolve
+		branch, err = runGit(root, "symbolic-ref", "--short", "HEAD")
+		if err != nil {
+			return errorResult("Failed to get branch: %v", err), nil
+		}
+		result.Note = "Branch has no commits yet"
+	}
+	result.Branch = strings.TrimSpace(branch)
+	if result.Branch == "HEAD" {
+		result.Branch = ""
+		result.Detached = true
+		if head, err := runGit(root, "rev-parse", "--short", "HEAD"); err == nil {
+			result.Head = strings.TrimSpace(head)
+		}
+	}
+
+	status, err := runGit(root, "status", "--porcelain")
+	if err != nil {
+		return errorResult("Failed to get status: %v", err), nil
+	}
+	result.Staged, result.Unstaged, result.Untracked = countStatus(status)
+
+	return jsonResult(result)
+}
+
+// countStatus counts the staged, unstaged and untracked entries of git status
+// --porcelain output. A file with both staged and unstaged changes counts
+// towards both.
+func countStatus(porcelain string) (staged, unstaged, untracked int) {
+	for _, line := range strings.Split(porcelain, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		// "XY path": X is the index status, Y the working tree status
+		x, y := line[0], line[1]
+		if x == '?' {
+			untracked++
+			continue
+		}
+		if x != ' ' {
+			staged++
+		}
+		if y != ' ' {
+			unstaged++
+		}
+	}
+	return staged, unstaged, untracked
+}
+
+// newestBlameCommit returns the most recent commit in git blame --porcelain
+// output, ignoring lines that are not committed yet
+func newestBlameCommit(porcelain string) *types.GitCommit {
+	// Porcelain output only lists a commit's details the first time it appears
+	commits := make(map[string]*types.GitCommit)
+	times := make(map[string]int64)
+	var current string
+
+	scanner := bufio.NewScanner(strings.NewReader(porcelain))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		commit := commits[current]
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			// File content line
+		case commit != nil && strings.HasPrefix(line, "author "):
+			commit.Author = strings.TrimPrefix(line, "author ")
+		case commit != nil && strings.HasPrefix(line, "author-time "):
+			times[current], _ = strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64)
+			commit.Date = time.Unix(times[current], 0).UTC().Format(time.RFC3339)
+		case commit != nil && strings.HasPrefix(line, "summary "):
+			commit.Summary = strings.TrimPrefix(line, "summary ")
+		default:
+			// Header line: "<hash> <orig-line> <final-line> [<count>]"
+			fields := strings.Fields(line)
+			if len(fields) >= 3 && len(fields[0]) == 40 {
+				current = fields[0]
+				if commits[current] == nil {
+					commits[current] = &types.GitCommit{Hash: current}
+				}
+			}
+		}
+	}
+
+	var newest *types.GitCommit
+	for hash, commit := range commits {
+		if strings.Trim(hash, "0") == "" {
+			continue // "Not Committed Yet"
+		}
+		if newest == nil || times[hash] > times[newest.Hash] {
+			newest = commit
+		}
+	}
+	return newest
+}
+
+// checkIgnoreLine parses git check-ignore -v output, "source:line:pattern\tpath"
+var checkIgnoreLine = regexp.MustCompile(`^(.*?):(\d+):(.*)\t`)
+
+// handleIsIgnored handles the isIgnored tool call
+func (s *Server) handleIsIgnored(args map[string]interface{}) (*types.ToolCallResult, error) {
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid path"), nil
+	}
+	candidates := s.resolveCandidates(path)
+	if len(candidates) == 0 {
+		return codedErrorResult(types.ErrorCodeOutOfWorkspace, "Path resolves outside every workspace root: %s", path), nil
+	}
+	target := candidates[0]
+
+	result := types.IgnoreStatus{Path: s.displayPath(target.Path)}
+	if !isGitRepo(target.Root) {
+		result.Note = "Workspace is not a git repository"
+		return jsonResult(result)
+	}
+
+	// Exit status 1 means no pattern matched. Tracked files are never
+	// reported as ignored.
+	out, err := runGit(target.Root, "check-ignore", "-v", "--", target.Path)
+	var gitErr *gitError
+	if errors.As(err, &gitErr) && gitErr.exitCode == 1 {
+		return jsonResult(result)
+	}
+	if err != nil {
+		return errorResult("Failed to check ignore rules: %v", err), nil
+	}
+
+	match := checkIgnoreLine.FindStringSubmatch(strings.TrimSpace(out))
+	if match == nil {
+		return errorResult("Unexpected git check-ignore output: %q", out), nil
+	}
+	result.Source = match[1]
+	result.Line, _ = strconv.Atoi(match[2])
+	result.Pattern = match[3]
+	// In verbose mode git also reports the negated pattern that un-ignores a path
+	result.Ignored = !strings.HasPrefix(result.Pattern, "!")
+	return jsonResult(result)
+}
@@ -0,0 +1,130 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestCountStatus(t *testing.T) {
+	porcelain := "M  staged.go\n M unstaged.go\nMM both.go\nA  added.go\n?? new.go\n?? dir/\n"
+	staged, unstaged, untracked := countStatus(porcelain)
+	if staged != 3 || unstaged != 2 || untracked != 2 {
+		t.Errorf("countStatus() = %d, %d, %d; want 3, 2, 2", staged, unstaged, untracked)
+	}
+}
+
+func TestHandleGitStatus(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	s := &Server{config: Config{WorkspaceRoots: []string{root}}}
+	status := func() types.GitStatus {
+		result, err := s.handleGitStatus(nil)
+		if err != nil || result.IsError {
+			t.Fatalf("handleGitStatus failed: %v %+v", err, result)
+		}
+		var status types.GitStatus
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	if got := status(); got.IsGitRepo || got.Note == "" {
+		t.Errorf("handleGitStatus() outside a repository = %+v, want a note", got)
+	}
+
+	if out, err := exec.Command("git", "-C", root, "init", "-q", "-b", "trunk").CombinedOutput(); err != nil {
+		t.Skipf("git init failed: %v %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got := status()
+	if !got.IsGitRepo || got.Branch != "trunk" || got.Detached || got.Untracked != 1 {
+		t.Errorf("handleGitStatus() = %+v, want branch trunk with one untracked file", got)
+	}
+}
+
+func TestHandleGitContextWithoutCommits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Skipf("git init failed: %v %s", err, out)
+	}
+	filePath := filepath.Join(root, "a.go")
+	if err := os.WriteFile(filePath, []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", root, "add", "a.go").CombinedOutput(); err != nil {
+		t.Fatalf("git add failed: %v %s", err, out)
+	}
+
+	s := &Server{config: Config{WorkspaceRoots: []string{root}}}
+	result, err := s.handleGitContext(map[string]interface{}{"filePath": filePath})
+	if err != nil || result.IsError {
+		t.Fatalf("handleGitContext failed: %v %+v", err, result)
+	}
+	var got types.GitContext
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsGitRepo || got.Note == "" || got.LastCommit != nil {
+		t.Errorf("handleGitContext() in an empty repository = %+v, want a note and no commit", got)
+	}
+	if !strings.Contains(got.Diff, "+package a") {
+		t.Errorf("handleGitContext() diff = %q, want the staged file", got.Diff)
+	}
+}
+
+func TestHandleIsIgnored(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	s := &Server{config: Config{WorkspaceRoots: []string{root}}}
+	check := func(path string) types.IgnoreStatus {
+		result, err := s.handleIsIgnored(map[string]interface{}{"path": path})
+		if err != nil || result.IsError {
+			t.Fatalf("handleIsIgnored(%q) = %+v, %v", path, result, err)
+		}
+		var status types.IgnoreStatus
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	if got := check("build/out.o"); got.Ignored || got.Note == "" {
+		t.Errorf("handleIsIgnored() outside a repository = %+v, want a note", got)
+	}
+
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Skipf("git init failed: %v %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log\nbuild/\n!keep.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := check("build/out.o"); !got.Ignored || got.Pattern != "build/" || got.Source != ".gitignore" || got.Line != 2 {
+		t.Errorf("handleIsIgnored(build/out.o) = %+v, want ignored by build/ on .gitignore line 2", got)
+	}
+	if got := check(filepath.Join(root, "main.go")); got.Ignored || got.Pattern != "" {
+		t.Errorf("handleIsIgnored(main.go) = %+v, want not ignored", got)
+	}
+	if got := check("keep.log"); got.Ignored || got.Pattern != "!keep.log" {
+		t.Errorf("handleIsIgnored(keep.log) = %+v, want un-ignored by !keep.log", got)
+	}
+}
@@ -0,0 +1,108 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+// errOutsideWorkspace is returned when a closed file outside every workspace
+// root would have to be read from disk
+var errOutsideWorkspace = errors.New("file is not open and is outside the workspace")
+
+// contentHash returns the hex sha256 of content as Neovim holds it: without a
+// BOM, with LF line endings and without the final newline. Buffer and disk
+// content of an unchanged file therefore hash the same.
+func contentHash(content string) string {
+	content = strings.TrimSuffix(nvim.NormalizeContent(content), "\n")
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// currentFileHash hashes the file's buffer when it is open, and the file on
+// disk otherwise; a file that doesn't exist hashes as empty content.
+// It returns the hash and where the content came from.
+func (s *Server) currentFileHash(filePath string) (string, string, error) {
+	content, source, err := s.currentContent(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	return contentHash(content), source, nil
+}
+
+// currentContent returns the file's buffer content when it is open, and the
+// file on disk otherwise; a file that doesn't exist is empty. It also returns
+// where the content came from.
+func (s *Server) currentContent(filePath string) (string, string, error) {
+	contents, err := s.nvimClient.GetBufferContents([]string{filePath})
+	if err != nil {
+		return "", "", err
+	}
+	if len(contents) > 0 {
+		return contents[0].Content, "buffer", nil
+	}
+
+	if _, ok := s.workspaceRootFor(filePath); !ok {
+		return "", "", errOutsideWorkspace
+	}
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "disk", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return string(data), "disk", nil
+}
+
+// hashError converts a currentFileHash error into a tool result
+func hashError(filePath string, err error) *types.ToolCallResult {
+	if errors.Is(err, errOutsideWorkspace) {
+		return codedErrorResult(types.ErrorCodeOutOfWorkspace, "File is not open and is outside the workspace: %s", filePath)
+	}
+	return errorResult("Failed to hash %s: %v", filePath, err)
+}
+
+// handleGetFileHash handles the getFileHash tool call
+func (s *Server) handleGetFileHash(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+
+	hash, source, err := s.currentFileHash(filePath)
+	if err != nil {
+		return hashError(filePath, err), nil
+	}
+	return jsonResult(map[string]string{
+		"path":   s.displayPath(filePath),
+		"sha256": hash,
+		"source": source,
+	})
+}
+
+// checkExpectedHash returns a stale error result when expectedHash is set and
+// no longer matches the file, or nil when the operation may proceed
+func (s *Server) checkExpectedHash(filePath string, args map[string]interface{}) *types.ToolCallResult {
+	expected, _ := args["expectedHash"].(string)
+	if expected == "" {
+		return nil
+	}
+
+	hash, _, err := s.currentFileHash(filePath)
+	if err != nil {
+		return hashError(filePath, err)
+	}
+	if !strings.EqualFold(hash, expected) {
+		return codedErrorResult(types.ErrorCodeStale, "%s has changed since it was read (sha256 %s, expected %s)", filePath, hash, expected)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SendHeartbeat sends an ide/heartbeat notification carrying a monotonically
+// increasing sequence number, so clients can tell an idle server from a stuck one
+func (s *Server) SendHeartbeat() {
+	seq := atomic.AddUint64(&s.heartbeatSeq, 1)
+	params := map[string]interface{}{
+		"seq":       seq,
+		"timestamp": time.Now().UnixMilli(),
+	}
+	s.SendNotification("ide/heartbeat", params)
+}
+
+// RunHeartbeat sends a heartbeat every interval until the process exits.
+// A non-positive interval disables heartbeats.
+func (s *Server) RunHeartbeat(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.SendHeartbeat()
+	}
+}
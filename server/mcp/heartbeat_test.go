@@ -0,0 +1,24 @@
+package mcp
+
+import "testing"
+
+func TestSendHeartbeat(t *testing.T) {
+	sub := make(chan EventRecord, 2)
+	s := &Server{subscribers: []chan EventRecord{sub}}
+
+	s.SendHeartbeat()
+	s.SendHeartbeat()
+
+	for want := uint64(1); want <= 2; want++ {
+		notif := (<-sub).Notification
+		if notif.Method != "ide/heartbeat" {
+			t.Fatalf("SendHeartbeat() method = %q, want %q", notif.Method, "ide/heartbeat")
+		}
+		if got := notif.Params["seq"]; got != want {
+			t.Errorf("SendHeartbeat() seq = %v, want %v", got, want)
+		}
+		if ts, ok := notif.Params["timestamp"].(int64); !ok || ts <= 0 {
+			t.Errorf("SendHeartbeat() timestamp = %v, want a positive unix millisecond time", notif.Params["timestamp"])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gemini-cli/types"
+)
+
+// Bounds on the notifications kept for /events/history: at most
+// maxEventHistory records of at most maxEventHistoryBytes of JSON in total
+const (
+	maxEventHistory      = 100
+	maxEventHistoryBytes = 1 << 20
+)
+
+// EventRecord is a notification the server sent, as reported by /events/history
+type EventRecord struct {
+	ID           uint64                `json:"id"`
+	Timestamp    time.Time             `json:"timestamp"`
+	Notification types.MCPNotification `json:"notification"`
+
+	size int // encoded size of Notification, counted against maxEventHistoryBytes
+}
+
+// recordEvent appends a sent notification to the bounded history, evicting
+// the oldest records to stay within both bounds, and returns its record
+func (s *Server) recordEvent(notification types.MCPNotification) EventRecord {
+	size := 0
+	if data, err := json.Marshal(notification); err == nil {
+		size = len(data)
+	}
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	s.eventSeq++
+	record := EventRecord{ID: s.eventSeq, Timestamp: time.Now(), Notification: notification, size: size}
+
+	drop := 0
+	bytes := s.historyBytes
+	for drop < len(s.history) && (len(s.history)-drop >= maxEventHistory || bytes+size > maxEventHistoryBytes) {
+		bytes -= s.history[drop].size
+		drop++
+	}
+	if drop > 0 {
+		// Copy so the backing array doesn't grow forever
+		s.history = append(s.history[:0:0], s.history[drop:]...)
+		s.historyBytes = bytes
+	}
+	s.history = append(s.history, record)
+	s.historyBytes += size
+	return record
+}
+
+// eventsAfter returns the records still in the history whose ID is greater
+// than id, oldest first
+func (s *Server) eventsAfter(id uint64) []EventRecord {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	var records []EventRecord
+	for _, record := range s.history {
+		if record.ID > id {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// historyStats returns the number of records in the history and their size
+func (s *Server) historyStats() (records, bytes int) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	return len(s.history), s.historyBytes
+}
+
+// HandleEventHistory returns the most recent notifications as a JSON array, oldest first
+func (s *Server) HandleEventHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.historyMu.Lock()
+	history := make([]EventRecord, len(s.history))
+	copy(history, s.history)
+	s.historyMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,63 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleEventHistory(t *testing.T) {
+	s := &Server{}
+	for i := 0; i < maxEventHistory+5; i++ {
+		s.SendDiffRejected(fmt.Sprintf("/tmp/file%d.go", i))
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/events/history", nil)
+	rr := httptest.NewRecorder()
+	s.HandleEventHistory(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("HandleEventHistory() status code = %v, want %v", rr.Code, http.StatusOK)
+	}
+
+	var history []EventRecord
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != maxEventHistory {
+		t.Fatalf("HandleEventHistory() returned %d records, want %d", len(history), maxEventHistory)
+	}
+
+	// The oldest records were evicted; ids stay monotonic
+	if history[0].ID != 6 {
+		t.Errorf("HandleEventHistory() first id = %d, want 6", history[0].ID)
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].ID != history[i-1].ID+1 {
+			t.Errorf("HandleEventHistory() id %d follows %d, want consecutive ids", history[i].ID, history[i-1].ID)
+		}
+	}
+	last := history[len(history)-1]
+	if last.Notification.Method != "ide/diffRejected" || last.Timestamp.IsZero() {
+		t.Errorf("HandleEventHistory() last record = %+v, want a timestamped ide/diffRejected", last)
+	}
+}
+
+func TestRecordEventByteLimit(t *testing.T) {
+	s := &Server{}
+	payload := strings.Repeat("x", maxEventHistoryBytes/4)
+	for i := 0; i < 10; i++ {
+		s.SendNotification("test/large", map[string]interface{}{"payload": payload})
+	}
+
+	records, bytes := s.historyStats()
+	if bytes > maxEventHistoryBytes || records != 3 {
+		t.Errorf("history holds %d records of %d bytes, want the 3 newest within %d bytes", records, bytes, maxEventHistoryBytes)
+	}
+	if s.history[len(s.history)-1].ID != 10 {
+		t.Errorf("newest record id = %d, want 10", s.history[len(s.history)-1].ID)
+	}
+}
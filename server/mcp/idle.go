@@ -0,0 +1,47 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// touch records activity that resets the idle timeout
+func (s *Server) touch() {
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+// idleFor returns how long the server has been idle: no SSE subscribers and
+// no tool calls since the last recorded activity
+func (s *Server) idleFor(now time.Time) time.Duration {
+	s.mu.RLock()
+	subscribers := len(s.subscribers)
+	s.mu.RUnlock()
+	if subscribers > 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastActivity)))
+}
+
+// RunIdleTimeout calls onIdle once the server has been idle for timeout.
+// A non-positive timeout disables the check.
+func (s *Server) RunIdleTimeout(timeout time.Duration, onIdle func()) {
+	if timeout <= 0 {
+		return
+	}
+	s.touch()
+
+	// Check often enough that shutdown happens close to the deadline
+	interval := timeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if s.idleFor(now) >= timeout {
+			onIdle()
+			return
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package mcp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleFor(t *testing.T) {
+	s := &Server{}
+	s.touch()
+	later := time.Now().Add(time.Minute)
+
+	if got := s.idleFor(later); got < time.Minute {
+		t.Errorf("idleFor() without subscribers = %v, want at least %v", got, time.Minute)
+	}
+
+	s.subscribers = []chan EventRecord{make(chan EventRecord)}
+	if got := s.idleFor(later); got != 0 {
+		t.Errorf("idleFor() with a subscriber = %v, want 0", got)
+	}
+
+	s.subscribers = nil
+	s.touch()
+	if got := s.idleFor(time.Now()); got >= time.Minute {
+		t.Errorf("idleFor() after touch = %v, want the timer reset", got)
+	}
+}
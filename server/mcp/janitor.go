@@ -0,0 +1,35 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"time"
+
+	"gemini-cli/logger"
+)
+
+// logMemoryStats logs how much the subscriber list and event history hold
+func (s *Server) logMemoryStats() {
+	s.mu.RLock()
+	subscribers, capacity := len(s.subscribers), cap(s.subscribers)
+	s.mu.RUnlock()
+
+	records, bytes := s.historyStats()
+	logger.Debug("SSE subscribers: %d (capacity %d); event history: %d records, %d bytes", subscribers, capacity, records, bytes)
+}
+
+// RunJanitor logs memory stats every interval until the process exits, so
+// growth over a long session shows up in debug logs. A non-positive interval
+// disables it.
+func (s *Server) RunJanitor(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if logger.GetLevel() <= logger.DEBUG {
+			s.logMemoryStats()
+		}
+	}
+}
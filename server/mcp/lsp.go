@@ -0,0 +1,156 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+// maxWorkspaceSymbols caps the number of symbols returned by workspaceSymbols
+const maxWorkspaceSymbols = 200
+
+// handleWorkspaceSymbols handles the workspaceSymbols tool call
+func (s *Server) handleWorkspaceSymbols(args map[string]interface{}) (*types.ToolCallResult, error) {
+	query, ok := args["query"].(string)
+	if !ok {
+		return errorResult("Invalid query"), nil
+	}
+
+	symbols, err := s.nvimClient.WorkspaceSymbols(query, maxWorkspaceSymbols)
+	if errors.Is(err, nvim.ErrNoLSPClient) {
+		// Not an error for the model: there is simply nothing to search
+		return &types.ToolCallResult{
+			Content: []types.ContentBlock{
+				{Type: "text", Text: "[]"},
+				{Type: "text", Text: "No LSP client with workspace symbol support is attached"},
+			},
+		}, nil
+	}
+	if err != nil {
+		return errorResult("Failed to search workspace symbols: %v", err), nil
+	}
+
+	if symbols == nil {
+		symbols = []types.Symbol{}
+	}
+	for i := range symbols {
+		symbols[i].Path = s.displayPath(symbols[i].Path)
+	}
+	return jsonResult(symbols)
+}
+
+// handleGetEnclosingSymbol handles the getEnclosingSymbol tool call
+func (s *Server) handleGetEnclosingSymbol(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	symbol, err := s.nvimClient.EnclosingSymbol()
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to find enclosing symbol: %v", err), nil
+	}
+	symbol.Path = s.displayPath(symbol.Path)
+	return jsonResult(symbol)
+}
+
+// maxDocumentSymbols caps the number of symbols returned by getDocumentSymbols
+const maxDocumentSymbols = 500
+
+// handleGetDocumentSymbols handles the getDocumentSymbols tool call
+func (s *Server) handleGetDocumentSymbols(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+
+	outline, err := s.nvimClient.DocumentSymbols(filePath, maxDocumentSymbols)
+	if errors.Is(err, nvim.ErrBufferNotOpen) {
+		return codedErrorResult(types.ErrorCodeNotFound, "File is not open in Neovim: %s", filePath), nil
+	}
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get document symbols: %v", err), nil
+	}
+
+	outline.Path = s.displayPath(filePath)
+	if outline.Symbols == nil {
+		outline.Symbols = []types.DocumentSymbol{}
+	}
+	return jsonResult(outline)
+}
+
+// handleGetLspClients handles the getLspClients tool call
+func (s *Server) handleGetLspClients(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+
+	clients, err := s.nvimClient.LSPClients(filePath)
+	if errors.Is(err, nvim.ErrBufferNotOpen) {
+		return codedErrorResult(types.ErrorCodeNotFound, "File is not open in Neovim: %s", filePath), nil
+	}
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to list LSP clients: %v", err), nil
+	}
+
+	if clients == nil {
+		clients = []types.LSPClient{}
+	}
+	for i := range clients {
+		if clients[i].Capabilities == nil {
+			clients[i].Capabilities = []string{}
+		}
+	}
+	return jsonResult(clients)
+}
+
+// handleRenameSymbol handles the renameSymbol tool call
+func (s *Server) handleRenameSymbol(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+	line, ok := intArg(args, "line", 0)
+	if !ok || line < 1 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid line"), nil
+	}
+	column, ok := intArg(args, "column", 1)
+	if !ok || column < 1 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid column"), nil
+	}
+	newName, ok := args["newName"].(string)
+	if !ok || newName == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid newName"), nil
+	}
+
+	plan, err := s.nvimClient.PrepareRename(filePath, line, column, newName)
+	if errors.Is(err, nvim.ErrBufferNotOpen) {
+		return codedErrorResult(types.ErrorCodeNotFound, "File is not open in Neovim: %s", filePath), nil
+	}
+	if errors.Is(err, nvim.ErrNoLSPClient) {
+		return codedErrorResult(types.ErrorCodeUnsupported, "No LSP client with rename support is attached to %s", filePath), nil
+	}
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to rename symbol: %v", err), nil
+	}
+
+	// A rename can reach into dependencies; refuse it before anything is edited
+	for _, file := range plan.Files {
+		if _, ok := s.workspaceRootFor(file); !ok {
+			return codedErrorResult(types.ErrorCodeOutOfWorkspace, "Rename would change a file outside the workspace: %s", file), nil
+		}
+	}
+
+	unsaved, err := s.nvimClient.ApplyRename(plan.ID)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to apply rename: %v", err), nil
+	}
+	s.SendFilesChanged("rename", plan.Files, unsaved)
+
+	result := types.RenameResult{NewName: newName, Files: make([]string, 0, len(plan.Files))}
+	for _, file := range plan.Files {
+		result.Files = append(result.Files, s.displayPath(file))
+	}
+	for _, file := range unsaved {
+		result.Unsaved = append(result.Unsaved, s.displayPath(file))
+	}
+	return jsonResult(result)
+}
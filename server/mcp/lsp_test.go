@@ -0,0 +1,152 @@
+package mcp
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleGetDocumentSymbolsNotOpen(t *testing.T) {
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		return nil
+	})}
+
+	result, err := s.handleGetDocumentSymbols(map[string]interface{}{"filePath": "/tmp/missing.go"})
+	if err != nil || result.Code != types.ErrorCodeNotFound {
+		t.Errorf("handleGetDocumentSymbols = %+v, %v; want %q", result, err, types.ErrorCodeNotFound)
+	}
+}
+
+func TestHandleGetDocumentSymbols(t *testing.T) {
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		if limit := args[1].(int); limit != maxDocumentSymbols {
+			t.Errorf("limit = %d, want %d", limit, maxDocumentSymbols)
+		}
+		*result.(**types.DocumentOutline) = &types.DocumentOutline{
+			Source: "lsp",
+			Symbols: []types.DocumentSymbol{
+				{Name: "Server", Kind: "Struct", StartLine: 3, EndLine: 10},
+				{Name: "tools", Kind: "Field", StartLine: 4, EndLine: 4, Depth: 1},
+			},
+		}
+		return nil
+	})}
+
+	result, err := s.handleGetDocumentSymbols(map[string]interface{}{"filePath": "/tmp/server.go"})
+	if err != nil || result.IsError {
+		t.Fatalf("handleGetDocumentSymbols = %+v, %v", result, err)
+	}
+
+	var outline types.DocumentOutline
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &outline); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if outline.Path != "/tmp/server.go" || outline.Source != "lsp" || len(outline.Symbols) != 2 || outline.Symbols[1].Depth != 1 {
+		t.Errorf("handleGetDocumentSymbols() = %+v, want an lsp outline of /tmp/server.go with 2 symbols", outline)
+	}
+}
+
+func TestHandleGetLspClients(t *testing.T) {
+	var clients []types.LSPClient
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		if args[0] == "/tmp/missing.go" {
+			return nil
+		}
+		type lspClients = struct {
+			Clients []types.LSPClient `msgpack:"clients"`
+		}
+		*result.(**lspClients) = &lspClients{Clients: clients}
+		return nil
+	})}
+	list := func() []types.LSPClient {
+		result, err := s.handleGetLspClients(map[string]interface{}{"filePath": "/tmp/main.go"})
+		if err != nil || result.IsError {
+			t.Fatalf("handleGetLspClients = %+v, %v", result, err)
+		}
+		var got []types.LSPClient
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		return got
+	}
+
+	if result, _ := s.handleGetLspClients(map[string]interface{}{"filePath": "/tmp/missing.go"}); result.Code != types.ErrorCodeNotFound {
+		t.Errorf("handleGetLspClients(/tmp/missing.go) = %+v, want code %q", result, types.ErrorCodeNotFound)
+	}
+	if got := list(); got == nil || len(got) != 0 {
+		t.Errorf("handleGetLspClients() with no clients = %#v, want an empty list", got)
+	}
+
+	clients = []types.LSPClient{{ID: 1, Name: "gopls", Capabilities: []string{"definitionProvider", "renameProvider"}}}
+	if got := list(); len(got) != 1 || got[0].Name != "gopls" || len(got[0].Capabilities) != 2 {
+		t.Errorf("handleGetLspClients() = %+v, want gopls with 2 capabilities", got)
+	}
+}
+
+func TestHandleRenameSymbol(t *testing.T) {
+	root := t.TempDir()
+	var files []string
+	applied := false
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			if strings.Contains(code, "apply_rename") {
+				applied = true
+				return nil
+			}
+			type plan = struct {
+				Supported bool `msgpack:"supported"`
+				types.RenamePlan
+			}
+			if args[0] == "/tmp/plain.txt" {
+				*result.(**plan) = &plan{}
+				return nil
+			}
+			*result.(**plan) = &plan{Supported: true, RenamePlan: types.RenamePlan{ID: 1, Files: files}}
+			return nil
+		}),
+	}
+	rename := func(path string) *types.ToolCallResult {
+		result, err := s.handleRenameSymbol(map[string]interface{}{"filePath": path, "line": float64(3), "newName": "newName"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if result := rename("/tmp/plain.txt"); result.Code != types.ErrorCodeUnsupported || applied {
+		t.Errorf("handleRenameSymbol() without a rename provider = %+v, want code %q", result, types.ErrorCodeUnsupported)
+	}
+
+	files = []string{filepath.Join(root, "a.go"), "/usr/lib/go/src/fmt/print.go"}
+	if result := rename(filepath.Join(root, "a.go")); result.Code != types.ErrorCodeOutOfWorkspace || applied {
+		t.Errorf("handleRenameSymbol() leaving the workspace = %+v, want code %q", result, types.ErrorCodeOutOfWorkspace)
+	}
+
+	notifications := make(chan EventRecord, 1)
+	s.subscribers = append(s.subscribers, notifications)
+	files = []string{filepath.Join(root, "a.go"), filepath.Join(root, "b.go")}
+	result := rename(filepath.Join(root, "a.go"))
+	if result.IsError || !applied {
+		t.Fatalf("handleRenameSymbol() = %+v, want the rename applied", result)
+	}
+	var got types.RenameResult
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if got.NewName != "newName" || len(got.Files) != 2 || got.Files[1] != files[1] {
+		t.Errorf("handleRenameSymbol() = %+v, want newName across both workspace files", got)
+	}
+	select {
+	case record := <-notifications:
+		n := record.Notification
+		if paths, _ := n.Params["filePaths"].([]string); n.Method != "ide/filesChanged" || len(paths) != 2 {
+			t.Errorf("notification = %+v, want ide/filesChanged for both files", n)
+		}
+	default:
+		t.Error("renameSymbol sent no ide/filesChanged notification")
+	}
+}
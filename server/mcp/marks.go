@@ -0,0 +1,60 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+// isMarkLetter reports whether mark is one of the marks setMark may set: a
+// single letter, a-z for the buffer or A-Z for a file mark
+func isMarkLetter(mark string) bool {
+	return len(mark) == 1 && (mark[0] >= 'a' && mark[0] <= 'z' || mark[0] >= 'A' && mark[0] <= 'Z')
+}
+
+// handleGetMarks handles the getMarks tool call
+func (s *Server) handleGetMarks(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	marks, err := s.nvimClient.GetMarks()
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get marks: %v", err), nil
+	}
+	if marks == nil {
+		marks = []types.Mark{}
+	}
+	for i := range marks {
+		marks[i].Path = s.displayPath(marks[i].Path)
+	}
+	return jsonResult(marks)
+}
+
+// handleSetMark handles the setMark tool call
+func (s *Server) handleSetMark(args map[string]interface{}) (*types.ToolCallResult, error) {
+	mark, _ := args["mark"].(string)
+	if !isMarkLetter(mark) {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid mark %q: only letters a-z and A-Z can be set", mark), nil
+	}
+	filePath, ok := args["filePath"].(string)
+	if _, present := args["filePath"]; present && !ok {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+	line, ok := intArg(args, "line", 0)
+	if !ok || line < 1 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid line"), nil
+	}
+	column, ok := intArg(args, "column", 1)
+	if !ok || column < 1 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid column"), nil
+	}
+
+	result, err := s.nvimClient.SetMark(mark, filePath, line, column)
+	if errors.Is(err, nvim.ErrBufferNotOpen) {
+		return codedErrorResult(types.ErrorCodeNotFound, "File is not open in Neovim: %s", filePath), nil
+	}
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to set mark: %v", err), nil
+	}
+	result.Path = s.displayPath(result.Path)
+	return jsonResult(result)
+}
@@ -0,0 +1,35 @@
+package mcp
+
+import (
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleSetMarkRejectsSpecialMarks(t *testing.T) {
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		t.Errorf("Neovim called for an invalid mark")
+		return nil
+	})}
+
+	for _, mark := range []string{"", "'", ".", "0", "ab", "é"} {
+		result, err := s.handleSetMark(map[string]interface{}{"mark": mark, "line": float64(1)})
+		if err != nil || result.Code != types.ErrorCodeInvalidArgument {
+			t.Errorf("handleSetMark(%q) = %+v, %v; want %q", mark, result, err, types.ErrorCodeInvalidArgument)
+		}
+	}
+}
+
+func TestHandleGetMarksEmpty(t *testing.T) {
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		return nil
+	})}
+
+	result, err := s.handleGetMarks(nil)
+	if err != nil {
+		t.Fatalf("handleGetMarks failed: %v", err)
+	}
+	if result.IsError || result.Content[0].Text != "[]" {
+		t.Errorf("handleGetMarks() = %+v, want []", result)
+	}
+}
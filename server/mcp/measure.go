@@ -0,0 +1,80 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"gemini-cli/types"
+)
+
+// maxMeasureFileBytes caps the size of a file measureContent reads
+const maxMeasureFileBytes = 16 * 1024 * 1024
+
+// charsPerToken is the heuristic ratio estimateTokens uses
+const charsPerToken = 4
+
+// estimateTokens approximates the token count of text as one token per four
+// characters, rounded up
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// measure returns the size of text, counting tokens with Config.TokenCounter
+// when one is set
+func (s *Server) measure(text string) types.ContentMeasure {
+	m := types.ContentMeasure{
+		Bytes:      len(text),
+		Lines:      strings.Count(text, "\n"),
+		Characters: utf8.RuneCountInString(text),
+	}
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		m.Lines++ // unterminated last line
+	}
+	if s.config.TokenCounter != nil {
+		m.EstimatedTokens = s.config.TokenCounter(text)
+		m.Tokenizer = "custom"
+	} else {
+		m.EstimatedTokens = estimateTokens(text)
+		m.Tokenizer = "chars/4"
+	}
+	return m
+}
+
+// handleMeasureContent handles the measureContent tool call. A file is read
+// from disk only, so it must be in the workspace.
+func (s *Server) handleMeasureContent(args map[string]interface{}) (*types.ToolCallResult, error) {
+	text, hasText := args["text"].(string)
+	filePath, _ := args["filePath"].(string)
+	if hasText == (filePath != "") {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Pass exactly one of text or filePath"), nil
+	}
+	if hasText {
+		return jsonResult(s.measure(text))
+	}
+
+	if _, ok := s.workspaceRootFor(filePath); !ok {
+		return codedErrorResult(types.ErrorCodeOutOfWorkspace, "File is outside the workspace: %s", filePath), nil
+	}
+	info, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return codedErrorResult(types.ErrorCodeNotFound, "File not found: %s", filePath), nil
+	}
+	if err != nil {
+		return errorResult("Failed to read file: %v", err), nil
+	}
+	if info.Size() > maxMeasureFileBytes {
+		return codedErrorResult(types.ErrorCodeTooLarge, "File is %d bytes, over the %d byte limit", info.Size(), maxMeasureFileBytes), nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return errorResult("Failed to read file: %v", err), nil
+	}
+
+	m := s.measure(string(data))
+	m.Path = s.displayPath(filePath)
+	return jsonResult(m)
+}
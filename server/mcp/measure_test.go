@@ -0,0 +1,57 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleMeasureContent(t *testing.T) {
+	root := t.TempDir()
+	filePath := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(filePath, []byte("héllo\nworld\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{config: Config{WorkspaceRoots: []string{root}}}
+	measure := func(args map[string]interface{}) types.ContentMeasure {
+		result, err := s.handleMeasureContent(args)
+		if err != nil || result.IsError {
+			t.Fatalf("handleMeasureContent(%v) = %+v, %v", args, result, err)
+		}
+		var m types.ContentMeasure
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	got := measure(map[string]interface{}{"text": "héllo\nworld"})
+	if got.Bytes != 12 || got.Lines != 2 || got.Characters != 11 || got.EstimatedTokens != 3 || got.Tokenizer != "chars/4" {
+		t.Errorf("handleMeasureContent(text) = %+v, want 12 bytes, 2 lines, 11 characters, 3 chars/4 tokens", got)
+	}
+	if got := measure(map[string]interface{}{"text": ""}); got.Lines != 0 || got.EstimatedTokens != 0 {
+		t.Errorf("handleMeasureContent(empty text) = %+v, want zero lines and tokens", got)
+	}
+
+	got = measure(map[string]interface{}{"filePath": filePath})
+	if got.Path != filePath || got.Bytes != 13 || got.Lines != 2 {
+		t.Errorf("handleMeasureContent(filePath) = %+v, want %s with 13 bytes and 2 lines", got, filePath)
+	}
+
+	s.config.TokenCounter = func(text string) int { return 42 }
+	if got := measure(map[string]interface{}{"text": "x"}); got.EstimatedTokens != 42 || got.Tokenizer != "custom" {
+		t.Errorf("handleMeasureContent() with a TokenCounter = %+v, want 42 custom tokens", got)
+	}
+
+	for _, args := range []map[string]interface{}{{}, {"text": "x", "filePath": filePath}} {
+		if result, _ := s.handleMeasureContent(args); result.Code != types.ErrorCodeInvalidArgument {
+			t.Errorf("handleMeasureContent(%v) code = %q, want %q", args, result.Code, types.ErrorCodeInvalidArgument)
+		}
+	}
+	if result, _ := s.handleMeasureContent(map[string]interface{}{"filePath": "/etc/passwd"}); result.Code != types.ErrorCodeOutOfWorkspace {
+		t.Errorf("handleMeasureContent(/etc/passwd) code = %q, want %q", result.Code, types.ErrorCodeOutOfWorkspace)
+	}
+}
@@ -0,0 +1,69 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gemini-cli/logger"
+	"gemini-cli/types"
+)
+
+// redactedKeys are notification fields whose values can hold file content or
+// secrets; the notification log records only their size
+var redactedKeys = map[string]bool{
+	"authToken":    true,
+	"content":      true,
+	"newContent":   true,
+	"selectedText": true,
+}
+
+// redact returns a JSON value with the string values of redactedKeys replaced
+// by a placeholder
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if text, ok := field.(string); ok && redactedKeys[key] {
+				v[key] = fmt.Sprintf("<redacted %d bytes>", len(text))
+			} else {
+				v[key] = redact(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+	return value
+}
+
+// logNotification appends a notification, redacted, to Config.NotificationLog
+// as a line of JSON
+func (s *Server) logNotification(notification types.MCPNotification) {
+	if s.config.NotificationLog == nil {
+		return
+	}
+
+	// Round-trip through JSON so typed params can be walked generically
+	var params interface{}
+	if data, err := json.Marshal(notification.Params); err == nil {
+		_ = json.Unmarshal(data, &params)
+	}
+	line, err := json.Marshal(map[string]interface{}{
+		"timestamp": time.Now().Format(time.RFC3339Nano),
+		"method":    notification.Method,
+		"params":    redact(params),
+	})
+	if err != nil {
+		logger.Warn("Failed to encode notification for the log: %v", err)
+		return
+	}
+
+	s.notificationLogMu.Lock()
+	defer s.notificationLogMu.Unlock()
+	if _, err := s.config.NotificationLog.Write(append(line, '\n')); err != nil {
+		logger.Warn("Failed to write notification log: %v", err)
+	}
+}
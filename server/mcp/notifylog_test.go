@@ -0,0 +1,40 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestNotificationLogRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	s := &Server{config: Config{NotificationLog: &buf}}
+
+	selected := "secret selection"
+	s.SendContextUpdate(&types.IdeContext{WorkspaceState: &types.WorkspaceState{
+		OpenFiles: []types.File{{Path: "/tmp/a.go", SelectedText: &selected}},
+	}})
+	s.SendDiffAccepted("/tmp/a.go", "secret content")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("notification log has %d lines, want 2: %q", len(lines), buf.String())
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("notification log leaks redacted values: %s", buf.String())
+	}
+
+	var entry struct {
+		Method string                 `json:"method"`
+		Params map[string]interface{} `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Method != "ide/diffAccepted" || entry.Params["filePath"] != "/tmp/a.go" || entry.Params["content"] != "<redacted 14 bytes>" {
+		t.Errorf("notification log entry = %+v, want ide/diffAccepted for /tmp/a.go with redacted content", entry)
+	}
+}
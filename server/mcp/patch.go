@@ -0,0 +1,211 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+// hunkHeader matches a unified diff hunk header; omitted counts are 1
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// patchHunk is one hunk of a unified diff
+type patchHunk struct {
+	header   string
+	oldStart int // 1-based; for a pure insertion, the line the new lines follow
+	oldLines []string
+	newLines []string
+}
+
+// parsePatch parses the hunks of a unified diff for a single file. File
+// headers and other lines outside hunks are skipped.
+func parsePatch(patch string) ([]patchHunk, error) {
+	lines := strings.Split(nvim.NormalizeContent(patch), "\n")
+	var hunks []patchHunk
+	files := 0
+	for i := 0; i < len(lines); i++ {
+		m := hunkHeader.FindStringSubmatch(lines[i])
+		if m == nil {
+			if strings.HasPrefix(lines[i], "+++ ") {
+				if files++; files > 1 {
+					return nil, errors.New("patch changes more than one file")
+				}
+			}
+			continue
+		}
+
+		oldStart, _ := strconv.Atoi(m[1])
+		oldCount, newCount := 1, 1
+		if m[2] != "" {
+			oldCount, _ = strconv.Atoi(m[2])
+		}
+		if m[4] != "" {
+			newCount, _ = strconv.Atoi(m[4])
+		}
+
+		// Old start 0 only describes inserting at the top of the file
+		if oldStart == 0 && oldCount > 0 {
+			return nil, fmt.Errorf("hunk %d (%s) removes or keeps lines but starts at line 0", len(hunks)+1, m[0])
+		}
+
+		hunk := patchHunk{header: m[0], oldStart: oldStart}
+		for len(hunk.oldLines) < oldCount || len(hunk.newLines) < newCount {
+			i++
+			if i >= len(lines) {
+				return nil, fmt.Errorf("hunk %d (%s) ends early: expected %d old and %d new lines, got %d and %d",
+					len(hunks)+1, hunk.header, oldCount, newCount, len(hunk.oldLines), len(hunk.newLines))
+			}
+			line := lines[i]
+			switch {
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"; Neovim doesn't keep the final newline either
+			case line == "":
+				// A context line whose leading space was trimmed
+				hunk.oldLines = append(hunk.oldLines, "")
+				hunk.newLines = append(hunk.newLines, "")
+			case line[0] == ' ':
+				hunk.oldLines = append(hunk.oldLines, line[1:])
+				hunk.newLines = append(hunk.newLines, line[1:])
+			case line[0] == '-':
+				hunk.oldLines = append(hunk.oldLines, line[1:])
+			case line[0] == '+':
+				hunk.newLines = append(hunk.newLines, line[1:])
+			default:
+				return nil, fmt.Errorf("hunk %d (%s): unexpected line %q", len(hunks)+1, hunk.header, line)
+			}
+		}
+		if len(hunk.oldLines) != oldCount || len(hunk.newLines) != newCount {
+			return nil, fmt.Errorf("hunk %d (%s) has %d old and %d new lines, but its header says %d and %d",
+				len(hunks)+1, hunk.header, len(hunk.oldLines), len(hunk.newLines), oldCount, newCount)
+		}
+		hunks = append(hunks, hunk)
+	}
+	if len(hunks) == 0 {
+		return nil, errors.New("patch has no hunks")
+	}
+	return hunks, nil
+}
+
+// applyHunks applies hunks in order to content, returning the new content as
+// Neovim holds it: LF line endings and no final newline. A hunk whose old
+// lines have moved is applied at the nearest position where they match;
+// otherwise the error describes the failing hunk.
+func applyHunks(content string, hunks []patchHunk) (string, error) {
+	lines := contentLines(content)
+	var out []string
+	pos := 0 // index of the first line not yet copied to out
+	for n, hunk := range hunks {
+		want := hunk.oldStart - 1
+		if len(hunk.oldLines) == 0 {
+			want = hunk.oldStart // inserted after line oldStart
+		}
+		at := findHunk(lines, hunk.oldLines, want, pos)
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d (%s) does not apply: %s", n+1, hunk.header, hunkMismatch(lines, hunk.oldLines, want))
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, hunk.newLines...)
+		pos = at + len(hunk.oldLines)
+	}
+	out = append(out, lines[pos:]...)
+	return strings.Join(out, "\n"), nil
+}
+
+// findHunk returns the index nearest want, at or after from, where old
+// matches lines, or -1 if it matches nowhere
+func findHunk(lines, old []string, want, from int) int {
+	last := len(lines) - len(old)
+	if want < from {
+		want = from
+	}
+	if want > last {
+		want = last
+	}
+	for offset := 0; want-offset >= from || want+offset <= last; offset++ {
+		for _, at := range []int{want - offset, want + offset} {
+			if at >= from && at <= last && linesMatch(lines[at:at+len(old)], old) {
+				return at
+			}
+		}
+	}
+	return -1
+}
+
+// linesMatch reports whether a and b hold the same lines
+func linesMatch(a, b []string) bool {
+	for i := range b {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hunkMismatch describes why old doesn't match lines at the hunk's own position
+func hunkMismatch(lines, old []string, at int) string {
+	if at < 0 {
+		at = 0
+	}
+	for i, want := range old {
+		if at+i >= len(lines) {
+			return fmt.Sprintf("expected line %d to be %q, but the file has only %d lines", at+i+1, want, len(lines))
+		}
+		if lines[at+i] != want {
+			return fmt.Sprintf("expected line %d to be %q, found %q", at+i+1, want, lines[at+i])
+		}
+	}
+	return "its lines overlap an earlier hunk"
+}
+
+// handleApplyPatch handles the applyPatch tool call. The patch is applied to
+// the file's buffer when it is open, or the file on disk, and the result is
+// opened as a diff exactly like openDiff.
+func (s *Server) handleApplyPatch(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+	patch, ok := args["patch"].(string)
+	if !ok || patch == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid patch"), nil
+	}
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid patch: %v", err), nil
+	}
+
+	if stale := s.checkExpectedHash(filePath, args); stale != nil {
+		return stale, nil
+	}
+	content, _, err := s.currentContent(filePath)
+	if errors.Is(err, errOutsideWorkspace) {
+		return codedErrorResult(types.ErrorCodeOutOfWorkspace, "File is not open and is outside the workspace: %s", filePath), nil
+	}
+	if err != nil {
+		return errorResult("Failed to read %s: %v", filePath, err), nil
+	}
+
+	newContent, err := applyHunks(content, hunks)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeStale, "Patch does not apply to %s: %v", filePath, err), nil
+	}
+
+	// The diff is refused if the file changes between reading and opening it
+	openArgs := map[string]interface{}{
+		"filePath":     filePath,
+		"newContent":   newContent,
+		"expectedHash": contentHash(content),
+	}
+	for _, name := range []string{"language", "layout"} {
+		if v, ok := args[name]; ok {
+			openArgs[name] = v
+		}
+	}
+	return s.handleOpenDiff(openArgs)
+}
@@ -0,0 +1,129 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestApplyHunks(t *testing.T) {
+	content := "one\ntwo\nthree\nfour\nfive\n"
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "replace with headers",
+			patch: "--- a/f.txt\n+++ b/f.txt\n@@ -2,3 +2,3 @@\n two\n-three\n+THREE\n four\n",
+			want:  "one\ntwo\nTHREE\nfour\nfive",
+		},
+		{
+			name:  "two hunks with an insertion",
+			patch: "@@ -1,0 +2 @@\n+one and a half\n@@ -5 +6 @@\n-five\n+5\n",
+			want:  "one\none and a half\ntwo\nthree\nfour\n5",
+		},
+		{
+			name:  "moved hunk applies at an offset",
+			patch: "@@ -1,2 +1,2 @@\n three\n-four\n+4\n",
+			want:  "one\ntwo\nthree\n4\nfive",
+		},
+		{
+			name:  "trimmed context line and no newline marker",
+			patch: "@@ -4,2 +4,2 @@\n four\n-five\n\\ No newline at end of file\n+5\n\\ No newline at end of file\n",
+			want:  "one\ntwo\nthree\nfour\n5",
+		},
+		{
+			name:    "context mismatch",
+			patch:   "@@ -2,2 +2,2 @@\n two\n-tree\n+THREE\n",
+			wantErr: `hunk 1 (@@ -2,2 +2,2 @@) does not apply: expected line 3 to be "tree", found "three"`,
+		},
+		{
+			name:    "short hunk",
+			patch:   "@@ -2,3 +2,3 @@\n two\n-three\n",
+			wantErr: "ends early",
+		},
+		{
+			name:    "several files",
+			patch:   "+++ b/a\n@@ -1 +1 @@\n-one\n+1\n+++ b/b\n@@ -1 +1 @@\n-x\n+y\n",
+			wantErr: "more than one file",
+		},
+		{
+			name:    "old lines starting at line 0",
+			patch:   "@@ -0,1 +0,1 @@\n-x\n+y\n",
+			wantErr: "starts at line 0",
+		},
+		{
+			name:    "no hunks",
+			patch:   "--- a/f.txt\n+++ b/f.txt\n",
+			wantErr: "no hunks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := parsePatch(tt.patch)
+			var got string
+			if err == nil {
+				got, err = applyHunks(content, hunks)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("applied = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+	// A position before the first line is described from the first line
+	if got := hunkMismatch(contentLines(content), []string{"x"}, -1); !strings.Contains(got, `line 1 to be "x"`) {
+		t.Errorf("hunkMismatch(at -1) = %q, want it to describe line 1", got)
+	}
+}
+
+func TestHandleApplyPatch(t *testing.T) {
+	root := t.TempDir()
+	filePath := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(filePath, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var opened []interface{}
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			if strings.Contains(code, "open_diff") {
+				opened = args
+			}
+			return nil
+		}),
+	}
+
+	result, err := s.handleApplyPatch(map[string]interface{}{"filePath": filePath, "patch": "@@ -2 +2 @@\n-two\n+2\n"})
+	if err != nil || result.IsError {
+		t.Fatalf("handleApplyPatch = %+v, %v", result, err)
+	}
+	if len(opened) < 2 || opened[1] != "one\n2" {
+		t.Errorf("handleApplyPatch() opened %v, want a diff of %q", opened, "one\n2")
+	}
+	if _, ok := s.diffSession(filePath); !ok {
+		t.Error("diffSession() for the patched file = false, want true")
+	}
+
+	opened = nil
+	result, _ = s.handleApplyPatch(map[string]interface{}{"filePath": filePath, "patch": "@@ -2 +2 @@\n-deux\n+2\n"})
+	if result.Code != types.ErrorCodeStale || !strings.Contains(result.Content[0].Text, `"deux"`) || opened != nil {
+		t.Errorf("handleApplyPatch(mismatched context) = %+v, want a %q error naming the failing line", result, types.ErrorCodeStale)
+	}
+
+	result, _ = s.handleApplyPatch(map[string]interface{}{"filePath": filePath, "patch": "not a patch"})
+	if result.Code != types.ErrorCodeInvalidArgument {
+		t.Errorf("handleApplyPatch(no hunks) = %+v, want code %q", result, types.ErrorCodeInvalidArgument)
+	}
+}
@@ -0,0 +1,91 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gemini-cli/types"
+)
+
+// maxProjectFilesBytes caps the combined size of files returned by getProjectFiles
+const maxProjectFilesBytes = 256 * 1024
+
+// projectFiles is the allowlist of well-known configuration files that
+// getProjectFiles looks for at each workspace root
+var projectFiles = []string{
+	".editorconfig",
+	"CMakeLists.txt",
+	"Cargo.toml",
+	"Gemfile",
+	"Makefile",
+	"build.gradle",
+	"build.gradle.kts",
+	"composer.json",
+	"deno.json",
+	"go.mod",
+	"package.json",
+	"pom.xml",
+	"pyproject.toml",
+	"requirements.txt",
+	"setup.cfg",
+	"tsconfig.json",
+}
+
+// handleGetProjectFiles handles the getProjectFiles tool call
+func (s *Server) handleGetProjectFiles(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	if len(s.config.WorkspaceRoots) == 0 {
+		return codedErrorResult(types.ErrorCodeNotFound, "No workspace roots are configured"), nil
+	}
+
+	files := make(map[string]string)
+	var skipped []string
+	total := 0
+	for _, root := range s.config.WorkspaceRoots {
+		for _, name := range projectFiles {
+			path := filepath.Join(root, name)
+			// Only regular files: a symlink could point outside the workspace
+			info, err := os.Lstat(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil || !info.Mode().IsRegular() {
+				skipped = append(skipped, path)
+				continue
+			}
+			if total+int(info.Size()) > maxProjectFilesBytes {
+				skipped = append(skipped, path)
+				continue
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				skipped = append(skipped, path)
+				continue
+			}
+			total += len(data)
+
+			// Relative paths from different roots can collide; keep those absolute
+			key := s.displayPath(path)
+			if _, exists := files[key]; exists {
+				key = path
+			}
+			files[key] = string(data)
+		}
+	}
+
+	result, err := jsonResult(files)
+	if err != nil {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		result.Content = append(result.Content, types.ContentBlock{
+			Type: "text",
+			Text: "Skipped (unreadable, not a regular file, or over the size cap): " + strings.Join(skipped, ", "),
+		})
+	}
+	return result, nil
+}
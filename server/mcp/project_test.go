@@ -0,0 +1,46 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleGetProjectFiles(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret")
+	for name, content := range map[string]string{
+		"go.mod":    "module example\n",
+		"README.md": "not allowlisted\n",
+		"Makefile":  strings.Repeat("x", maxProjectFilesBytes+1),
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "package.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{config: Config{WorkspaceRoots: []string{root}, RelativePaths: true}}
+	result, err := s.handleGetProjectFiles(nil)
+	if err != nil {
+		t.Fatalf("handleGetProjectFiles failed: %v", err)
+	}
+
+	var files map[string]string
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files["go.mod"] != "module example\n" {
+		t.Errorf("handleGetProjectFiles() files = %v, want only go.mod", files)
+	}
+	if len(result.Content) != 2 || !strings.Contains(result.Content[1].Text, "Makefile") || !strings.Contains(result.Content[1].Text, "package.json") {
+		t.Errorf("handleGetProjectFiles() notes = %+v, want Makefile and package.json reported as skipped", result.Content[1:])
+	}
+}
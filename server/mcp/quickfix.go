@@ -0,0 +1,42 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"gemini-cli/types"
+)
+
+// handleGetQuickfix handles the getQuickfix tool call
+func (s *Server) handleGetQuickfix(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	entries, err := s.nvimClient.GetQuickfix()
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get quickfix list: %v", err), nil
+	}
+	return s.quickfixResult(entries)
+}
+
+// handleGetLocList handles the getLocList tool call
+func (s *Server) handleGetLocList(args map[string]interface{}) (*types.ToolCallResult, error) {
+	window, ok := intArg(args, "window", 0)
+	if !ok || window < 0 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid window"), nil
+	}
+
+	entries, err := s.nvimClient.GetLocList(window)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get location list: %v", err), nil
+	}
+	return s.quickfixResult(entries)
+}
+
+// quickfixResult renders list entries, always as a JSON array
+func (s *Server) quickfixResult(entries []types.QuickfixEntry) (*types.ToolCallResult, error) {
+	if entries == nil {
+		entries = []types.QuickfixEntry{}
+	}
+	for i := range entries {
+		if entries[i].Path != "" {
+			entries[i].Path = s.displayPath(entries[i].Path)
+		}
+	}
+	return jsonResult(entries)
+}
@@ -0,0 +1,17 @@
+package mcp
+
+import "testing"
+
+func TestHandleGetQuickfixEmpty(t *testing.T) {
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		return nil
+	})}
+
+	result, err := s.handleGetQuickfix(nil)
+	if err != nil {
+		t.Fatalf("handleGetQuickfix failed: %v", err)
+	}
+	if result.IsError || result.Content[0].Text != "[]" {
+		t.Errorf("handleGetQuickfix() = %+v, want []", result)
+	}
+}
@@ -0,0 +1,43 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+
+	"gemini-cli/types"
+)
+
+// defaultRecentFiles is how many files getRecentFiles returns by default
+const defaultRecentFiles = 20
+
+// handleGetRecentFiles handles the getRecentFiles tool call
+func (s *Server) handleGetRecentFiles(args map[string]interface{}) (*types.ToolCallResult, error) {
+	limit, ok := intArg(args, "limit", defaultRecentFiles)
+	if !ok || limit <= 0 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid limit"), nil
+	}
+
+	oldfiles, err := s.nvimClient.GetOldfiles()
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get recent files: %v", err), nil
+	}
+
+	files := []types.RecentFile{}
+	for _, path := range oldfiles {
+		if len(files) == limit {
+			break
+		}
+		path = filepath.Clean(path)
+		if _, ok := s.workspaceRootFor(path); !ok {
+			continue
+		}
+		// Oldfiles outlive the files they name
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, types.RecentFile{Path: s.displayPath(path), Timestamp: info.ModTime().Unix()})
+	}
+	return jsonResult(files)
+}
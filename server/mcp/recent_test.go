@@ -0,0 +1,54 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleGetRecentFiles(t *testing.T) {
+	root := t.TempDir()
+	first := filepath.Join(root, "a.go")
+	second := filepath.Join(root, "b.go")
+	for _, path := range []string{first, second} {
+		if err := os.WriteFile(path, []byte("package a\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := filepath.Join(t.TempDir(), "c.go")
+	if err := os.WriteFile(outside, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{root}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			*result.(*[]string) = []string{first, filepath.Join(root, "deleted.go"), outside, second}
+			return nil
+		}),
+	}
+
+	result, err := s.handleGetRecentFiles(map[string]interface{}{"limit": float64(1)})
+	if err != nil || result.IsError {
+		t.Fatalf("handleGetRecentFiles failed: %v %+v", err, result)
+	}
+	var files []types.RecentFile
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != first || files[0].Timestamp == 0 {
+		t.Errorf("handleGetRecentFiles() = %+v, want only %s", files, first)
+	}
+
+	result, _ = s.handleGetRecentFiles(nil)
+	files = nil
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[1].Path != second {
+		t.Errorf("handleGetRecentFiles() = %+v, want the existing workspace files ending with %s", files, second)
+	}
+}
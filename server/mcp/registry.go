@@ -0,0 +1,34 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+// RegisterTool adds a tool, or replaces the tool of the same name, and tells
+// SSE clients that the tool list changed
+func (s *Server) RegisterTool(tool Tool) {
+	s.mu.Lock()
+	if s.tools == nil {
+		s.tools = make(map[string]Tool)
+	}
+	s.tools[tool.Name] = tool
+	s.mu.Unlock()
+
+	s.SendToolsListChanged()
+}
+
+// UnregisterTool removes a tool and tells SSE clients that the tool list
+// changed. It reports whether the tool was registered.
+func (s *Server) UnregisterTool(name string) bool {
+	s.mu.Lock()
+	_, exists := s.tools[name]
+	delete(s.tools, name)
+	s.mu.Unlock()
+
+	if exists {
+		s.SendToolsListChanged()
+	}
+	return exists
+}
+
+// SendToolsListChanged sends a notifications/tools/list_changed notification
+func (s *Server) SendToolsListChanged() {
+	s.SendNotification("notifications/tools/list_changed", nil)
+}
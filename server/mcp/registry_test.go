@@ -0,0 +1,34 @@
+package mcp
+
+import (
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestRegisterToolNotifiesListChanged(t *testing.T) {
+	sub := make(chan EventRecord, 4)
+	s := &Server{subscribers: []chan EventRecord{sub}}
+
+	s.RegisterTool(Tool{Name: "dynamic", Handler: func(map[string]interface{}) (*types.ToolCallResult, error) {
+		return textResult("ok"), nil
+	}})
+	if _, ok := s.tools["dynamic"]; !ok {
+		t.Fatal("RegisterTool() did not add the tool")
+	}
+	if !s.UnregisterTool("dynamic") {
+		t.Error("UnregisterTool() = false for a registered tool")
+	}
+	if s.UnregisterTool("dynamic") {
+		t.Error("UnregisterTool() = true for an unknown tool")
+	}
+
+	if got := len(sub); got != 2 {
+		t.Fatalf("got %d notifications, want 2 (unknown tools must not notify)", got)
+	}
+	for i := 0; i < 2; i++ {
+		if notif := (<-sub).Notification; notif.Method != "notifications/tools/list_changed" {
+			t.Errorf("notification method = %q, want %q", notif.Method, "notifications/tools/list_changed")
+		}
+	}
+}
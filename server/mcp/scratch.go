@@ -0,0 +1,44 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"fmt"
+
+	"gemini-cli/types"
+)
+
+// handleShowScratch handles the showScratch tool call
+func (s *Server) handleShowScratch(args map[string]interface{}) (*types.ToolCallResult, error) {
+	title, ok := args["title"].(string)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid title"), nil
+	}
+	content, ok := args["content"].(string)
+	if !ok {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid content"), nil
+	}
+	filetype, _ := args["filetype"].(string)
+	buffer, ok := intArg(args, "buffer", 0)
+	if !ok || buffer < 0 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid buffer"), nil
+	}
+
+	bufnr, err := s.nvimClient.ShowScratch(title, content, filetype, buffer)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to show scratch buffer: %v", err), nil
+	}
+	return jsonResult(map[string]int{"buffer": bufnr})
+}
+
+// handleCloseScratch handles the closeScratch tool call
+func (s *Server) handleCloseScratch(args map[string]interface{}) (*types.ToolCallResult, error) {
+	buffer, ok := intArg(args, "buffer", 0)
+	if !ok || buffer <= 0 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid buffer"), nil
+	}
+
+	if err := s.nvimClient.CloseScratch(buffer); err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to close scratch buffer: %v", err), nil
+	}
+	return textResult(fmt.Sprintf("Closed scratch buffer %d", buffer)), nil
+}
@@ -0,0 +1,34 @@
+package mcp
+
+import (
+	"errors"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleShowScratchNotScratchBuffer(t *testing.T) {
+	// Lua raises with error(msg, 0), so the message carries no source position
+	var gotBuffer interface{}
+	s := &Server{
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			gotBuffer = args[3]
+			return errors.New("not a scratch buffer: 7")
+		}),
+	}
+
+	result, err := s.handleShowScratch(map[string]interface{}{"title": "plan", "content": "x", "buffer": float64(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotBuffer != 7 {
+		t.Errorf("handleShowScratch() buffer arg = %v, want 7", gotBuffer)
+	}
+	if !result.IsError || result.Code != types.ErrorCodeNvimError {
+		t.Fatalf("handleShowScratch() = %+v, want a %q error", result, types.ErrorCodeNvimError)
+	}
+	want := "Failed to show scratch buffer: failed to show scratch buffer: not a scratch buffer: 7"
+	if got := result.Content[0].Text; got != want {
+		t.Errorf("handleShowScratch() text = %q, want %q", got, want)
+	}
+}
@@ -2,43 +2,188 @@
 package mcp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"gemini-cli/logger"
 	"gemini-cli/nvim"
 	"gemini-cli/types"
 )
 
+// toolsPageSize is the number of tools returned per tools/list page
+const toolsPageSize = 50
+
+// DefaultMaxDiffBytes is the newContent limit used when Config.MaxDiffBytes is zero
+const DefaultMaxDiffBytes = 10 << 20
+
+// slowToolThreshold is the tool call duration above which a warning is logged
+const slowToolThreshold = 2 * time.Second
+
+// DefaultMaxRequestBytes is the request body limit used when
+// Config.MaxRequestBytes is zero
+const DefaultMaxRequestBytes = 4 << 20
+
+// Config holds optional server settings; zero values select the defaults
+type Config struct {
+	// CORSOrigin is sent as Access-Control-Allow-Origin (default "*")
+	CORSOrigin string
+	// WorkspaceRoots are the absolute workspace directories
+	WorkspaceRoots []string
+	// RelativePaths reports paths in tool results relative to their workspace root
+	RelativePaths bool
+	// ReadOnly refuses every mutating tool so clients can inspect but not modify
+	ReadOnly bool
+	// MaxRequestBytes caps the size of a request body (default DefaultMaxRequestBytes)
+	MaxRequestBytes int64
+	// SSEWriteTimeout bounds each write to an SSE client; a client that
+	// can't keep up is disconnected (default DefaultSSEWriteTimeout)
+	SSEWriteTimeout time.Duration
+	// MaxDiffBytes caps the newContent of a diff (default DefaultMaxDiffBytes);
+	// MaxRequestBytes still bounds the request carrying it
+	MaxDiffBytes int
+	// EnabledTools limits the registered tools to these names (default: all)
+	EnabledTools []string
+	// AllowedCommands lists the Ex commands runCommand may execute; an entry
+	// ending in "*" matches by prefix (default DefaultAllowedCommands)
+	AllowedCommands []string
+	// Instructions is sent in the initialize result to guide the model on
+	// how to use the server; omitted when empty
+	Instructions string
+	// AcceptOnSave makes :w in a diff buffer accept the diff; when false the
+	// plugin's allow_w_to_accept option decides
+	AcceptOnSave bool
+	// NotificationLog receives every outgoing notification, redacted, as a
+	// line of JSON (nil disables)
+	NotificationLog io.Writer
+	// StrictContentType rejects POST bodies not sent as application/json
+	// instead of decoding them anyway
+	StrictContentType bool
+	// MaxConcurrentToolCalls bounds how many tool calls run at once
+	// (default DefaultMaxConcurrentToolCalls)
+	MaxConcurrentToolCalls int
+	// RejectWhenBusy answers tool calls beyond MaxConcurrentToolCalls with a
+	// "server busy" error instead of queuing them
+	RejectWhenBusy bool
+	// TokenCounter counts the tokens of text for measureContent; nil uses
+	// the chars/4 heuristic of estimateTokens
+	TokenCounter func(text string) int
+}
+
 // Server implements the MCP HTTP server
 type Server struct {
 	authToken   string
 	nvimClient  *nvim.Client
+	config      Config
 	tools       map[string]Tool
 	mu          sync.RWMutex
-	subscribers []chan types.MCPNotification
+	subscribers []chan EventRecord
+
+	heartbeatSeq uint64 // accessed atomically
+	lastActivity int64  // unix nanoseconds, accessed atomically
+
+	diagnosticsChanged atomic.Bool // setDiagnosticsDisplay was used; restore on shutdown
+
+	bufMu       sync.Mutex
+	bufferTimer *time.Timer // pending coalesced context update
+
+	bufSubMu      sync.Mutex // serializes syncBufferSubscription
+	bufSubscribed bool       // Neovim is forwarding buffer changes
+
+	diffMu        sync.Mutex
+	diffs         map[string]*DiffSession // open diffs by file path
+	openDiffCalls map[string]bool         // in-flight openDiff requests by key, true once cancelled
+
+	realRootsOnce sync.Once
+	realRootsList []string // WorkspaceRoots with symlinks resolved
+
+	pathLocksMu sync.Mutex
+	pathLocks   map[string]*pathLock // serializes diff operations per file
+
+	toolSlotsOnce sync.Once
+	toolSlots     chan struct{} // one entry per running tool call
+
+	notificationLogMu sync.Mutex
+
+	historyMu    sync.Mutex
+	history      []EventRecord // most recent notifications, oldest first
+	historyBytes int           // total encoded size of history
+	eventSeq     uint64
+
+	startedAt time.Time
+
+	toolCallsMu sync.Mutex
+	toolCalls   map[string]int // calls per tool name, for serverStatus
+
+	clientMu           sync.RWMutex
+	clientInfo         types.ClientInfo
+	clientCapabilities map[string]interface{} // as sent in initialize
 }
 
 // Tool represents an MCP tool
 type Tool struct {
 	Name        string
 	Description string
+	InputSchema map[string]interface{}
 	Handler     func(map[string]interface{}) (*types.ToolCallResult, error)
+	// Mutating tools can change files or editor state and are refused in read-only mode
+	Mutating bool
 }
 
-// NewServer creates a new MCP server
-func NewServer(authToken string, nvimClient *nvim.Client) *Server {
+// NewServer creates a new MCP server. It fails if config.EnabledTools names
+// a tool that doesn't exist.
+func NewServer(authToken string, nvimClient *nvim.Client, config Config) (*Server, error) {
 	s := &Server{
 		authToken:   authToken,
 		nvimClient:  nvimClient,
+		config:      config,
 		tools:       make(map[string]Tool),
-		subscribers: make([]chan types.MCPNotification, 0),
+		subscribers: make([]chan EventRecord, 0),
+		startedAt:   time.Now(),
 	}
 	s.registerTools()
-	return s
+	if err := s.filterTools(config.EnabledTools); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// filterTools removes every registered tool not named in enabled; an empty
+// list keeps them all. Unknown names are an error.
+func (s *Server) filterTools(enabled []string) error {
+	if len(enabled) == 0 {
+		return nil
+	}
+
+	keep := make(map[string]bool, len(enabled))
+	var unknown []string
+	for _, name := range enabled {
+		if _, ok := s.tools[name]; !ok {
+			unknown = append(unknown, name)
+		}
+		keep[name] = true
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown tools: %s", strings.Join(unknown, ", "))
+	}
+
+	for name := range s.tools {
+		if !keep[name] {
+			delete(s.tools, name)
+		}
+	}
+	return nil
 }
 
 // registerTools registers all MCP tools
@@ -47,13 +192,56 @@ func (s *Server) registerTools() {
 	s.tools["openDiff"] = Tool{
 		Name:        "openDiff",
 		Description: "Open a diff view for a file",
-		Handler:     s.handleOpenDiff,
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath":     property("string", "Absolute path to the file"),
+			"newContent":   property("string", "New content for the file"),
+			"language":     property("string", "Neovim filetype for syntax highlighting (inferred from the extension if omitted)"),
+			"expectedHash": property("string", "sha256 from getFileHash; the diff is refused with code \"stale\" if the file has changed since"),
+			"layout":       property("string", "Where to show the diff: \"tab\", \"vertical\" or \"horizontal\" (the plugin's default placement if omitted)"),
+		}, "filePath", "newContent"),
+		Handler:  s.handleOpenDiff,
+		Mutating: true,
+	}
+
+	// Register applyWorkspaceEdit tool
+	s.tools["applyWorkspaceEdit"] = Tool{
+		Name:        "applyWorkspaceEdit",
+		Description: "Open a combined diff for several files; accepting applies all of them or none",
+		InputSchema: objectSchema(map[string]interface{}{
+			"edits": map[string]interface{}{
+				"type":        "array",
+				"description": "Files to change",
+				"items": objectSchema(map[string]interface{}{
+					"filePath":   property("string", "Absolute path to the file"),
+					"newContent": property("string", "New content for the file"),
+				}, "filePath", "newContent"),
+			},
+		}, "edits"),
+		Handler:  s.handleApplyWorkspaceEdit,
+		Mutating: true,
+	}
+
+	// Register acceptHunks tool
+	s.tools["acceptHunks"] = Tool{
+		Name:        "acceptHunks",
+		Description: "Apply only some hunks of an open diff, keeping the diff open for the rest",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to the file"),
+			"hunks": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]string{"type": "integer"},
+				"description": "0-based indices into the diff's current hunk layout",
+			},
+		}, "filePath", "hunks"),
+		Handler:  s.handleAcceptHunks,
+		Mutating: true,
 	}
 
 	// Register closeDiff tool
 	s.tools["closeDiff"] = Tool{
 		Name:        "closeDiff",
 		Description: "Close a diff view for a file",
+		InputSchema: diffToolSchema(),
 		Handler:     s.handleCloseDiff,
 	}
 
@@ -61,15 +249,500 @@ func (s *Server) registerTools() {
 	s.tools["acceptDiff"] = Tool{
 		Name:        "acceptDiff",
 		Description: "Accept diff changes and apply them to the original file",
-		Handler:     s.handleAcceptDiff,
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to the file"),
+			"encoding": property("string", "Character encoding to write the file in, named as for readFileRange, e.g. \"latin1\"; translated to the matching Neovim fileencoding (default: the buffer's fileencoding)"),
+		}, "filePath"),
+		Handler:  s.handleAcceptDiff,
+		Mutating: true,
 	}
 
 	// Register rejectDiff tool
 	s.tools["rejectDiff"] = Tool{
 		Name:        "rejectDiff",
 		Description: "Reject diff changes and close the diff view",
+		InputSchema: diffToolSchema(),
 		Handler:     s.handleRejectDiff,
 	}
+
+	// Register workspaceSymbols tool
+	s.tools["workspaceSymbols"] = Tool{
+		Name:        "workspaceSymbols",
+		Description: "Search LSP workspace symbols matching a query",
+		InputSchema: objectSchema(map[string]interface{}{
+			"query": property("string", "Symbol name or fragment to search for"),
+		}, "query"),
+		Handler: s.handleWorkspaceSymbols,
+	}
+
+	// Register getContextWindow tool
+	s.tools["getContextWindow"] = Tool{
+		Name:        "getContextWindow",
+		Description: "Get the lines around the cursor in an open file",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to the file"),
+			"radius":   property("integer", "Number of lines to include on each side of the cursor (default 50)"),
+		}, "filePath"),
+		Handler: s.handleGetContextWindow,
+	}
+
+	// Register getOpenFilesContent tool
+	s.tools["getOpenFilesContent"] = Tool{
+		Name:        "getOpenFilesContent",
+		Description: "Get the content of several open files in one call (all open files when filePaths is omitted)",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePaths": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]string{"type": "string"},
+				"description": "Absolute paths of the files to read",
+			},
+		}),
+		Handler: s.handleGetOpenFilesContent,
+	}
+
+	// Register gitContext tool
+	s.tools["gitContext"] = Tool{
+		Name:        "gitContext",
+		Description: "Get the last commit touching a file (or line range) and its uncommitted diff",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath":  property("string", "Absolute path to the file"),
+			"startLine": property("integer", "First line of the range (1-based, optional)"),
+			"endLine":   property("integer", "Last line of the range (1-based, inclusive, optional)"),
+		}, "filePath"),
+		Handler: s.handleGitContext,
+	}
+
+	// Register getContext tool
+	s.tools["getContext"] = Tool{
+		Name:        "getContext",
+		Description: "Get the current IDE context (open files, cursor, selection)",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGetContext,
+	}
+
+	// Register getNvimMessages tool
+	s.tools["getNvimMessages"] = Tool{
+		Name:        "getNvimMessages",
+		Description: "Get the most recent lines of Neovim's :messages log (useful after a failed tool call)",
+		InputSchema: objectSchema(map[string]interface{}{
+			"lines": property("integer", "Number of recent lines to return (default 50, max 500)"),
+		}),
+		Handler: s.handleGetNvimMessages,
+	}
+
+	// Register getOption tool
+	s.tools["getOption"] = Tool{
+		Name:        "getOption",
+		Description: "Get the value of a Neovim option (e.g. shiftwidth), optionally for a file's buffer",
+		InputSchema: objectSchema(map[string]interface{}{
+			"name":     property("string", "Option name"),
+			"filePath": property("string", "Absolute path of an open file, for buffer- or window-local options"),
+		}, "name"),
+		Handler: s.handleGetOption,
+	}
+
+	// Register setOption tool
+	s.tools["setOption"] = Tool{
+		Name:        "setOption",
+		Description: "Set an allowlisted Neovim option (indentation, wrapping, spelling, display)",
+		InputSchema: objectSchema(map[string]interface{}{
+			"name":     property("string", "Option name"),
+			"value":    map[string]interface{}{"type": []string{"boolean", "integer", "string"}, "description": "New value"},
+			"filePath": property("string", "Absolute path of an open file, for buffer- or window-local options"),
+		}, "name", "value"),
+		Handler:  s.handleSetOption,
+		Mutating: true,
+	}
+
+	// Register getRegister tool
+	s.tools["getRegister"] = Tool{
+		Name:        "getRegister",
+		Description: "Get the content of a Neovim register (default: the unnamed register)",
+		InputSchema: objectSchema(map[string]interface{}{
+			"register": property("string", "Register name, a single character"),
+		}),
+		Handler: s.handleGetRegister,
+	}
+
+	// Register confirm tool
+	s.tools["confirm"] = Tool{
+		Name:        "confirm",
+		Description: "Ask the user a Yes/No question in Neovim. Returns the choice: yes, no, cancelled or timeout",
+		InputSchema: objectSchema(map[string]interface{}{
+			"prompt":         property("string", "Question to show the user"),
+			"timeoutSeconds": property("integer", "Seconds to wait for an answer (default 60, max 600)"),
+		}, "prompt"),
+		Handler: s.handleConfirm,
+	}
+
+	// Register runCommand tool
+	s.tools["runCommand"] = Tool{
+		Name:        "runCommand",
+		Description: "Run an allowlisted Neovim Ex command (such as write or make) and return its output. make may not use shell metacharacters, and write/update may only name an absolute path inside the workspace, without backticks or wildcards",
+		InputSchema: objectSchema(map[string]interface{}{
+			"command": property("string", "Ex command to run, without the leading colon"),
+		}, "command"),
+		Handler:  s.handleRunCommand,
+		Mutating: true,
+	}
+
+	// Register getQuickfix tool
+	s.tools["getQuickfix"] = Tool{
+		Name:        "getQuickfix",
+		Description: "Get the entries of the quickfix list, such as build errors or search hits",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGetQuickfix,
+	}
+
+	// Register getLocList tool
+	s.tools["getLocList"] = Tool{
+		Name:        "getLocList",
+		Description: "Get the entries of a window's location list",
+		InputSchema: objectSchema(map[string]interface{}{
+			"window": property("integer", "Window ID (default: the current window)"),
+		}),
+		Handler: s.handleGetLocList,
+	}
+
+	// Register showScratch tool
+	s.tools["showScratch"] = Tool{
+		Name:        "showScratch",
+		Description: "Show text (an explanation, a plan, ...) in a throwaway Neovim buffer without touching any file. Returns the buffer id",
+		InputSchema: objectSchema(map[string]interface{}{
+			"title":    property("string", "Buffer title"),
+			"content":  property("string", "Text to show"),
+			"filetype": property("string", "Filetype for syntax highlighting, e.g. markdown"),
+			"buffer":   property("integer", "Scratch buffer id from an earlier call, to update it instead of opening a new one"),
+		}, "title", "content"),
+		Handler: s.handleShowScratch,
+	}
+
+	// Register closeScratch tool
+	s.tools["closeScratch"] = Tool{
+		Name:        "closeScratch",
+		Description: "Close a scratch buffer opened by showScratch",
+		InputSchema: objectSchema(map[string]interface{}{
+			"buffer": property("integer", "Scratch buffer id returned by showScratch"),
+		}, "buffer"),
+		Handler: s.handleCloseScratch,
+	}
+
+	// Register getProjectFiles tool
+	s.tools["getProjectFiles"] = Tool{
+		Name:        "getProjectFiles",
+		Description: "Get well-known project configuration files (go.mod, package.json, ...) from the workspace roots, as a map of path to content",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGetProjectFiles,
+	}
+
+	// Register getActiveBuffer tool
+	s.tools["getActiveBuffer"] = Tool{
+		Name:        "getActiveBuffer",
+		Description: "Get the buffer the user is looking at: its id, path, filetype and modified state",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGetActiveBuffer,
+	}
+
+	// Register setActiveBuffer tool
+	s.tools["setActiveBuffer"] = Tool{
+		Name:        "setActiveBuffer",
+		Description: "Switch to the open buffer for a file, focusing a window that already shows it",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to an open file"),
+		}, "filePath"),
+		Handler: s.handleSetActiveBuffer,
+	}
+
+	// Register readFileRange tool
+	s.tools["readFileRange"] = Tool{
+		Name:        "readFileRange",
+		Description: "Read a range of lines from a file, with line numbers. Uses the open buffer (including unsaved edits) when there is one, otherwise the file on disk. The range is clamped to the file. The result includes the file's sha256, the same hash getFileHash returns; pass it back as ifChangedFrom to get a short unchanged result instead of the lines when the file hasn't changed",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath":      property("string", "Absolute path to the file"),
+			"startLine":     property("integer", "First line to read, 1-based"),
+			"endLine":       property("integer", "Last line to read, 1-based and inclusive"),
+			"ifChangedFrom": property("string", "sha256 from an earlier read; when the file still has this hash, only {path, sha256, unchanged} is returned"),
+			"encoding":      property("string", "Character encoding of the file on disk, e.g. \"latin1\" or \"shift_jis\" (default utf-8); open buffers are already decoded using their fileencoding"),
+		}, "filePath", "startLine", "endLine"),
+		Handler: s.handleReadFileRange,
+	}
+
+	// Register getEnclosingSymbol tool
+	s.tools["getEnclosingSymbol"] = Tool{
+		Name:        "getEnclosingSymbol",
+		Description: "Get the function, method or class enclosing the cursor: its name, kind and line range. Falls back to the whole file when no LSP or tree-sitter symbol is found",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGetEnclosingSymbol,
+	}
+
+	// Register setDiagnosticsDisplay tool
+	s.tools["setDiagnosticsDisplay"] = Tool{
+		Name:        "setDiagnosticsDisplay",
+		Description: "Show or hide diagnostic virtual text and signs, e.g. to declutter a diff review. Returns the previous settings; the original settings are restored when the server shuts down",
+		InputSchema: objectSchema(map[string]interface{}{
+			"virtualText": property("boolean", "Show diagnostic virtual text (omit to leave unchanged)"),
+			"signs":       property("boolean", "Show diagnostic signs (omit to leave unchanged)"),
+		}),
+		Handler: s.handleSetDiagnosticsDisplay,
+	}
+
+	// Register getFileHash tool
+	s.tools["getFileHash"] = Tool{
+		Name:        "getFileHash",
+		Description: "Get the sha256 of a file's current content (its open buffer, or the file on disk), to detect changes before editing. Line endings, BOM and the final newline don't affect the hash",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to the file"),
+		}, "filePath"),
+		Handler: s.handleGetFileHash,
+	}
+
+	// Register getRecentFiles tool
+	s.tools["getRecentFiles"] = Tool{
+		Name:        "getRecentFiles",
+		Description: "List the files the user recently edited in Neovim (its oldfiles), most recent first. Only existing files inside the workspace are included, with their modification time",
+		InputSchema: objectSchema(map[string]interface{}{
+			"limit": property("integer", "Maximum number of files to return (default 20)"),
+		}),
+		Handler: s.handleGetRecentFiles,
+	}
+
+	// Register gitStatus tool
+	s.tools["gitStatus"] = Tool{
+		Name:        "gitStatus",
+		Description: "Get the current branch of the primary workspace root and how many files are staged, unstaged and untracked",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGitStatus,
+	}
+
+	// Register getMarks tool
+	s.tools["getMarks"] = Tool{
+		Name:        "getMarks",
+		Description: "List the lettered marks: a-z of the current buffer and the A-Z file marks, with their positions",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGetMarks,
+	}
+
+	// Register setMark tool
+	s.tools["setMark"] = Tool{
+		Name:        "setMark",
+		Description: "Set a mark so the user can jump back to a position (e.g. before making changes). Only letters can be set: a-z are local to the buffer, A-Z are global file marks",
+		InputSchema: objectSchema(map[string]interface{}{
+			"mark":     property("string", "Mark letter, a-z or A-Z"),
+			"filePath": property("string", "Absolute path to an open file (default: the current buffer)"),
+			"line":     property("integer", "Line to mark, 1-based"),
+			"column":   property("integer", "Column to mark, 1-based (default 1)"),
+		}, "mark", "line"),
+		Handler:  s.handleSetMark,
+		Mutating: true,
+	}
+
+	// Register getWorkspaceDiagnosticsSummary tool
+	s.tools["getWorkspaceDiagnosticsSummary"] = Tool{
+		Name:        "getWorkspaceDiagnosticsSummary",
+		Description: "Count the diagnostics of every open buffer by severity (error, warning, info, hint), with a grand total, for a quick overview of the project's health",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGetWorkspaceDiagnosticsSummary,
+	}
+
+	// Register getEditorConfig tool
+	s.tools["getEditorConfig"] = Tool{
+		Name:        "getEditorConfig",
+		Description: "Get a file's indentation and line ending settings (expandtab, shiftwidth, tabstop, fileformat, fileencoding) so new content matches its conventions. Returns the global settings when the file isn't open",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to the file"),
+		}, "filePath"),
+		Handler: s.handleGetEditorConfig,
+	}
+
+	// Register gotoNextDiagnostic tool
+	s.tools["gotoNextDiagnostic"] = Tool{
+		Name:        "gotoNextDiagnostic",
+		Description: "Move the cursor to the next diagnostic in the current buffer and return its position and message. Does not wrap around",
+		InputSchema: objectSchema(map[string]interface{}{
+			"severity": property("string", "Only stop at diagnostics of this severity: error, warning, info or hint"),
+		}),
+		Handler: s.handleGotoNextDiagnostic,
+	}
+
+	// Register gotoPrevDiagnostic tool
+	s.tools["gotoPrevDiagnostic"] = Tool{
+		Name:        "gotoPrevDiagnostic",
+		Description: "Move the cursor to the previous diagnostic in the current buffer and return its position and message. Does not wrap around",
+		InputSchema: objectSchema(map[string]interface{}{
+			"severity": property("string", "Only stop at diagnostics of this severity: error, warning, info or hint"),
+		}),
+		Handler: s.handleGotoPrevDiagnostic,
+	}
+
+	// Register getDocumentSymbols tool
+	s.tools["getDocumentSymbols"] = Tool{
+		Name:        "getDocumentSymbols",
+		Description: "Get the outline of an open file: its symbols (functions, classes, ...) in document order with their line ranges and nesting depth, from the language server or else tree-sitter",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to an open file"),
+		}, "filePath"),
+		Handler: s.handleGetDocumentSymbols,
+	}
+
+	// Register listFiles tool
+	s.tools["listFiles"] = Tool{
+		Name:        "listFiles",
+		Description: "List the files of each workspace root as relative paths, respecting .gitignore and skipping binary files, files over 1 MiB, and directories such as .git and node_modules. The result is marked truncated when more files matched than maxEntries",
+		InputSchema: objectSchema(map[string]interface{}{
+			"glob":       property("string", "Only list files matching this pattern (e.g. \"*.go\"); a pattern without a slash matches the file name, otherwise the relative path"),
+			"maxEntries": property("integer", "Maximum number of files to return (default 1000, at most 5000)"),
+		}),
+		Handler: s.handleListFiles,
+	}
+
+	// Register serverStatus tool
+	s.tools["serverStatus"] = Tool{
+		Name:        "serverStatus",
+		Description: "Report the server's own state for troubleshooting: uptime, tool call counts, open diffs, SSE subscribers, whether Neovim answers, and the effective configuration with the auth token redacted",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleServerStatus,
+	}
+
+	// Register getClipboard tool
+	s.tools["getClipboard"] = Tool{
+		Name:        "getClipboard",
+		Description: "Get the system clipboard through Neovim's clipboard register. Reports when Neovim has no clipboard provider",
+		InputSchema: objectSchema(map[string]interface{}{
+			"register": property("string", "Clipboard register: \"+\" (default) or \"*\" (the primary selection on X11)"),
+		}),
+		Handler: s.handleGetClipboard,
+	}
+
+	// Register setClipboard tool
+	s.tools["setClipboard"] = Tool{
+		Name:        "setClipboard",
+		Description: "Put text on the system clipboard through Neovim's clipboard register, to hand it to the user. Reports when Neovim has no clipboard provider",
+		InputSchema: objectSchema(map[string]interface{}{
+			"content":  property("string", "Text to copy"),
+			"register": property("string", "Clipboard register: \"+\" (default) or \"*\" (the primary selection on X11)"),
+		}, "content"),
+		Handler:  s.handleSetClipboard,
+		Mutating: true,
+	}
+
+	// Register diffPreview tool
+	s.tools["diffPreview"] = Tool{
+		Name:        "diffPreview",
+		Description: "Compute the changes newContent would make to a file on disk, without opening anything in Neovim, as hunks of {startLine, oldLines, newLines}. Use it to check a change before proposing it with openDiff; unsaved buffer edits are not considered",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath":   property("string", "Absolute path to a file in the workspace (it may not exist yet)"),
+			"newContent": property("string", "Proposed content for the file"),
+		}, "filePath", "newContent"),
+		Handler: s.handleDiffPreview,
+	}
+
+	// Register resolvePath tool
+	s.tools["resolvePath"] = Tool{
+		Name:        "resolvePath",
+		Description: "Turn a possibly relative path into the absolute path the other tools expect, resolved against the workspace roots, and report whether it exists. With several roots, the root where the path exists, or else the active file's root, wins; otherwise every candidate is returned. Paths outside every root are rejected",
+		InputSchema: objectSchema(map[string]interface{}{
+			"path": property("string", "Path relative to a workspace root, or absolute"),
+		}, "path"),
+		Handler: s.handleResolvePath,
+	}
+
+	// Register getNodeAt tool
+	s.tools["getNodeAt"] = Tool{
+		Name:        "getNodeAt",
+		Description: "Get the tree-sitter syntax node at a position of an open file: its type, exact range and text, for grammar-aware edits. Falls back to the position's line when no tree-sitter parser is available for the file",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to an open file"),
+			"line":     property("integer", "Line, 1-based"),
+			"column":   property("integer", "Byte column, 1-based (default 1)"),
+		}, "filePath", "line"),
+		Handler: s.handleGetNodeAt,
+	}
+
+	// Register isIgnored tool
+	s.tools["isIgnored"] = Tool{
+		Name:        "isIgnored",
+		Description: "Check whether git ignores a path in the workspace, e.g. before creating a file, and which pattern decides it. Tracked files are never ignored; outside a git repository the answer is false with a note",
+		InputSchema: objectSchema(map[string]interface{}{
+			"path": property("string", "Path relative to a workspace root, or absolute; it need not exist"),
+		}, "path"),
+		Handler: s.handleIsIgnored,
+	}
+
+	// Register getLspClients tool
+	s.tools["getLspClients"] = Tool{
+		Name:        "getLspClients",
+		Description: "List the language servers attached to an open file and the capabilities they advertise (definitionProvider, renameProvider, ...), to decide which LSP-backed tools will work",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to an open file"),
+		}, "filePath"),
+		Handler: s.handleGetLspClients,
+	}
+
+	// Register renameSymbol tool
+	s.tools["renameSymbol"] = Tool{
+		Name:        "renameSymbol",
+		Description: "Rename the symbol at a position across the workspace using the language server, saving the changed files, and return the files changed. Refused if any changed file is outside the workspace",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path to an open file"),
+			"line":     property("integer", "1-based line of the symbol"),
+			"column":   property("integer", "1-based byte column of the symbol (default 1)"),
+			"newName":  property("string", "New name for the symbol"),
+		}, "filePath", "line", "newName"),
+		Handler:  s.handleRenameSymbol,
+		Mutating: true,
+	}
+
+	// Register focusDiff tool
+	s.tools["focusDiff"] = Tool{
+		Name:        "focusDiff",
+		Description: "Bring an open diff's window to the foreground in Neovim, switching tabs if needed, to direct the user's attention when several diffs are open",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath": property("string", "Absolute path of the file whose diff to focus"),
+		}, "filePath"),
+		Handler: s.handleFocusDiff,
+	}
+
+	// Register measureContent tool
+	s.tools["measureContent"] = Tool{
+		Name:        "measureContent",
+		Description: "Measure text or a file before sending it: bytes, lines, characters and an approximate token count, to decide whether to split content into chunks",
+		InputSchema: objectSchema(map[string]interface{}{
+			"text":     property("string", "Text to measure"),
+			"filePath": property("string", "Absolute path to a workspace file to measure instead of text"),
+		}),
+		Handler: s.handleMeasureContent,
+	}
+
+	// Register applyPatch tool
+	s.tools["applyPatch"] = Tool{
+		Name:        "applyPatch",
+		Description: "Open a diff from a unified diff patch instead of the full new content. The patch is applied to the file's current content (the open buffer, or the file on disk) and the result is shown for review like openDiff. A patch that doesn't apply is refused with code \"stale\" and the failing hunk",
+		InputSchema: objectSchema(map[string]interface{}{
+			"filePath":     property("string", "Absolute path to the file"),
+			"patch":        property("string", "Unified diff for the file, e.g. from diff -u or git diff; hunk line numbers are 1-based"),
+			"language":     property("string", "Neovim filetype for syntax highlighting (inferred from the extension if omitted)"),
+			"expectedHash": property("string", "sha256 from getFileHash; the patch is refused with code \"stale\" if the file has changed since"),
+			"layout":       property("string", "Where to show the diff: \"tab\", \"vertical\" or \"horizontal\" (the plugin's default placement if omitted)"),
+		}, "filePath", "patch"),
+		Handler:  s.handleApplyPatch,
+		Mutating: true,
+	}
+
+	// Register getWordUnderCursor tool
+	s.tools["getWordUnderCursor"] = Tool{
+		Name:        "getWordUnderCursor",
+		Description: "Get the identifier under the cursor in the current window (Vim's <cword>) with its line and byte columns, plus the cursor's line for context. The word is empty when the cursor is on whitespace",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Handler:     s.handleGetWordUnderCursor,
+	}
+}
+
+// diffToolSchema returns the input schema shared by the diff tools
+func diffToolSchema() map[string]interface{} {
+	return objectSchema(map[string]interface{}{
+		"filePath":   property("string", "Absolute path to the file"),
+		"newContent": property("string", "New content for the file (for openDiff)"),
+	}, "filePath")
 }
 
 // handleOpenDiff handles the openDiff tool call
@@ -79,124 +752,213 @@ func (s *Server) handleOpenDiff(args map[string]interface{}) (*types.ToolCallRes
 	// Extract arguments
 	filePath, ok := args["filePath"].(string)
 	if !ok {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: "Invalid filePath"}},
-			IsError: true,
-		}, nil
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
 	}
 
 	newContent, ok := args["newContent"].(string)
 	if !ok {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: "Invalid newContent"}},
-			IsError: true,
-		}, nil
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid newContent"), nil
+	}
+	if tooLarge := s.checkDiffSize(filePath, newContent); tooLarge != nil {
+		return tooLarge, nil
+	}
+
+	layout, _ := args["layout"].(string)
+	switch layout {
+	case "", nvim.DiffLayoutTab, nvim.DiffLayoutVertical, nvim.DiffLayoutHorizontal:
+	default:
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid layout: must be tab, vertical or horizontal"), nil
+	}
+
+	defer s.lockPath(filePath)()
+
+	// Checked under the path lock so no other diff can change the file in between
+	if stale := s.checkExpectedHash(filePath, args); stale != nil {
+		return stale, nil
 	}
 
 	req.FilePath = filePath
 	req.NewContent = newContent
 
+	// Optional language hint, falling back to the file extension
+	req.Language, _ = args["language"].(string)
+	if req.Language == "" {
+		req.Language = filetypeForPath(req.FilePath)
+	}
+
 	// Call Neovim to open the diff
-	err := s.nvimClient.OpenDiff(req.FilePath, req.NewContent)
+	hunks, err := s.nvimClient.OpenDiff(req.FilePath, req.NewContent, req.Language, s.config.AcceptOnSave, layout)
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to open diff: %v", err), nil
+	}
+	s.startDiffSession(req.FilePath, hunks)
+
+	// Return the hunk layout so individual hunks can be accepted
+	if hunks == nil {
+		hunks = []types.Hunk{}
+	}
+	return jsonResult(map[string]interface{}{"hunks": hunks})
+}
+
+// handleApplyWorkspaceEdit handles the applyWorkspaceEdit tool call
+func (s *Server) handleApplyWorkspaceEdit(args map[string]interface{}) (*types.ToolCallResult, error) {
+	rawEdits, ok := args["edits"].([]interface{})
+	if !ok || len(rawEdits) == 0 {
+		return errorResult("Invalid edits"), nil
+	}
+
+	edits := make([]types.FileEdit, 0, len(rawEdits))
+	for i, raw := range rawEdits {
+		edit, _ := raw.(map[string]interface{})
+		filePath, ok := edit["filePath"].(string)
+		if !ok {
+			return errorResult("Invalid filePath in edit %d", i), nil
+		}
+		newContent, ok := edit["newContent"].(string)
+		if !ok {
+			return errorResult("Invalid newContent in edit %d", i), nil
+		}
+		if tooLarge := s.checkDiffSize(filePath, newContent); tooLarge != nil {
+			return tooLarge, nil
+		}
+		edits = append(edits, types.FileEdit{
+			FilePath:   filePath,
+			NewContent: newContent,
+			Filetype:   filetypeForPath(filePath),
+		})
+	}
+
+	filePaths := make([]string, len(edits))
+	for i, edit := range edits {
+		filePaths[i] = edit.FilePath
+	}
+	defer s.lockPaths(filePaths)()
+
+	results, err := s.nvimClient.OpenMultiDiff(edits, s.config.AcceptOnSave)
 	if err != nil {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: fmt.Sprintf("Failed to open diff: %v", err)}},
-			IsError: true,
-		}, nil
+		return errorResult("Failed to open workspace edit: %v", err), nil
+	}
+	for _, r := range results {
+		if r.Success {
+			s.startDiffSession(r.FilePath, nil)
+		}
 	}
 
-	// Return empty content on success
-	return &types.ToolCallResult{
-		Content: []types.ContentBlock{},
-		IsError: false,
-	}, nil
+	result, err := jsonResult(map[string]interface{}{"results": results})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if !r.Success {
+			result.IsError = true
+		}
+	}
+	return result, nil
 }
 
 // handleCloseDiff handles the closeDiff tool call
 func (s *Server) handleCloseDiff(args map[string]interface{}) (*types.ToolCallResult, error) {
 	filePath, ok := args["filePath"].(string)
 	if !ok {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: "Invalid filePath"}},
-			IsError: true,
-		}, nil
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
 	}
 
+	defer s.lockPath(filePath)()
+
 	// Call Neovim to close the diff and get final content
+	stats := s.diffStats(filePath)
 	content, err := s.nvimClient.CloseDiff(filePath)
 	if err != nil {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: fmt.Sprintf("Failed to close diff: %v", err)}},
-			IsError: true,
-		}, nil
+		return closeDiffError(filePath, err), nil
 	}
+	s.endDiffSession(filePath)
+
+	// Return the final content, then the stats of the closed diff
+	return textAndJSONResult(content, stats)
+}
 
-	// Return the final content
-	return &types.ToolCallResult{
-		Content: []types.ContentBlock{{Type: "text", Text: content}},
-		IsError: false,
-	}, nil
+// checkDiffSize returns a too_large error result when newContent exceeds
+// the diff size limit, before anything is sent to Neovim
+func (s *Server) checkDiffSize(filePath, newContent string) *types.ToolCallResult {
+	limit := s.config.MaxDiffBytes
+	if limit <= 0 {
+		limit = DefaultMaxDiffBytes
+	}
+	if len(newContent) > limit {
+		return codedErrorResult(types.ErrorCodeTooLarge, "newContent for %s is %d bytes, over the %d byte limit", filePath, len(newContent), limit)
+	}
+	return nil
+}
+
+// closeDiffError reports a failed closeDiff; Lua returns nil when the file
+// has no open diff
+func closeDiffError(filePath string, err error) *types.ToolCallResult {
+	var typeErr *nvim.ResultTypeError
+	if errors.As(err, &typeErr) && typeErr.Got == "nil" {
+		return codedErrorResult(types.ErrorCodeNotFound, "No open diff for %s", filePath)
+	}
+	return codedErrorResult(types.ErrorCodeNvimError, "Failed to close diff: %v", err)
 }
 
 // handleAcceptDiff handles the acceptDiff tool call
 func (s *Server) handleAcceptDiff(args map[string]interface{}) (*types.ToolCallResult, error) {
 	filePath, ok := args["filePath"].(string)
 	if !ok {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: "Invalid filePath"}},
-			IsError: true,
-		}, nil
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
 	}
 
+	// Neovim names encodings differently, so pass its name for the one that
+	// readFileRange decodes with
+	encodingName, _ := args["encoding"].(string)
+	if encodingName != "" {
+		vimName, err := vimEncoding(encodingName)
+		if err != nil {
+			return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid encoding: %v", err), nil
+		}
+		encodingName = vimName
+	}
+
+	defer s.lockPath(filePath)()
+
 	// Call Neovim to accept the diff
-	err := s.nvimClient.AcceptDiff(filePath)
+	stats := s.diffStats(filePath)
+	err := s.nvimClient.AcceptDiff(filePath, encodingName)
+	if errors.Is(err, nvim.ErrNotModifiable) {
+		return codedErrorResult(types.ErrorCodeNotModifiable, "Cannot apply the diff: the buffer for %s is not modifiable (readonly or 'nomodifiable')", filePath), nil
+	}
 	if err != nil {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: fmt.Sprintf("Failed to accept diff: %v", err)}},
-			IsError: true,
-		}, nil
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to accept diff: %v", err), nil
 	}
+	s.endDiffSession(filePath)
 
-	// Return empty content on success
-	return &types.ToolCallResult{
-		Content: []types.ContentBlock{},
-		IsError: false,
-	}, nil
+	return textAndJSONResult(describeDiff("Accepted", stats), stats)
 }
 
 // handleRejectDiff handles the rejectDiff tool call
 func (s *Server) handleRejectDiff(args map[string]interface{}) (*types.ToolCallResult, error) {
 	filePath, ok := args["filePath"].(string)
 	if !ok {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: "Invalid filePath"}},
-			IsError: true,
-		}, nil
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
 	}
 
+	defer s.lockPath(filePath)()
+
 	// Call Neovim to reject the diff
+	stats := s.diffStats(filePath)
 	err := s.nvimClient.RejectDiff(filePath)
 	if err != nil {
-		return &types.ToolCallResult{
-			Content: []types.ContentBlock{{Type: "text", Text: fmt.Sprintf("Failed to reject diff: %v", err)}},
-			IsError: true,
-		}, nil
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to reject diff: %v", err), nil
 	}
+	s.endDiffSession(filePath)
 
-	// Return empty content on success
-	return &types.ToolCallResult{
-		Content: []types.ContentBlock{},
-		IsError: false,
-	}, nil
+	return textAndJSONResult(describeDiff("Rejected", stats), stats)
 }
 
 // AuthMiddleware validates the Bearer token and handles CORS
 func (s *Server) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers for all responses
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept, X-Requested-With, Cache-Control")
+		s.setCORSHeaders(w)
 
 		// Handle preflight OPTIONS request
 		if r.Method == "OPTIONS" {
@@ -204,6 +966,14 @@ func (s *Server) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// Health probes send HEAD without credentials. The answer reveals
+		// nothing, so give it before the auth check, without reaching next.
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		expectedAuth := "Bearer " + s.authToken
 
@@ -216,6 +986,26 @@ func (s *Server) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// setAllowOrigin sets Access-Control-Allow-Origin from the configured origin
+func (s *Server) setAllowOrigin(w http.ResponseWriter) {
+	origin := s.config.CORSOrigin
+	if origin == "" {
+		origin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if origin != "*" {
+		// Responses differ per origin, so caches must key on it
+		w.Header().Add("Vary", "Origin")
+	}
+}
+
+// setCORSHeaders sets the CORS headers shared by all endpoints
+func (s *Server) setCORSHeaders(w http.ResponseWriter) {
+	s.setAllowOrigin(w)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept, X-Requested-With, Cache-Control")
+}
+
 // HandleMCP handles MCP requests
 func (s *Server) HandleMCP(w http.ResponseWriter, r *http.Request) {
 	// Check if this is an SSE connection request
@@ -229,19 +1019,48 @@ func (s *Server) HandleMCP(w http.ResponseWriter, r *http.Request) {
 	// Set Content-Type for JSON-RPC responses
 	w.Header().Set("Content-Type", "application/json")
 
+	// Proxies probe endpoints with HEAD; answer like a POST would, minus the body
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if s.config.StrictContentType && !isJSONContentType(r.Header.Get("Content-Type")) {
+		log.Printf("ERROR: Rejected request with Content-Type %q", r.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		s.sendError(w, nil, -32600, "Content-Type must be application/json")
+		return
+	}
+
 	var req types.MCPRequest
+	r.Body = s.limitBody(w, r.Body)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("ERROR: Request body exceeds %d bytes", tooLarge.Limit)
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			s.sendError(w, nil, -32600, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
 	log.Printf("Received MCP request: %s (ID: %v)", req.Method, req.ID)
 
+	// Streamable HTTP clients that only accept event streams get the
+	// response as a single SSE message; notifications have no response
+	if acceptsOnlyEventStream(r.Header.Get("Accept")) && !strings.HasPrefix(req.Method, "notifications/") {
+		sw := &sseResponseWriter{ResponseWriter: w}
+		defer sw.finish()
+		w = sw
+	}
+
 	// Handle different MCP methods
 	switch req.Method {
 	case "initialize":
@@ -249,77 +1068,149 @@ func (s *Server) HandleMCP(w http.ResponseWriter, r *http.Request) {
 	case "tools/list":
 		s.handleToolsList(w, &req)
 	case "tools/call":
-		s.handleToolsCall(w, &req)
+		s.handleToolsCall(r.Context(), w, &req)
+	case "roots/list":
+		s.handleRootsList(w, &req)
+	default:
+		if strings.HasPrefix(req.Method, "notifications/") {
+			s.handleNotification(w, &req)
+			return
+		}
+		s.sendError(w, req.ID, -32601, "Method not found")
+	}
+}
+
+// isJSONContentType reports whether a Content-Type header is application/json,
+// with any parameters such as charset
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// handleNotification acknowledges a client notification with 202 and no
+// body; notifications never get a JSON-RPC response, even when unknown
+func (s *Server) handleNotification(w http.ResponseWriter, req *types.MCPRequest) {
+	switch req.Method {
 	case "notifications/initialized":
 		// Vital for StreamableHTTPClientTransport: This signals the client to establish the SSE connection
-		w.WriteHeader(http.StatusAccepted)
+	case "notifications/cancelled":
+		log.Printf("Client cancelled request %v: %v", req.Params["requestId"], req.Params["reason"])
+		s.cancelDiffRequest(req.Params["requestId"])
+	case "notifications/roots/list_changed":
+		log.Printf("Client roots changed")
 	default:
-		s.sendError(w, req.ID, -32601, "Method not found")
+		logger.Debug("Ignoring notification %s", req.Method)
 	}
+	w.WriteHeader(http.StatusAccepted)
 }
 
 // handleInitialize handles MCP initialize request
 func (s *Server) handleInitialize(w http.ResponseWriter, req *types.MCPRequest) {
+	s.recordClient(req.Params)
+
+	result := map[string]interface{}{
+		"protocolVersion": "2025-06-18",
+		"serverInfo": map[string]interface{}{
+			"name":     "nvim-gemini-cli",
+			"version":  serverVersion,
+			"readOnly": s.config.ReadOnly,
+		},
+		"capabilities": s.capabilities(),
+	}
+	if s.config.Instructions != "" {
+		result["instructions"] = s.config.Instructions
+	}
+
 	response := types.MCPResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
-		Result: map[string]interface{}{
-			"protocolVersion": "2025-06-18",
-			"serverInfo": map[string]string{
-				"name":    "nvim-gemini-cli",
-				"version": "0.1.0",
-			},
-			"capabilities": map[string]interface{}{
-				"tools": map[string]bool{
-					"listChanged": false,
-				},
-			},
-		},
+		Result:  result,
 	}
 
 	_ = json.NewEncoder(w).Encode(response)
 }
 
-// handleToolsList handles MCP tools/list request
+// capabilities returns the capabilities to advertise in initialize, leaving
+// out features the configuration disables
+func (s *Server) capabilities() map[string]interface{} {
+	capabilities := map[string]interface{}{}
+
+	s.mu.RLock()
+	usable := 0
+	for _, tool := range s.tools {
+		if !tool.Mutating || !s.config.ReadOnly {
+			usable++
+		}
+	}
+	s.mu.RUnlock()
+	if usable > 0 {
+		capabilities["tools"] = map[string]bool{"listChanged": true}
+	}
+
+	if len(s.config.WorkspaceRoots) > 0 {
+		capabilities["roots"] = map[string]bool{"listChanged": true}
+	}
+	return capabilities
+}
+
+// handleToolsList handles MCP tools/list request.
+// Tools are listed in name order, toolsPageSize at a time; the opaque cursor
+// is the offset of the next page.
 func (s *Server) handleToolsList(w http.ResponseWriter, req *types.MCPRequest) {
+	offset := 0
+	if cursor, ok := req.Params["cursor"].(string); ok && cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			s.sendError(w, req.ID, -32602, "Invalid cursor")
+			return
+		}
+		offset = n
+	}
+
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.tools))
+	for name := range s.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	tools := make([]map[string]interface{}, 0, len(s.tools))
-	for _, tool := range s.tools {
+	if offset > len(names) {
+		offset = len(names)
+	}
+	end := offset + toolsPageSize
+	if end > len(names) {
+		end = len(names)
+	}
+
+	tools := make([]map[string]interface{}, 0, end-offset)
+	for _, name := range names[offset:end] {
+		tool := s.tools[name]
 		tools = append(tools, map[string]interface{}{
 			"name":        tool.Name,
 			"description": tool.Description,
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"filePath": map[string]string{
-						"type":        "string",
-						"description": "Absolute path to the file",
-					},
-					"newContent": map[string]string{
-						"type":        "string",
-						"description": "New content for the file (for openDiff)",
-					},
-				},
-				"required": []string{"filePath"},
-			},
+			"inputSchema": tool.InputSchema,
 		})
 	}
+	s.mu.RUnlock()
+
+	result := map[string]interface{}{
+		"tools": tools,
+	}
+	if end < len(names) {
+		result["nextCursor"] = strconv.Itoa(end)
+	}
 
 	response := types.MCPResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
-		Result: map[string]interface{}{
-			"tools": tools,
-		},
+		Result:  result,
 	}
 
 	_ = json.NewEncoder(w).Encode(response)
 }
 
 // handleToolsCall handles MCP tools/call request
-func (s *Server) handleToolsCall(w http.ResponseWriter, req *types.MCPRequest) {
+func (s *Server) handleToolsCall(ctx context.Context, w http.ResponseWriter, req *types.MCPRequest) {
 	toolName, ok := req.Params["name"].(string)
 	if !ok {
 		log.Printf("ERROR: Missing tool name in request")
@@ -342,8 +1233,46 @@ func (s *Server) handleToolsCall(w http.ResponseWriter, req *types.MCPRequest) {
 		args = make(map[string]interface{})
 	}
 
-	// Call the tool handler
+	if tool.Mutating && s.config.ReadOnly {
+		log.Printf("Refusing mutating tool %s in read-only mode", toolName)
+		_ = json.NewEncoder(w).Encode(types.MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result:  codedErrorResult(types.ErrorCodeReadOnly, "The server is read-only; %s is disabled", toolName),
+		})
+		return
+	}
+
+	release, err := s.acquireToolSlot(ctx, toolName)
+	if errors.Is(err, errServerBusy) {
+		log.Printf("Rejecting tool %s: too many concurrent tool calls", toolName)
+		s.sendError(w, req.ID, -32603, "Server busy: too many concurrent tool calls")
+		return
+	}
+	if err != nil {
+		// The client is gone, so running the tool now would act for nobody
+		log.Printf("Dropping tool %s: request ended while queued: %v", toolName, err)
+		s.sendError(w, req.ID, -32603, "Request ended while waiting for a tool slot")
+		return
+	}
+	defer release()
+
+	// Call the tool handler; tool calls count as activity for the idle timeout
+	s.countToolCall(toolName)
+	s.touch()
+	defer s.touch()
+	opensDiff := toolName == "openDiff" || toolName == "applyPatch"
+	if opensDiff {
+		s.beginOpenDiffCall(req.ID)
+	}
+	start := time.Now()
 	result, err := tool.Handler(args)
+	logToolDuration(toolName, time.Since(start), err != nil || (result != nil && result.IsError))
+	if opensDiff {
+		opened := err == nil && result != nil && !result.IsError
+		filePath, _ := args["filePath"].(string)
+		s.endOpenDiffCall(req.ID, filePath, opened)
+	}
 	if err != nil {
 		log.Printf("ERROR: Tool handler failed for %s: %v", toolName, err)
 		s.sendError(w, req.ID, -32603, err.Error())
@@ -366,13 +1295,13 @@ func (s *Server) SendNotification(method string, params map[string]interface{})
 		Method:  method,
 		Params:  params,
 	}
+	record := s.recordEvent(notification)
+	s.logNotification(notification)
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	for i, sub := range s.subscribers {
+	// Send to a snapshot so connects and disconnects never wait on the fan-out
+	for i, sub := range s.subscriberSnapshot() {
 		select {
-		case sub <- notification:
+		case sub <- record:
 			// Notification sent
 		default:
 			log.Printf("Warning: notification channel full for subscriber %d, dropping notification", i)
@@ -390,6 +1319,7 @@ func (s *Server) SendContextUpdate(context *types.IdeContext) {
 
 // SendDiffAccepted sends an ide/diffAccepted notification
 func (s *Server) SendDiffAccepted(filePath, content string) {
+	s.endDiffSession(filePath)
 	params := map[string]interface{}{
 		"filePath": filePath,
 		"content":  content,
@@ -399,12 +1329,54 @@ func (s *Server) SendDiffAccepted(filePath, content string) {
 
 // SendDiffRejected sends an ide/diffRejected notification
 func (s *Server) SendDiffRejected(filePath string) {
+	s.endDiffSession(filePath)
 	params := map[string]interface{}{
 		"filePath": filePath,
 	}
 	s.SendNotification("ide/diffRejected", params)
 }
 
+// SendFilesChanged sends an ide/filesChanged notification listing files the
+// server edited outside a diff, so clients can reconcile them. unsaved names
+// the ones left modified in Neovim rather than written to disk.
+func (s *Server) SendFilesChanged(reason string, filePaths, unsaved []string) {
+	if unsaved == nil {
+		unsaved = []string{}
+	}
+	s.SendNotification("ide/filesChanged", map[string]interface{}{
+		"reason":    reason,
+		"filePaths": filePaths,
+		"unsaved":   unsaved,
+	})
+}
+
+// SendShutdown sends an ide/shutdown notification. SSE streams end once
+// they have delivered it, so clients reconnect elsewhere instead of holding
+// the server open through its shutdown grace period.
+func (s *Server) SendShutdown(reason string) {
+	s.SendNotification("ide/shutdown", map[string]interface{}{
+		"reason": reason,
+	})
+}
+
+// logToolDuration logs how long a tool call took, as a warning when it was slow
+func logToolDuration(toolName string, elapsed time.Duration, failed bool) {
+	if elapsed > slowToolThreshold {
+		logger.Warn("Slow tool call: %s took %v (error=%v)", toolName, elapsed, failed)
+	} else if logger.GetLevel() <= logger.DEBUG {
+		logger.Debug("Tool call: %s took %v (error=%v)", toolName, elapsed, failed)
+	}
+}
+
+// limitBody caps how much of a request body handlers may read
+func (s *Server) limitBody(w http.ResponseWriter, body io.ReadCloser) io.ReadCloser {
+	limit := s.config.MaxRequestBytes
+	if limit <= 0 {
+		limit = DefaultMaxRequestBytes
+	}
+	return http.MaxBytesReader(w, body, limit)
+}
+
 // sendError sends an MCP error response
 func (s *Server) sendError(w http.ResponseWriter, id interface{}, code int, message string) {
 	response := types.MCPResponse{
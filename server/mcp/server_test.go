@@ -1,11 +1,16 @@
 package mcp
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
 )
 
 func TestAuthMiddleware(t *testing.T) {
@@ -62,6 +67,25 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 }
 
+func TestAuthMiddlewareHeadWithoutAuth(t *testing.T) {
+	s := &Server{authToken: "test-token"}
+	called := false
+	handler := s.AuthMiddleware(func(w http.ResponseWriter, _ *http.Request) {
+		called = true
+	})
+
+	req, _ := http.NewRequest(http.MethodHead, "/mcp", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || called {
+		t.Errorf("AuthMiddleware() HEAD without auth = %v (handler called: %v), want %v without the handler", rr.Code, called, http.StatusOK)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("AuthMiddleware() HEAD body = %q, want empty", rr.Body.String())
+	}
+}
+
 func TestHandleInitialize(t *testing.T) {
 	s := &Server{}
 	rr := httptest.NewRecorder()
@@ -86,4 +110,472 @@ func TestHandleInitialize(t *testing.T) {
 	if resp["id"].(float64) != 1 {
 		t.Errorf("HandleMCP(initialize) response id = %v, want 1", resp["id"])
 	}
+
+	if got := s.ClientInfo(); got.Name != "test-client" || got.Version != "1.0.0" {
+		t.Errorf("ClientInfo() = %+v, want test-client 1.0.0", got)
+	}
+}
+
+func TestHandleInitializeInstructions(t *testing.T) {
+	initialize := func(s *Server) map[string]interface{} {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`))
+		s.HandleMCP(rr, req)
+		var resp struct {
+			Result map[string]interface{} `json:"result"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Result
+	}
+
+	if result := initialize(&Server{}); result["instructions"] != nil {
+		t.Errorf("instructions = %v, want omitted", result["instructions"])
+	}
+	want := "Use openDiff to propose edits"
+	if result := initialize(&Server{config: Config{Instructions: want}}); result["instructions"] != want {
+		t.Errorf("instructions = %v, want %q", result["instructions"], want)
+	}
+}
+
+func TestCapabilitiesReflectConfig(t *testing.T) {
+	s, err := NewServer("test-token", nil, Config{WorkspaceRoots: []string{"/work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	capabilities := s.capabilities()
+	if capabilities["tools"] == nil || capabilities["roots"] == nil {
+		t.Errorf("capabilities() = %v, want tools and roots", capabilities)
+	}
+
+	// Read-only with only mutating tools enabled leaves no tools to call
+	s, err = NewServer("test-token", nil, Config{ReadOnly: true, EnabledTools: []string{"openDiff"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capabilities := s.capabilities(); len(capabilities) != 0 {
+		t.Errorf("capabilities() = %v, want none", capabilities)
+	}
+}
+
+func TestHandleInitializeClientCapabilities(t *testing.T) {
+	s := &Server{}
+	reqBody := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{"roots":{"listChanged":true}}}}`
+	req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(reqBody))
+
+	s.HandleMCP(httptest.NewRecorder(), req)
+
+	if !s.ClientSupports("roots") {
+		t.Errorf("ClientSupports(roots) = false, want true")
+	}
+	if s.ClientSupports("sampling") {
+		t.Errorf("ClientSupports(sampling) = true, want false")
+	}
+}
+
+func TestCORSOrigin(t *testing.T) {
+	tests := []struct {
+		name       string
+		origin     string
+		wantOrigin string
+		wantVary   string
+	}{
+		{
+			name:       "default allows any origin",
+			origin:     "",
+			wantOrigin: "*",
+			wantVary:   "",
+		},
+		{
+			name:       "specific origin is echoed with Vary",
+			origin:     "http://localhost:3000",
+			wantOrigin: "http://localhost:3000",
+			wantVary:   "Origin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{authToken: "test-token", config: Config{CORSOrigin: tt.origin}}
+
+			for _, path := range []string{"/mcp", "/events"} {
+				req, _ := http.NewRequest(http.MethodOptions, path, nil)
+				rr := httptest.NewRecorder()
+
+				if path == "/mcp" {
+					s.AuthMiddleware(s.HandleMCP).ServeHTTP(rr, req)
+				} else {
+					s.HandleSSE(rr, req)
+				}
+
+				if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+					t.Errorf("%s Access-Control-Allow-Origin = %q, want %q", path, got, tt.wantOrigin)
+				}
+				if got := rr.Header().Get("Vary"); got != tt.wantVary {
+					t.Errorf("%s Vary = %q, want %q", path, got, tt.wantVary)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleToolsListPagination(t *testing.T) {
+	const toolCount = 2*toolsPageSize + 7
+	s := &Server{tools: make(map[string]Tool)}
+	for i := 0; i < toolCount; i++ {
+		name := fmt.Sprintf("tool%03d", i)
+		s.tools[name] = Tool{Name: name, InputSchema: objectSchema(map[string]interface{}{})}
+	}
+
+	var names []string
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > toolCount {
+			t.Fatal("tools/list pagination did not terminate")
+		}
+
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": page, "method": "tools/list", "params": params})
+		req, _ := http.NewRequest("POST", "/mcp", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		s.HandleMCP(rr, req)
+
+		var resp struct {
+			Result struct {
+				Tools      []struct{ Name string } `json:"tools"`
+				NextCursor string                  `json:"nextCursor"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Result.Tools) > toolsPageSize {
+			t.Errorf("tools/list page %d has %d tools, want at most %d", page, len(resp.Result.Tools), toolsPageSize)
+		}
+		for _, tool := range resp.Result.Tools {
+			names = append(names, tool.Name)
+		}
+
+		cursor = resp.Result.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	if len(names) != toolCount {
+		t.Fatalf("tools/list returned %d tools across pages, want %d", len(names), toolCount)
+	}
+	for i, name := range names {
+		if want := fmt.Sprintf("tool%03d", i); name != want {
+			t.Errorf("tools/list tool %d = %q, want %q", i, name, want)
+		}
+	}
+}
+
+func TestHandleToolsListInvalidCursor(t *testing.T) {
+	s := &Server{tools: make(map[string]Tool)}
+	reqBody := `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{"cursor":"bogus"}}`
+	req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(reqBody))
+	rr := httptest.NewRecorder()
+
+	s.HandleMCP(rr, req)
+
+	var resp types.MCPResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("tools/list with invalid cursor error = %+v, want code -32602", resp.Error)
+	}
+}
+
+func TestDiffHandlerErrorCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(s *Server) func(map[string]interface{}) (*types.ToolCallResult, error)
+		args    map[string]interface{}
+		execErr error
+		want    string
+	}{
+		{
+			name:    "openDiff missing content",
+			handler: func(s *Server) func(map[string]interface{}) (*types.ToolCallResult, error) { return s.handleOpenDiff },
+			args:    map[string]interface{}{"filePath": "/tmp/a.go"},
+			want:    types.ErrorCodeInvalidArgument,
+		},
+		{
+			name:    "acceptDiff nvim failure",
+			handler: func(s *Server) func(map[string]interface{}) (*types.ToolCallResult, error) { return s.handleAcceptDiff },
+			args:    map[string]interface{}{"filePath": "/tmp/a.go"},
+			execErr: errFake,
+			want:    types.ErrorCodeNvimError,
+		},
+		{
+			name:    "acceptDiff readonly buffer",
+			handler: func(s *Server) func(map[string]interface{}) (*types.ToolCallResult, error) { return s.handleAcceptDiff },
+			args:    map[string]interface{}{"filePath": "/tmp/a.go"},
+			execErr: fmt.Errorf("exec lua: buffer is not modifiable: /tmp/a.go"),
+			want:    types.ErrorCodeNotModifiable,
+		},
+		{
+			name:    "acceptDiff nomodifiable buffer",
+			handler: func(s *Server) func(map[string]interface{}) (*types.ToolCallResult, error) { return s.handleAcceptDiff },
+			args:    map[string]interface{}{"filePath": "/tmp/a.go"},
+			execErr: fmt.Errorf("exec lua: E21: Cannot make changes, 'modifiable' is off"),
+			want:    types.ErrorCodeNotModifiable,
+		},
+		{
+			name:    "rejectDiff missing path",
+			handler: func(s *Server) func(map[string]interface{}) (*types.ToolCallResult, error) { return s.handleRejectDiff },
+			args:    map[string]interface{}{},
+			want:    types.ErrorCodeInvalidArgument,
+		},
+		{
+			name:    "closeDiff without open diff",
+			handler: func(s *Server) func(map[string]interface{}) (*types.ToolCallResult, error) { return s.handleCloseDiff },
+			args:    map[string]interface{}{"filePath": "/tmp/a.go"},
+			execErr: &nvim.ResultTypeError{Entrypoint: "gemini-cli.diff.close_diff", Expected: "string", Got: "nil"},
+			want:    types.ErrorCodeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+				return tt.execErr
+			})}
+
+			result, err := tt.handler(s)(tt.args)
+			if err != nil {
+				t.Fatalf("handler failed: %v", err)
+			}
+			if !result.IsError || result.Code != tt.want {
+				t.Errorf("%s code = %q (isError=%v), want %q", tt.name, result.Code, result.IsError, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadOnlyRefusesMutatingTools(t *testing.T) {
+	called := map[string]bool{}
+	handler := func(name string) func(map[string]interface{}) (*types.ToolCallResult, error) {
+		return func(map[string]interface{}) (*types.ToolCallResult, error) {
+			called[name] = true
+			return textResult("ok"), nil
+		}
+	}
+	s := &Server{
+		config: Config{ReadOnly: true},
+		tools: map[string]Tool{
+			"inspect": {Name: "inspect", Handler: handler("inspect")},
+			"modify":  {Name: "modify", Handler: handler("modify"), Mutating: true},
+		},
+	}
+
+	for _, name := range []string{"inspect", "modify"} {
+		reqBody := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":%q}}`, name)
+		req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(reqBody))
+		rr := httptest.NewRecorder()
+		s.HandleMCP(rr, req)
+
+		var resp struct {
+			Result types.ToolCallResult `json:"result"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		wantRefused := name == "modify"
+		if called[name] == wantRefused {
+			t.Errorf("%s: handler called = %v, want %v", name, called[name], !wantRefused)
+		}
+		if wantRefused && resp.Result.Code != types.ErrorCodeReadOnly {
+			t.Errorf("%s: code = %q, want %q", name, resp.Result.Code, types.ErrorCodeReadOnly)
+		}
+	}
+}
+
+func TestHandleMCPOversizedBody(t *testing.T) {
+	s := &Server{config: Config{MaxRequestBytes: 1024}, tools: make(map[string]Tool)}
+	padding := strings.Repeat("x", 2048)
+	reqBody := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{"cursor":%q}}`, padding)
+	req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(reqBody))
+	rr := httptest.NewRecorder()
+
+	s.HandleMCP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	var resp types.MCPResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != -32600 {
+		t.Errorf("oversized request error = %+v, want code -32600", resp.Error)
+	}
+}
+
+func TestHandleMCPContentType(t *testing.T) {
+	tests := []struct {
+		strict      bool
+		contentType string
+		wantStatus  int
+	}{
+		{false, "", http.StatusOK},
+		{false, "text/plain", http.StatusOK},
+		{true, "application/json", http.StatusOK},
+		{true, "application/json; charset=utf-8", http.StatusOK},
+		{true, "", http.StatusUnsupportedMediaType},
+		{true, "text/plain", http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		s := &Server{config: Config{StrictContentType: tt.strict}, tools: make(map[string]Tool)}
+		req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rr := httptest.NewRecorder()
+
+		s.HandleMCP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("strict=%v Content-Type %q: status = %d, want %d", tt.strict, tt.contentType, rr.Code, tt.wantStatus)
+			continue
+		}
+		var resp types.MCPResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if rejected := resp.Error != nil && resp.Error.Code == -32600; rejected != (tt.wantStatus != http.StatusOK) {
+			t.Errorf("strict=%v Content-Type %q: error = %+v", tt.strict, tt.contentType, resp.Error)
+		}
+	}
+}
+
+func TestNewServerEnabledTools(t *testing.T) {
+	s, err := NewServer("test-token", nil, Config{EnabledTools: []string{"getContext", "openDiff"}})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	if len(s.tools) != 2 {
+		t.Errorf("NewServer() registered %d tools, want 2", len(s.tools))
+	}
+	if _, ok := s.tools["getContext"]; !ok {
+		t.Errorf("NewServer() did not keep enabled tool getContext")
+	}
+
+	if _, err := NewServer("test-token", nil, Config{EnabledTools: []string{"getContext", "bogus"}}); err == nil || !strings.Contains(err.Error(), "bogus") {
+		t.Errorf("NewServer() with unknown tool error = %v, want it to name the tool", err)
+	}
+}
+
+func TestHandleMCPHead(t *testing.T) {
+	s := &Server{}
+	req, _ := http.NewRequest(http.MethodHead, "/mcp", nil)
+	rr := httptest.NewRecorder()
+
+	s.HandleMCP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("HandleMCP(HEAD) status code = %v, want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("HandleMCP(HEAD) Content-Type = %q, want application/json", got)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("HandleMCP(HEAD) body = %q, want empty", rr.Body.String())
+	}
+}
+
+func TestOpenDiffRejectsOversizedContent(t *testing.T) {
+	called := false
+	s := &Server{
+		config: Config{MaxDiffBytes: 16},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			called = true
+			return nil
+		}),
+	}
+
+	result, err := s.handleOpenDiff(map[string]interface{}{"filePath": "/tmp/a.go", "newContent": strings.Repeat("x", 17)})
+	if err != nil {
+		t.Fatalf("handleOpenDiff failed: %v", err)
+	}
+	if !result.IsError || result.Code != types.ErrorCodeTooLarge {
+		t.Errorf("handleOpenDiff() code = %q (isError=%v), want %q", result.Code, result.IsError, types.ErrorCodeTooLarge)
+	}
+	if called {
+		t.Error("handleOpenDiff() called Neovim for oversized content, want it refused first")
+	}
+}
+
+func TestOpenDiffLayout(t *testing.T) {
+	var passed []interface{}
+	s := &Server{
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			passed = args
+			return nil
+		}),
+	}
+
+	result, _ := s.handleOpenDiff(map[string]interface{}{"filePath": "/tmp/a.go", "newContent": "x", "layout": "floating"})
+	if !result.IsError || result.Code != types.ErrorCodeInvalidArgument || passed != nil {
+		t.Errorf("handleOpenDiff(layout=floating) = %+v (args %v), want %q before calling Neovim", result, passed, types.ErrorCodeInvalidArgument)
+	}
+
+	result, _ = s.handleOpenDiff(map[string]interface{}{"filePath": "/tmp/a.go", "newContent": "x", "layout": "tab"})
+	if result.IsError || len(passed) != 5 || passed[4] != "tab" {
+		t.Errorf("handleOpenDiff(layout=tab) = %+v with args %v, want the layout passed to Neovim", result, passed)
+	}
+}
+
+func TestHandleMCPUnknownNotification(t *testing.T) {
+	s := &Server{}
+	reqBody := `{"jsonrpc":"2.0","method":"notifications/progress","params":{"progressToken":1,"progress":50}}`
+	req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(reqBody))
+	rr := httptest.NewRecorder()
+
+	s.HandleMCP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("HandleMCP(notification) status code = %v, want %v", rr.Code, http.StatusAccepted)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("HandleMCP(notification) body = %q, want empty", rr.Body.String())
+	}
+}
+
+func TestHandleRootsList(t *testing.T) {
+	s := &Server{config: Config{WorkspaceRoots: []string{"/home/user/project", "/srv/my lib"}}}
+	reqBody := `{"jsonrpc":"2.0","id":1,"method":"roots/list"}`
+	req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(reqBody))
+	rr := httptest.NewRecorder()
+
+	s.HandleMCP(rr, req)
+
+	var resp struct {
+		Result struct {
+			Roots []Root `json:"roots"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []Root{
+		{URI: "file:///home/user/project", Name: "project"},
+		{URI: "file:///srv/my%20lib", Name: "my lib"},
+	}
+	if len(resp.Result.Roots) != len(want) {
+		t.Fatalf("roots/list returned %+v, want %+v", resp.Result.Roots, want)
+	}
+	for i := range want {
+		if resp.Result.Roots[i] != want[i] {
+			t.Errorf("roots/list root %d = %+v, want %+v", i, resp.Result.Roots[i], want[i])
+		}
+	}
 }
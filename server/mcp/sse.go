@@ -2,21 +2,41 @@
 package mcp
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"gemini-cli/types"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// DefaultSSEWriteTimeout bounds each SSE write when Config.SSEWriteTimeout is zero
+const DefaultSSEWriteTimeout = 10 * time.Second
+
+// minSubscribersCap is the spare subscriber capacity kept when compacting
+const minSubscribersCap = 4
+
 // HandleSSE handles Server-Sent Events connections
 func (s *Server) HandleSSE(w http.ResponseWriter, r *http.Request) {
+	// Handle preflight OPTIONS request without auth, like AuthMiddleware does for /mcp.
+	// The event-stream headers below only belong to the actual stream.
+	if r.Method == http.MethodOptions {
+		s.setCORSHeaders(w)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
 	// CRITICAL: Set headers FIRST, before any error checks
 	// This ensures clients get the correct content-type even if auth fails
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	s.setAllowOrigin(w)
 
 	// Check authentication AFTER setting headers
 	authHeader := r.Header.Get("Authorization")
@@ -32,37 +52,70 @@ func (s *Server) HandleSSE(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create notification channel for this connection
-	notifChan := make(chan types.MCPNotification, 10)
+	notifChan := make(chan EventRecord, 10)
 
 	s.mu.Lock()
 	s.subscribers = append(s.subscribers, notifChan)
 	s.mu.Unlock()
+	s.syncBufferSubscription()
 
-	// Remove subscriber when connection closes
+	// Remove subscriber when connection closes. The channel is left open: a
+	// broadcast may still hold it in its snapshot, and only this loop reads it.
 	defer func() {
 		s.mu.Lock()
-		for i, sub := range s.subscribers {
-			if sub == notifChan {
-				s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
-				break
-			}
-		}
+		s.removeSubscriber(notifChan)
 		s.mu.Unlock()
-		close(notifChan)
+		s.syncBufferSubscription()
+		s.touch()
 	}()
 
-	// Get Flusher for SSE
-	flusher, ok := w.(http.Flusher)
-	if !ok {
+	// Streaming needs a Flusher
+	if _, ok := w.(http.Flusher); !ok {
 		_, _ = fmt.Fprintf(w, "event: error\ndata: {\"error\":\"Streaming unsupported\"}\n\n")
 		return
 	}
 
 	log.Printf("SSE client connected")
 
+	// Writes carry a deadline so a stalled client is disconnected instead of
+	// blocking this goroutine while its notifications back up
+	rc := http.NewResponseController(w)
+
+	// Compress the stream when the client accepts gzip; each event is flushed
+	// through the compressor so it still arrives immediately
+	var out io.Writer = w
+	if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Add("Vary", "Accept-Encoding")
+		gz := gzip.NewWriter(w)
+		defer func() { _ = gz.Close() }()
+		out = gz
+	}
+
 	// Send an initial comment to keep connection alive
-	_, _ = fmt.Fprintf(w, ": connected\n\n")
-	flusher.Flush()
+	if err := s.writeEvent(out, rc, ": connected\n\n"); err != nil {
+		log.Printf("SSE write failed, disconnecting client: %v", err)
+		return
+	}
+
+	// A reconnecting client sends the id of the last event it saw; replay
+	// what it missed from the history. Events sent since this client
+	// subscribed may also be queued on notifChan, so skip ids already sent.
+	var lastSent uint64
+	if lastID, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		lastSent = lastID
+		for _, record := range s.eventsAfter(lastID) {
+			done, err := s.writeRecord(out, rc, record)
+			if err != nil {
+				log.Printf("SSE write failed, disconnecting client: %v", err)
+				return
+			}
+			lastSent = record.ID
+			if done {
+				return
+			}
+		}
+	}
 
 	// Send notifications to client
 	for {
@@ -70,14 +123,146 @@ func (s *Server) HandleSSE(w http.ResponseWriter, r *http.Request) {
 		case <-r.Context().Done():
 			log.Printf("SSE client disconnected")
 			return
-		case notif := <-notifChan:
-			data, err := json.Marshal(notif)
-			if err != nil {
-				log.Printf("Failed to marshal notification: %v", err)
+		case record := <-notifChan:
+			if record.ID <= lastSent {
 				continue
 			}
-			_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
+			done, err := s.writeRecord(out, rc, record)
+			if err != nil {
+				log.Printf("SSE write failed, disconnecting client: %v", err)
+				return
+			}
+			lastSent = record.ID
+			if done {
+				return
+			}
+		}
+	}
+}
+
+// writeRecord writes a notification as an SSE event whose id is its history
+// id, so the client can resume from it with Last-Event-ID. It reports whether
+// the stream should end because the notification announced a shutdown.
+func (s *Server) writeRecord(w io.Writer, rc *http.ResponseController, record EventRecord) (bool, error) {
+	data, err := json.Marshal(record.Notification)
+	if err != nil {
+		log.Printf("Failed to marshal notification: %v", err)
+		return false, nil
+	}
+	if err := s.writeEvent(w, rc, "id: %d\ndata: %s\n\n", record.ID, data); err != nil {
+		return false, err
+	}
+	if record.Notification.Method == "ide/shutdown" {
+		log.Printf("SSE stream closed for shutdown")
+		return true, nil
+	}
+	return false, nil
+}
+
+// removeSubscriber removes notifChan from the subscribers. The caller must
+// hold s.mu.
+func (s *Server) removeSubscriber(notifChan chan EventRecord) {
+	for i, sub := range s.subscribers {
+		if sub == notifChan {
+			last := len(s.subscribers) - 1
+			copy(s.subscribers[i:], s.subscribers[i+1:])
+			s.subscribers[last] = nil // don't keep the closed channel reachable
+			s.subscribers = s.subscribers[:last]
+			break
 		}
 	}
+
+	// Shrink the slice once most of its capacity is unused, so a burst of
+	// connections in a long session doesn't pin memory
+	if cap(s.subscribers) > 2*len(s.subscribers)+minSubscribersCap {
+		s.subscribers = append(make([]chan EventRecord, 0, len(s.subscribers)), s.subscribers...)
+	}
+}
+
+// subscriberSnapshot returns a copy of the subscribers, taken under a brief
+// read lock so notifications can be sent without holding s.mu
+func (s *Server) subscriberSnapshot() []chan EventRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]chan EventRecord(nil), s.subscribers...)
+}
+
+// writeEvent writes and flushes one SSE message within the write timeout
+func (s *Server) writeEvent(w io.Writer, rc *http.ResponseController, format string, v ...interface{}) error {
+	timeout := s.config.SSEWriteTimeout
+	if timeout <= 0 {
+		timeout = DefaultSSEWriteTimeout
+	}
+	if err := rc.SetWriteDeadline(time.Now().Add(timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, format, v...); err != nil {
+		return err
+	}
+	if gz, ok := w.(*gzip.Writer); ok {
+		if err := gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return rc.Flush()
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses it
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// acceptsOnlyEventStream reports whether an Accept header asks for
+// text/event-stream and doesn't also accept JSON
+func acceptsOnlyEventStream(accept string) bool {
+	eventStream := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "text/event-stream":
+			eventStream = true
+		case "application/json", "application/*", "*/*":
+			return false
+		}
+	}
+	return eventStream
+}
+
+// sseResponseWriter buffers a JSON-RPC response so finish can send it as a
+// one-shot SSE stream, as the Streamable HTTP transport allows for POSTs
+type sseResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *sseResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *sseResponseWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+// finish writes the buffered response as a single SSE message
+func (w *sseResponseWriter) finish() {
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.body.Len() == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w.ResponseWriter, "event: message\ndata: %s\n\n", bytes.TrimRight(w.body.Bytes(), "\n"))
 }
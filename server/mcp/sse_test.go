@@ -0,0 +1,351 @@
+package mcp
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandleSSEPreflight(t *testing.T) {
+	s := &Server{authToken: "test-token"}
+	rr := httptest.NewRecorder()
+
+	// Preflight requests carry no Authorization header
+	req, _ := http.NewRequest(http.MethodOptions, "/events", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+
+	s.HandleSSE(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("HandleSSE(OPTIONS) status code = %v, want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("HandleSSE(OPTIONS) Access-Control-Allow-Origin = %q, want %q", got, "*")
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got == "" {
+		t.Errorf("HandleSSE(OPTIONS) missing Access-Control-Allow-Headers")
+	}
+	if got := rr.Header().Get("Content-Type"); got == "text/event-stream" {
+		t.Errorf("HandleSSE(OPTIONS) Content-Type = %q, want no event-stream content type", got)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("HandleSSE(OPTIONS) body = %q, want empty", rr.Body.String())
+	}
+}
+
+func TestHandleSSEDisconnectsStalledClient(t *testing.T) {
+	s := &Server{authToken: "test-token", config: Config{SSEWriteTimeout: 50 * time.Millisecond}}
+	ts := httptest.NewServer(http.HandlerFunc(s.HandleSSE))
+	defer ts.Close()
+
+	// Connect and never read, so the server's socket buffers fill up
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = fmt.Fprintf(conn, "GET /events HTTP/1.1\r\nHost: test\r\nAuthorization: Bearer test-token\r\n\r\n")
+
+	subscribers := func() int {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return len(s.subscribers)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for subscribers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("SSE client never subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	payload := strings.Repeat("x", 1<<20)
+	for subscribers() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stalled SSE client was not disconnected")
+		}
+		s.SendNotification("test/flood", map[string]interface{}{"payload": payload})
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleSSEGzip(t *testing.T) {
+	s := &Server{authToken: "test-token"}
+	ts := httptest.NewServer(http.HandlerFunc(s.HandleSSE))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(gz)
+
+	// Each event must be readable as soon as it is sent, not when the stream ends
+	if line, err := reader.ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("first line = %q, %v; want the connected comment", line, err)
+	}
+	_, _ = reader.ReadString('\n')
+
+	s.SendNotification("test/event", nil)
+	if line, err := reader.ReadString('\n'); err != nil || line != "id: 1\n" {
+		t.Errorf("id line = %q, %v; want id: 1", line, err)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "data: ") || !strings.Contains(line, "test/event") {
+		t.Errorf("event line = %q, %v; want the notification", line, err)
+	}
+}
+
+func TestHandleSSEReplaysAfterLastEventID(t *testing.T) {
+	s := &Server{authToken: "test-token"}
+	for _, method := range []string{"test/one", "test/two", "test/three"} {
+		s.SendNotification(method, nil)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(s.HandleSSE))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	reader := bufio.NewReader(resp.Body)
+
+	// The missed events come first, then live ones without repeats
+	var events []string
+	for len(events) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "id: ") {
+			events = append(events, strings.TrimSpace(line))
+		}
+		if len(events) == 2 && strings.HasPrefix(line, "data: ") {
+			s.SendNotification("test/four", nil)
+		}
+	}
+	if want := []string{"id: 2", "id: 3", "id: 4"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events after Last-Event-ID 1 = %v, want %v", events, want)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"deflate, gzip;q=1": true,
+		"br, GZIP":          true,
+		"gzip;q=0":          false,
+		"identity":          false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestHandleMCPEventStreamResponse(t *testing.T) {
+	s := &Server{tools: map[string]Tool{}}
+	post := func(accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"tools/list"}`))
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		s.HandleMCP(rr, req)
+		return rr
+	}
+
+	rr := post("text/event-stream")
+	if got := rr.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "event: message\ndata: {") || !strings.HasSuffix(body, "}\n\n") || !strings.Contains(body, `"id":7`) {
+		t.Errorf("body = %q, want one SSE message carrying the response", body)
+	}
+
+	// Clients that accept JSON keep getting plain JSON
+	rr = post("application/json, text/event-stream")
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+}
+
+func TestAcceptsOnlyEventStream(t *testing.T) {
+	tests := map[string]bool{
+		"":                                    false,
+		"text/event-stream":                   true,
+		"Text/Event-Stream; charset=utf-8":    true,
+		"application/json, text/event-stream": false,
+		"text/event-stream, */*;q=0.1":        false,
+		"application/json":                    false,
+	}
+	for accept, want := range tests {
+		if got := acceptsOnlyEventStream(accept); got != want {
+			t.Errorf("acceptsOnlyEventStream(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestRemoveSubscriberCompacts(t *testing.T) {
+	s := &Server{}
+	subs := make([]chan EventRecord, 64)
+	for i := range subs {
+		subs[i] = make(chan EventRecord)
+		s.subscribers = append(s.subscribers, subs[i])
+	}
+
+	for _, sub := range subs[1:] {
+		s.removeSubscriber(sub)
+	}
+	if len(s.subscribers) != 1 || s.subscribers[0] != subs[0] {
+		t.Fatalf("subscribers = %v, want only the first", s.subscribers)
+	}
+	if cap(s.subscribers) > 2+minSubscribersCap {
+		t.Errorf("cap(subscribers) = %d after disconnects, want it compacted", cap(s.subscribers))
+	}
+}
+
+func TestBroadcastWhileSubscribersChurn(t *testing.T) {
+	s := &Server{authToken: "test-token"}
+
+	stop := make(chan struct{})
+	broadcasting := make(chan struct{})
+	go func() {
+		defer close(broadcasting)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				s.SendNotification("test/event", nil)
+			}
+		}
+	}()
+
+	// Clients connect and hang up while notifications fan out to them
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/events", nil)
+				req.Header.Set("Authorization", "Bearer test-token")
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					s.HandleSSE(httptest.NewRecorder(), req)
+				}()
+				time.Sleep(time.Duration(j%3) * time.Millisecond)
+				cancel()
+				<-done
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(30 * time.Second):
+		t.Fatal("subscribers stalled while broadcasting")
+	}
+	close(stop)
+	<-broadcasting
+
+	if n := len(s.subscriberSnapshot()); n != 0 {
+		t.Errorf("subscribers = %d after every client disconnected, want 0", n)
+	}
+}
+
+func TestHandleSSEEndsAfterShutdown(t *testing.T) {
+	s := &Server{authToken: "test-token"}
+	ts := httptest.NewServer(http.HandlerFunc(s.HandleSSE))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	reader := bufio.NewReader(resp.Body)
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SendShutdown("test")
+
+	// The stream delivers the event, then ends without the client hanging up
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading the stream failed: %v", err)
+	}
+	if !strings.Contains(string(body), `"method":"ide/shutdown"`) || !strings.Contains(string(body), `"reason":"test"`) {
+		t.Errorf("HandleSSE() after SendShutdown body = %q, want an ide/shutdown event", body)
+	}
+}
+
+func TestSyncBufferSubscription(t *testing.T) {
+	var calls []string
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		if strings.Contains(code, "unsubscribe_changes") {
+			calls = append(calls, "unsubscribe")
+		} else if strings.Contains(code, "subscribe_changes") {
+			calls = append(calls, "subscribe")
+		}
+		return nil
+	})}
+	sub := make(chan EventRecord)
+
+	// A connect and disconnect whose syncs run late only apply the final state
+	s.subscribers = append(s.subscribers, sub)
+	s.removeSubscriber(sub)
+	s.syncBufferSubscription()
+	s.syncBufferSubscription()
+	if len(calls) != 0 {
+		t.Errorf("calls after a connect and disconnect = %v, want none", calls)
+	}
+
+	s.subscribers = append(s.subscribers, sub)
+	s.syncBufferSubscription()
+	s.syncBufferSubscription()
+	s.removeSubscriber(sub)
+	s.syncBufferSubscription()
+	if want := []string{"subscribe", "unsubscribe"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,125 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+// serverVersion is reported in initialize and serverStatus
+const serverVersion = "0.1.0"
+
+// statusPingTimeout bounds the Neovim round trip made by serverStatus
+const statusPingTimeout = time.Second
+
+// countToolCall records a call of the named tool for serverStatus
+func (s *Server) countToolCall(name string) {
+	s.toolCallsMu.Lock()
+	defer s.toolCallsMu.Unlock()
+	if s.toolCalls == nil {
+		s.toolCalls = make(map[string]int)
+	}
+	s.toolCalls[name]++
+}
+
+// handleServerStatus handles the serverStatus tool call
+func (s *Server) handleServerStatus(_ map[string]interface{}) (*types.ToolCallResult, error) {
+	status := types.ServerStatus{
+		Version:     serverVersion,
+		Nvim:        s.nvimState(),
+		Client:      s.ClientInfo(),
+		ToolCalls:   make(map[string]int),
+		ActiveDiffs: []string{},
+		Config:      s.effectiveConfig(),
+	}
+	if !s.startedAt.IsZero() {
+		status.UptimeSeconds = int64(time.Since(s.startedAt).Seconds())
+	}
+
+	s.toolCallsMu.Lock()
+	for name, count := range s.toolCalls {
+		status.ToolCalls[name] = count
+	}
+	s.toolCallsMu.Unlock()
+
+	s.diffMu.Lock()
+	for filePath := range s.diffs {
+		status.ActiveDiffs = append(status.ActiveDiffs, s.displayPath(filePath))
+	}
+	s.diffMu.Unlock()
+	sort.Strings(status.ActiveDiffs)
+
+	s.mu.RLock()
+	status.Subscribers = len(s.subscribers)
+	s.mu.RUnlock()
+
+	return jsonResult(status)
+}
+
+// nvimState describes whether Neovim answers a round trip
+func (s *Server) nvimState() string {
+	if s.nvimClient == nil {
+		return "disconnected"
+	}
+	err := s.nvimClient.Ping(statusPingTimeout)
+	switch {
+	case err == nil:
+		return "connected"
+	case errors.Is(err, nvim.ErrPingTimeout):
+		return "unresponsive"
+	default:
+		return "error: " + err.Error()
+	}
+}
+
+// effectiveConfig returns the configuration in use, with defaults applied
+// and the auth token redacted
+func (s *Server) effectiveConfig() types.ServerConfig {
+	config := types.ServerConfig{
+		AuthToken:              "[redacted]",
+		WorkspaceRoots:         s.config.WorkspaceRoots,
+		CORSOrigin:             s.config.CORSOrigin,
+		RelativePaths:          s.config.RelativePaths,
+		ReadOnly:               s.config.ReadOnly,
+		MaxRequestBytes:        s.config.MaxRequestBytes,
+		MaxDiffBytes:           s.config.MaxDiffBytes,
+		SSEWriteTimeout:        s.config.SSEWriteTimeout.String(),
+		Tools:                  []string{},
+		AllowedCommands:        s.allowedCommands(),
+		AcceptOnSave:           s.config.AcceptOnSave,
+		StrictContentType:      s.config.StrictContentType,
+		NotificationLog:        s.config.NotificationLog != nil,
+		MaxConcurrentToolCalls: s.config.MaxConcurrentToolCalls,
+		RejectWhenBusy:         s.config.RejectWhenBusy,
+	}
+	if config.WorkspaceRoots == nil {
+		config.WorkspaceRoots = []string{}
+	}
+	if config.CORSOrigin == "" {
+		config.CORSOrigin = "*"
+	}
+	if config.MaxRequestBytes <= 0 {
+		config.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	if config.MaxDiffBytes <= 0 {
+		config.MaxDiffBytes = DefaultMaxDiffBytes
+	}
+	if config.MaxConcurrentToolCalls <= 0 {
+		config.MaxConcurrentToolCalls = DefaultMaxConcurrentToolCalls
+	}
+	if s.config.SSEWriteTimeout <= 0 {
+		config.SSEWriteTimeout = DefaultSSEWriteTimeout.String()
+	}
+
+	s.mu.RLock()
+	for name := range s.tools {
+		config.Tools = append(config.Tools, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(config.Tools)
+	return config
+}
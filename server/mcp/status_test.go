@@ -0,0 +1,54 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleServerStatus(t *testing.T) {
+	s, err := NewServer("secret-token", newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		return nil
+	}), Config{WorkspaceRoots: []string{"/work"}, EnabledTools: []string{"serverStatus", "getContext"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.startDiffSession("/work/a.go", nil)
+	s.subscribers = append(s.subscribers, make(chan EventRecord))
+
+	var status types.ServerStatus
+	for i := 0; i < 2; i++ {
+		reqBody := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"serverStatus"}}`, i)
+		req, _ := http.NewRequest("POST", "/mcp", strings.NewReader(reqBody))
+		rr := httptest.NewRecorder()
+		s.HandleMCP(rr, req)
+
+		var resp struct {
+			Result types.ToolCallResult `json:"result"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(resp.Result.Content[0].Text), &status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if strings.Contains(fmt.Sprintf("%+v", status), "secret-token") {
+		t.Errorf("Auth token leaked: %+v", status)
+	}
+	if status.Nvim != "connected" || status.Subscribers != 1 || status.ToolCalls["serverStatus"] != 2 {
+		t.Errorf("handleServerStatus() = %+v, want nvim connected with 1 subscriber and 2 serverStatus calls", status)
+	}
+	if len(status.ActiveDiffs) != 1 || status.ActiveDiffs[0] != "/work/a.go" {
+		t.Errorf("ActiveDiffs = %v, want [/work/a.go]", status.ActiveDiffs)
+	}
+	if status.Config.MaxDiffBytes != DefaultMaxDiffBytes || len(status.Config.Tools) != 2 || status.Config.CORSOrigin != "*" {
+		t.Errorf("handleServerStatus() config = %+v, want the defaults with 2 tools and CORS origin *", status.Config)
+	}
+}
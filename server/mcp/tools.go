@@ -0,0 +1,108 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gemini-cli/types"
+)
+
+// objectSchema builds a JSON Schema object describing a tool's arguments
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// property builds a JSON Schema property with a type and description
+func property(typ, description string) map[string]string {
+	return map[string]string{
+		"type":        typ,
+		"description": description,
+	}
+}
+
+// textResult wraps plain text in a successful tool result
+func textResult(text string) *types.ToolCallResult {
+	return &types.ToolCallResult{
+		Content: []types.ContentBlock{{Type: "text", Text: text}},
+		IsError: false,
+	}
+}
+
+// errorResult wraps an error message in a failed tool result
+func errorResult(format string, v ...interface{}) *types.ToolCallResult {
+	return &types.ToolCallResult{
+		Content: []types.ContentBlock{{Type: "text", Text: fmt.Sprintf(format, v...)}},
+		IsError: true,
+	}
+}
+
+// codedErrorResult is errorResult with a machine-readable error code
+func codedErrorResult(code, format string, v ...interface{}) *types.ToolCallResult {
+	result := errorResult(format, v...)
+	result.Code = code
+	return result
+}
+
+// jsonResult marshals v into a text block of a successful tool result
+func jsonResult(v interface{}) (*types.ToolCallResult, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+	return textResult(string(data)), nil
+}
+
+// textAndJSONResult is a successful tool result with a human-readable text
+// block followed by v as a JSON block, so clients can use either
+func textAndJSONResult(text string, v interface{}) (*types.ToolCallResult, error) {
+	result, err := jsonResult(v)
+	if err != nil {
+		return nil, err
+	}
+	result.Content = append([]types.ContentBlock{{Type: "text", Text: text}}, result.Content...)
+	return result, nil
+}
+
+// intArg reads an optional integer argument, returning def when it is absent.
+// JSON numbers arrive as float64, so fractional values are rejected.
+func intArg(args map[string]interface{}, name string, def int) (int, bool) {
+	raw, present := args[name]
+	if !present || raw == nil {
+		return def, true
+	}
+	f, ok := raw.(float64)
+	if !ok || f != float64(int(f)) {
+		return 0, false
+	}
+	return int(f), true
+}
+
+// stringSliceArg reads an optional array-of-strings argument.
+// The second return value is false when the argument is present but malformed.
+func stringSliceArg(args map[string]interface{}, name string) ([]string, bool) {
+	raw, present := args[name]
+	if !present || raw == nil {
+		return nil, true
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		str, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, str)
+	}
+	return values, true
+}
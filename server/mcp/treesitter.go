@@ -0,0 +1,44 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"errors"
+
+	"gemini-cli/nvim"
+	"gemini-cli/types"
+)
+
+// maxNodeTextBytes caps the text returned by getNodeAt; a position between
+// top-level declarations can select a node spanning the whole file
+const maxNodeTextBytes = 64 * 1024
+
+// handleGetNodeAt handles the getNodeAt tool call
+func (s *Server) handleGetNodeAt(args map[string]interface{}) (*types.ToolCallResult, error) {
+	filePath, ok := args["filePath"].(string)
+	if !ok || filePath == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid filePath"), nil
+	}
+	line, ok := intArg(args, "line", 0)
+	if !ok || line < 1 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid line"), nil
+	}
+	column, ok := intArg(args, "column", 1)
+	if !ok || column < 1 {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid column"), nil
+	}
+
+	node, err := s.nvimClient.NodeAt(filePath, line, column)
+	if errors.Is(err, nvim.ErrBufferNotOpen) {
+		return codedErrorResult(types.ErrorCodeNotFound, "File is not open in Neovim: %s", filePath), nil
+	}
+	if err != nil {
+		return codedErrorResult(types.ErrorCodeNvimError, "Failed to get node: %v", err), nil
+	}
+
+	node.Path = s.displayPath(filePath)
+	if len(node.Text) > maxNodeTextBytes {
+		node.Text = truncateUTF8(node.Text, maxNodeTextBytes)
+		node.Truncated = true
+	}
+	return jsonResult(node)
+}
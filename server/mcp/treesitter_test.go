@@ -0,0 +1,53 @@
+package mcp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestHandleGetNodeAt(t *testing.T) {
+	text := "func main() {}"
+	s := &Server{nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+		if args[0] == "/tmp/closed.go" {
+			return nil
+		}
+		*result.(**types.SyntaxNode) = &types.SyntaxNode{
+			Type: "function_declaration", StartLine: 3, StartColumn: 1, EndLine: 3, EndColumn: 14,
+			Text: text, Source: "treesitter",
+		}
+		return nil
+	})}
+	getNode := func() types.SyntaxNode {
+		result, err := s.handleGetNodeAt(map[string]interface{}{"filePath": "/tmp/main.go", "line": float64(3)})
+		if err != nil || result.IsError {
+			t.Fatalf("handleGetNodeAt = %+v, %v", result, err)
+		}
+		var node types.SyntaxNode
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &node); err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+
+	if node := getNode(); node.Path != "/tmp/main.go" || node.Type != "function_declaration" || node.Text != text || node.Truncated {
+		t.Errorf("handleGetNodeAt() node = %+v, want the function_declaration at /tmp/main.go", node)
+	}
+
+	text = strings.Repeat("x", maxNodeTextBytes+1)
+	if node := getNode(); len(node.Text) != maxNodeTextBytes || !node.Truncated {
+		t.Errorf("handleGetNodeAt() text length = %d (truncated=%v), want %d (truncated=true)", len(node.Text), node.Truncated, maxNodeTextBytes)
+	}
+
+	result, err := s.handleGetNodeAt(map[string]interface{}{"filePath": "/tmp/closed.go", "line": float64(1)})
+	if err != nil || result.Code != types.ErrorCodeNotFound {
+		t.Errorf("handleGetNodeAt for a closed file = %+v, %v; want %q", result, err, types.ErrorCodeNotFound)
+	}
+
+	result, err = s.handleGetNodeAt(map[string]interface{}{"filePath": "/tmp/main.go", "line": float64(0)})
+	if err != nil || result.Code != types.ErrorCodeInvalidArgument {
+		t.Errorf("handleGetNodeAt at line 0 = %+v, %v; want %q", result, err, types.ErrorCodeInvalidArgument)
+	}
+}
@@ -0,0 +1,218 @@
+// Package mcp implements the Model Context Protocol server for Gemini CLI.
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gemini-cli/types"
+)
+
+// ParseWorkspaceRoots splits the colon-separated -workspace value into its
+// roots, cleaned so "/foo/" and "/foo" are the same root, without duplicates
+func ParseWorkspaceRoots(workspacePath string) []string {
+	var roots []string
+	seen := make(map[string]bool)
+	for _, root := range filepath.SplitList(workspacePath) {
+		if root == "" {
+			continue
+		}
+		root = filepath.Clean(root)
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// workspaceRootFor returns the workspace root containing path. Symlinks are
+// resolved first, so a link inside the workspace can't reach files outside it.
+func (s *Server) workspaceRootFor(path string) (string, bool) {
+	resolved := resolveSymlinks(path)
+	for i, root := range s.realRoots() {
+		if isWithin(root, resolved) {
+			return s.config.WorkspaceRoots[i], true
+		}
+	}
+	return "", false
+}
+
+// realRoots returns the workspace roots with symlinks resolved, computed once
+func (s *Server) realRoots() []string {
+	s.realRootsOnce.Do(func() {
+		for _, root := range s.config.WorkspaceRoots {
+			s.realRootsList = append(s.realRootsList, resolveSymlinks(root))
+		}
+	})
+	return s.realRootsList
+}
+
+// maxSymlinkHops bounds resolveSymlinks on dangling links that point at links
+const maxSymlinkHops = 40
+
+// resolveSymlinks returns path with every symlink resolved. For a path that
+// doesn't exist yet, its deepest existing ancestor is resolved and the rest
+// appended, so a new file is checked where it would actually be created.
+func resolveSymlinks(path string) string {
+	return resolveSymlinksHops(filepath.Clean(path), maxSymlinkHops)
+}
+
+func resolveSymlinksHops(path string, hops int) string {
+	var rest []string
+	for dir := path; ; {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{real}, rest...)...)
+		}
+		// A dangling link still leads wherever its target would be created
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 && hops > 0 {
+			if target, err := os.Readlink(dir); err == nil {
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(filepath.Dir(dir), target)
+				}
+				return resolveSymlinksHops(filepath.Join(append([]string{target}, rest...)...), hops-1)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = parent
+	}
+}
+
+// displayPath converts an absolute path into the form used in tool results:
+// relative to its workspace root when RelativePaths is enabled, otherwise
+// unchanged. Paths outside every root stay absolute.
+func (s *Server) displayPath(path string) string {
+	if !s.config.RelativePaths {
+		return path
+	}
+	for _, root := range s.config.WorkspaceRoots {
+		if isWithin(root, path) {
+			if rel, err := filepath.Rel(root, path); err == nil {
+				return rel
+			}
+		}
+	}
+	return path
+}
+
+// isWithin reports whether path is root itself or lies beneath it
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Root is an MCP root: a workspace directory as a file:// URI
+type Root struct {
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
+// roots returns the workspace roots as MCP roots
+func (s *Server) roots() []Root {
+	roots := make([]Root, 0, len(s.config.WorkspaceRoots))
+	for _, root := range s.config.WorkspaceRoots {
+		uri := url.URL{Scheme: "file", Path: filepath.ToSlash(root)}
+		roots = append(roots, Root{URI: uri.String(), Name: filepath.Base(root)})
+	}
+	return roots
+}
+
+// handleRootsList handles MCP roots/list request
+func (s *Server) handleRootsList(w http.ResponseWriter, req *types.MCPRequest) {
+	response := types.MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"roots": s.roots(),
+		},
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// SendRootsListChanged sends a notifications/roots/list_changed notification;
+// call it whenever the workspace roots change
+func (s *Server) SendRootsListChanged() {
+	s.SendNotification("notifications/roots/list_changed", nil)
+}
+
+// resolveCandidates returns the absolute paths a path may refer to: itself
+// when absolute, otherwise joined with each workspace root. Candidates
+// outside their root, e.g. through ".." or a symlink, are dropped.
+func (s *Server) resolveCandidates(path string) []types.ResolvedPath {
+	var candidates []types.ResolvedPath
+	add := func(root, abs string) {
+		_, err := os.Stat(abs)
+		candidates = append(candidates, types.ResolvedPath{Path: abs, Root: root, Exists: err == nil})
+	}
+
+	if filepath.IsAbs(path) {
+		abs := filepath.Clean(path)
+		if root, ok := s.workspaceRootFor(abs); ok {
+			add(root, abs)
+		}
+		return candidates
+	}
+	// Compare with symlinks resolved, like workspaceRootFor, so a link
+	// inside a root can't lead a relative path out of it
+	realRoots := s.realRoots()
+	for i, root := range s.config.WorkspaceRoots {
+		abs := filepath.Join(root, path)
+		if isWithin(realRoots[i], resolveSymlinks(abs)) {
+			add(root, abs)
+		}
+	}
+	return candidates
+}
+
+// handleResolvePath handles the resolvePath tool call
+func (s *Server) handleResolvePath(args map[string]interface{}) (*types.ToolCallResult, error) {
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return codedErrorResult(types.ErrorCodeInvalidArgument, "Invalid path"), nil
+	}
+
+	candidates := s.resolveCandidates(path)
+	if len(candidates) == 0 {
+		return codedErrorResult(types.ErrorCodeOutOfWorkspace, "Path resolves outside every workspace root: %s", path), nil
+	}
+	if len(candidates) == 1 {
+		return jsonResult(candidates[0])
+	}
+
+	// With several roots, prefer the only root where the path exists, then
+	// the root of the file the user is looking at
+	var existing []types.ResolvedPath
+	for _, candidate := range candidates {
+		if candidate.Exists {
+			existing = append(existing, candidate)
+		}
+	}
+	if len(existing) == 1 {
+		return jsonResult(existing[0])
+	}
+	if buffer, err := s.nvimClient.GetActiveBuffer(); err == nil && buffer.Path != "" {
+		if activeRoot, ok := s.workspaceRootFor(buffer.Path); ok {
+			for _, candidate := range candidates {
+				if candidate.Root == activeRoot && (candidate.Exists || len(existing) == 0) {
+					return jsonResult(candidate)
+				}
+			}
+		}
+	}
+
+	return jsonResult(map[string]interface{}{
+		"ambiguous":  true,
+		"candidates": candidates,
+	})
+}
@@ -0,0 +1,110 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gemini-cli/types"
+)
+
+func TestParseWorkspaceRoots(t *testing.T) {
+	tests := map[string][]string{
+		"":                      nil,
+		"/foo":                  {"/foo"},
+		"/foo/":                 {"/foo"},
+		"/foo:/foo/:/bar":       {"/foo", "/bar"},
+		"/foo/./baz/..::/bar//": {"/foo", "/bar"},
+		"/foo:/foobar":          {"/foo", "/foobar"},
+	}
+	for input, want := range tests {
+		if got := ParseWorkspaceRoots(input); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseWorkspaceRoots(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		root, path string
+		want       bool
+	}{
+		{"/foo", "/foo", true},
+		{"/foo/", "/foo", true},
+		{"/foo", "/foo/", true},
+		{"/foo", "/foo/a.go", true},
+		{"/foo/", "/foo/sub/a.go", true},
+		{"/foo", "/foo/..bar", true},
+		{"/foo", "/foobar", false},
+		{"/foo", "/foobar/a.go", false},
+		{"/foo", "/foo/../bar/a.go", false},
+		{"/foo", "/", false},
+		{"/foo", "foo/a.go", false},
+	}
+	for _, tt := range tests {
+		if got := isWithin(tt.root, tt.path); got != tt.want {
+			t.Errorf("isWithin(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHandleResolvePath(t *testing.T) {
+	rootA, rootB := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootB, "only-b.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	active := filepath.Join(rootA, "main.go")
+	s := &Server{
+		config: Config{WorkspaceRoots: []string{rootA, rootB}},
+		nvimClient: newFakeClient(func(code string, result interface{}, args ...interface{}) error {
+			*result.(*types.BufferInfo) = types.BufferInfo{Path: active}
+			return nil
+		}),
+	}
+	resolve := func(path string) map[string]interface{} {
+		result, err := s.handleResolvePath(map[string]interface{}{"path": path})
+		if err != nil || result.IsError {
+			t.Fatalf("handleResolvePath(%q) = %+v, %v", path, result, err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := resolve("only-b.go"); got["path"] != filepath.Join(rootB, "only-b.go") || got["exists"] != true {
+		t.Errorf("handleResolvePath(only-b.go) = %v, want %s", got, filepath.Join(rootB, "only-b.go"))
+	}
+	if got := resolve("new.go"); got["path"] != filepath.Join(rootA, "new.go") || got["exists"] != false {
+		t.Errorf("handleResolvePath(new.go) = %v, want %s under the active file's root", got, filepath.Join(rootA, "new.go"))
+	}
+	if got := resolve(filepath.Join(rootB, "x", "..", "only-b.go")); got["path"] != filepath.Join(rootB, "only-b.go") {
+		t.Errorf("handleResolvePath(uncleaned absolute path) = %v, want %s", got, filepath.Join(rootB, "only-b.go"))
+	}
+
+	active = ""
+	if got := resolve("new.go"); got["ambiguous"] != true {
+		t.Errorf("handleResolvePath(new.go) without an active file = %v, want ambiguous", got)
+	}
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(rootA, "link")); err != nil {
+		t.Fatal(err)
+	}
+	// The link leads out of rootA, leaving only the file rootB would hold
+	if got := resolve("link/secret"); got["path"] != filepath.Join(rootB, "link", "secret") || got["exists"] != false {
+		t.Errorf("resolvePath(link/secret) = %v, want only the rootB candidate", got)
+	}
+	for _, path := range []string{"../escape.go", "/etc/passwd", filepath.Join(rootA, "link", "secret")} {
+		result, err := s.handleResolvePath(map[string]interface{}{"path": path})
+		if err != nil || result.Code != types.ErrorCodeOutOfWorkspace {
+			t.Errorf("handleResolvePath(%q) = %+v, %v; want %q", path, result, err, types.ErrorCodeOutOfWorkspace)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"gemini-cli/nvim"
+)
+
+// Parent monitor schedule: checks start every monitorMinInterval and the
+// interval doubles after every monitorStableChecks healthy checks, up to
+// monitorMaxInterval, which bounds how late a dead parent is noticed
+const (
+	monitorMinInterval  = 2 * time.Second
+	monitorMaxInterval  = 10 * time.Second
+	monitorStableChecks = 5
+	monitorJitter       = 0.1
+)
+
+// monitorParent shuts the server down when the Neovim process dies or the
+// RPC connection stops answering. Both are checked on a single jittered timer
+// so that many idle instances don't wake in lockstep.
+func monitorParent(pid int, ping func(timeout time.Duration) error, shutdown func(reason string)) {
+	interval := monitorMinInterval
+	healthy := 0
+
+	timer := time.NewTimer(withJitter(interval))
+	defer timer.Stop()
+	for range timer.C {
+		if !isProcessAlive(pid) {
+			shutdown("parent-process-dead")
+			return
+		}
+
+		if err := ping(interval); err != nil {
+			if errors.Is(err, nvim.ErrPingTimeout) {
+				// A busy editor isn't dead; check again soon
+				log.Printf("Neovim keepalive timed out")
+				interval, healthy = monitorMinInterval, 0
+				timer.Reset(withJitter(interval))
+				continue
+			}
+			log.Printf("Neovim keepalive failed: %v", err)
+			shutdown("nvim-keepalive-failed")
+			return
+		}
+
+		healthy++
+		if healthy%monitorStableChecks == 0 && interval < monitorMaxInterval {
+			interval = min(interval*2, monitorMaxInterval)
+		}
+		timer.Reset(withJitter(interval))
+	}
+}
+
+// withJitter spreads d by up to ±monitorJitter
+func withJitter(d time.Duration) time.Duration {
+	spread := (rand.Float64()*2 - 1) * monitorJitter
+	return d + time.Duration(float64(d)*spread)
+}
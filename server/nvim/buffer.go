@@ -0,0 +1,150 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"errors"
+	"fmt"
+
+	"gemini-cli/logger"
+	"gemini-cli/types"
+)
+
+// ErrBufferNotOpen is returned when a file has no loaded buffer in Neovim
+var ErrBufferNotOpen = errors.New("file is not open in a buffer")
+
+// GetContextWindow returns the lines within radius of the cursor in the buffer for filePath
+func (c *Client) GetContextWindow(filePath string, radius int) (*types.ContextWindow, error) {
+	logger.Debug("GetContextWindow called for %s (radius=%d)", filePath, radius)
+
+	var window *types.ContextWindow
+	err := c.execLua(`return require('gemini-cli.buffer').get_context_window(...)`, &window, filePath, radius)
+	if err != nil {
+		logger.Error("GetContextWindow failed: %v", err)
+		return nil, fmt.Errorf("failed to get context window: %w", err)
+	}
+	if window == nil {
+		return nil, ErrBufferNotOpen
+	}
+
+	logger.Debug("GetContextWindow returned lines %d-%d", window.StartLine, window.EndLine)
+	return window, nil
+}
+
+// GetBufferRange returns lines startLine to endLine (1-based, inclusive) of the
+// buffer for filePath, clamped to the buffer's bounds
+func (c *Client) GetBufferRange(filePath string, startLine, endLine int) (*types.FileRange, error) {
+	logger.Debug("GetBufferRange called for %s (%d-%d)", filePath, startLine, endLine)
+
+	var fileRange *types.FileRange
+	err := c.execLua(`return require('gemini-cli.buffer').get_range(...)`, &fileRange, filePath, startLine, endLine)
+	if err != nil {
+		logger.Error("GetBufferRange failed: %v", err)
+		return nil, fmt.Errorf("failed to get buffer range: %w", err)
+	}
+	if fileRange == nil {
+		return nil, ErrBufferNotOpen
+	}
+	return fileRange, nil
+}
+
+// GetActiveBuffer returns the buffer shown in the current window
+func (c *Client) GetActiveBuffer() (*types.BufferInfo, error) {
+	logger.Debug("GetActiveBuffer called")
+
+	buffer := &types.BufferInfo{}
+	err := c.execLua(`return require('gemini-cli.buffer').get_active()`, buffer)
+	if err != nil {
+		logger.Error("GetActiveBuffer failed: %v", err)
+		return nil, fmt.Errorf("failed to get active buffer: %w", err)
+	}
+	return buffer, nil
+}
+
+// SetActiveBuffer makes the buffer for filePath the active one, focusing a
+// window that already shows it if there is one
+func (c *Client) SetActiveBuffer(filePath string) (*types.BufferInfo, error) {
+	logger.Debug("SetActiveBuffer called for %s", filePath)
+
+	var buffer *types.BufferInfo
+	err := c.execLua(`return require('gemini-cli.buffer').set_active(...)`, &buffer, filePath)
+	if err != nil {
+		logger.Error("SetActiveBuffer failed: %v", err)
+		return nil, fmt.Errorf("failed to set active buffer: %w", err)
+	}
+	if buffer == nil {
+		return nil, ErrBufferNotOpen
+	}
+	return buffer, nil
+}
+
+// GetBufferContents returns the content of the loaded buffers for filePaths in one
+// round trip. An empty filePaths selects every open file buffer; paths without a
+// loaded buffer are skipped.
+func (c *Client) GetBufferContents(filePaths []string) ([]types.FileContent, error) {
+	logger.Debug("GetBufferContents called for %d paths", len(filePaths))
+
+	if filePaths == nil {
+		filePaths = []string{}
+	}
+
+	var contents []types.FileContent
+	err := c.execLua(`return require('gemini-cli.buffer').get_contents(...)`, &contents, filePaths)
+	if err != nil {
+		logger.Error("GetBufferContents failed: %v", err)
+		return nil, fmt.Errorf("failed to read buffers: %w", err)
+	}
+
+	logger.Debug("GetBufferContents read %d buffers", len(contents))
+	return contents, nil
+}
+
+// SubscribeBufferEvents attaches to every file buffer (current and future) so
+// Neovim forwards change ticks as gemini_buffer_changed notifications
+func (c *Client) SubscribeBufferEvents() error {
+	logger.Debug("SubscribeBufferEvents called")
+
+	err := c.execLua(`require('gemini-cli.buffer').subscribe_changes()`, nil)
+	if err != nil {
+		logger.Error("SubscribeBufferEvents failed: %v", err)
+		return fmt.Errorf("failed to subscribe to buffer events: %w", err)
+	}
+	return nil
+}
+
+// UnsubscribeBufferEvents detaches the buffer change forwarding set up by SubscribeBufferEvents
+func (c *Client) UnsubscribeBufferEvents() error {
+	logger.Debug("UnsubscribeBufferEvents called")
+
+	err := c.execLua(`require('gemini-cli.buffer').unsubscribe_changes()`, nil)
+	if err != nil {
+		logger.Error("UnsubscribeBufferEvents failed: %v", err)
+		return fmt.Errorf("failed to unsubscribe from buffer events: %w", err)
+	}
+	return nil
+}
+
+// RegisterBufferChangeHandler registers the callback for gemini_buffer_changed notifications
+func (c *Client) RegisterBufferChangeHandler(onBufferChanged func(filePath string, changedtick int64)) error {
+	return c.nvim.RegisterHandler("gemini_buffer_changed", func(args ...interface{}) error {
+		if len(args) >= 2 {
+			filePath, _ := args[0].(string)
+			tick, _ := toInt64(args[1])
+			onBufferChanged(filePath, tick)
+		}
+		return nil
+	})
+}
+
+// GetOldfiles returns v:oldfiles, the files recently edited in Neovim, most
+// recent first
+func (c *Client) GetOldfiles() ([]string, error) {
+	logger.Debug("GetOldfiles called")
+
+	var files []string
+	err := c.execLua(`return vim.v.oldfiles`, &files)
+	if err != nil {
+		logger.Error("GetOldfiles failed: %v", err)
+		return nil, fmt.Errorf("failed to get oldfiles: %w", err)
+	}
+	return files, nil
+}
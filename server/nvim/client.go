@@ -2,7 +2,12 @@
 package nvim
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gemini-cli/logger"
 	"gemini-cli/types"
@@ -10,34 +15,246 @@ import (
 	"github.com/neovim/go-client/nvim"
 )
 
+// RPC is the subset of the Neovim RPC API used by Client; *nvim.Nvim implements it
+type RPC interface {
+	ExecLua(code string, result interface{}, args ...interface{}) error
+	RegisterHandler(method string, fn interface{}) error
+}
+
+var _ RPC = (*nvim.Nvim)(nil)
+
 // Client wraps the Neovim RPC client
 type Client struct {
-	nvim *nvim.Nvim
+	nvim RPC
+
+	// Pending confirmation prompts, keyed by request id
+	confirmOnce sync.Once
+	confirmErr  error
+	confirmMu   sync.Mutex
+	confirmSeq  int64
+	confirms    map[int64]chan int64
+
+	// pinging is set while a Ping round trip is outstanding
+	pinging atomic.Bool
+
+	// closing is set by Close so Serve can tell an expected end from a lost connection
+	closing atomic.Bool
 }
 
 // NewClient creates a new Neovim RPC client
-func NewClient(v *nvim.Nvim) *Client {
+func NewClient(v RPC) *Client {
 	return &Client{nvim: v}
 }
 
-// NotifyReady notifies Neovim that the server is ready
+// servable is implemented by RPC connections that Client can serve and
+// close; *nvim.Nvim implements it
+type servable interface {
+	Serve() error
+	Close() error
+}
+
+var _ servable = (*nvim.Nvim)(nil)
+
+// Serve serves the RPC connection until it ends. It returns nil when the
+// connection was closed by Close, whatever error the read loop ended with.
+func (c *Client) Serve() error {
+	conn, ok := c.nvim.(servable)
+	if !ok {
+		return errors.New("RPC connection can't be served")
+	}
+
+	err := conn.Serve()
+	if c.closing.Load() {
+		return nil
+	}
+	return err
+}
+
+// Close stops serving and closes the RPC connection
+func (c *Client) Close() error {
+	c.closing.Store(true)
+	if conn, ok := c.nvim.(servable); ok {
+		return conn.Close()
+	}
+	return nil
+}
+
+// Retry policy for NotifyReady while the Lua side finishes loading
+const (
+	notifyReadyInitialBackoff = 100 * time.Millisecond
+	notifyReadyMaxBackoff     = time.Second
+	notifyReadyTimeout        = 5 * time.Second
+)
+
+// NotifyReady notifies Neovim that the server is ready. The server can start
+// before the plugin has loaded gemini-cli.server, so failures are retried with
+// exponential backoff until notifyReadyTimeout elapses.
 func (c *Client) NotifyReady(port int, authToken, workspace string) error {
-	return c.nvim.ExecLua(`require('gemini-cli.server').on_ready(...)`, nil, port, authToken, workspace)
+	deadline := time.Now().Add(notifyReadyTimeout)
+	backoff := notifyReadyInitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := c.execLua(`require('gemini-cli.server').on_ready(...)`, nil, port, authToken, workspace)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("failed to notify ready after %d attempts: %w", attempt, err)
+		}
+
+		logger.Debug("NotifyReady attempt %d failed, retrying in %v: %v", attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > notifyReadyMaxBackoff {
+			backoff = notifyReadyMaxBackoff
+		}
+	}
 }
 
-// OpenDiff opens a diff view for the given file
-func (c *Client) OpenDiff(filePath, newContent string) error {
-	logger.Debug("OpenDiff called for %s", filePath)
+// pluginModules are the Lua modules the server calls into
+var pluginModules = []string{
+	"gemini-cli",
+	"gemini-cli.buffer",
+	"gemini-cli.confirm",
+	"gemini-cli.context",
+	"gemini-cli.diagnostics",
+	"gemini-cli.diff",
+	"gemini-cli.lsp",
+	"gemini-cli.scratch",
+	"gemini-cli.server",
+}
 
-	var result interface{}
-	err := c.nvim.ExecLua(`return require('gemini-cli.diff').open_diff(...)`, &result, filePath, newContent)
+// CheckPlugin verifies that every Lua module the server uses can be loaded,
+// returning the names of those that can't
+func (c *Client) CheckPlugin() ([]string, error) {
+	var missing []string
+	err := c.execLua(`
+local missing = {}
+for _, name in ipairs(...) do
+  if not pcall(require, name) then
+    table.insert(missing, name)
+  end
+end
+return missing
+`, &missing, pluginModules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check plugin: %w", err)
+	}
+	return missing, nil
+}
+
+// ErrPingTimeout is returned by Ping when Neovim doesn't answer in time
+var ErrPingTimeout = errors.New("neovim did not answer the keepalive in time")
+
+// Ping makes a trivial RPC round trip to check that Neovim is still answering.
+// A ping still waiting from an earlier call counts as a timeout, so a stalled
+// editor doesn't accumulate blocked calls.
+func (c *Client) Ping(timeout time.Duration) error {
+	if !c.pinging.CompareAndSwap(false, true) {
+		return ErrPingTimeout
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer c.pinging.Store(false)
+		done <- c.execLua(`return true`, nil)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrPingTimeout
+	}
+}
+
+// Diff layouts accepted by OpenDiff
+const (
+	DiffLayoutTab        = "tab"
+	DiffLayoutVertical   = "vertical"
+	DiffLayoutHorizontal = "horizontal"
+)
+
+// OpenDiff opens a diff view for the given file and returns its hunk layout.
+// filetype sets the diff buffer's filetype; when empty, Neovim detects it from
+// the file name. Line endings and BOM are normalized away; the original
+// buffer's 'fileformat' and 'bomb' are kept when the diff is accepted.
+// acceptOnSave makes :w in the diff buffer accept it; when false, the
+// plugin's allow_w_to_accept option decides. layout is one of the
+// DiffLayout values; when empty, the plugin's default placement is used.
+func (c *Client) OpenDiff(filePath, newContent, filetype string, acceptOnSave bool, layout string) ([]types.Hunk, error) {
+	logger.Debug("OpenDiff called for %s (filetype=%q, acceptOnSave=%v, layout=%q)", filePath, filetype, acceptOnSave, layout)
+
+	args := []interface{}{filePath, NormalizeContent(newContent), filetype}
+	if acceptOnSave {
+		args = append(args, true)
+	}
+	if layout != "" {
+		if !acceptOnSave {
+			// nil keeps the plugin's allow_w_to_accept in charge
+			args = append(args, nil)
+		}
+		args = append(args, layout)
+	}
+
+	var hunks []types.Hunk
+	err := c.execLua(`return require('gemini-cli.diff').open_diff(...)`, &hunks, args...)
 
 	if err != nil {
 		logger.Error("OpenDiff failed: %v", err)
-		return fmt.Errorf("failed to open diff: %w", err)
+		return nil, fmt.Errorf("failed to open diff: %w", err)
 	}
-	logger.Info("OpenDiff completed for %s", filePath)
-	return nil
+	logger.Info("OpenDiff completed for %s (%d hunks)", filePath, len(hunks))
+	return hunks, nil
+}
+
+// AcceptHunks applies the hunks at the given indices of the current layout to
+// the original file, leaving the diff open, and returns the remaining layout
+func (c *Client) AcceptHunks(filePath string, indices []int) ([]types.Hunk, error) {
+	logger.Debug("AcceptHunks called for %s: %v", filePath, indices)
+
+	var result *struct {
+		Hunks []types.Hunk `msgpack:"hunks"`
+	}
+	err := c.execLua(`return require('gemini-cli.diff').accept_hunks(...)`, &result, filePath, indices)
+	if err != nil {
+		logger.Error("AcceptHunks failed: %v", err)
+		return nil, fmt.Errorf("failed to accept hunks: %w", err)
+	}
+	if result == nil {
+		return nil, fmt.Errorf("no active diff for %s", filePath)
+	}
+	logger.Info("AcceptHunks completed for %s, %d hunks remain", filePath, len(result.Hunks))
+	return result.Hunks, nil
+}
+
+// OpenMultiDiff opens diffs for several files that Neovim accepts or rejects as
+// a unit, returning the per-file outcome. If any file fails to open, none stay open.
+// acceptOnSave applies to every diff as it does for OpenDiff.
+func (c *Client) OpenMultiDiff(edits []types.FileEdit, acceptOnSave bool) ([]types.FileEditResult, error) {
+	logger.Debug("OpenMultiDiff called for %d files (acceptOnSave=%v)", len(edits), acceptOnSave)
+
+	normalized := make([]types.FileEdit, len(edits))
+	for i, edit := range edits {
+		edit.NewContent = NormalizeContent(edit.NewContent)
+		normalized[i] = edit
+	}
+
+	args := []interface{}{normalized}
+	if acceptOnSave {
+		args = append(args, true)
+	}
+
+	var results []types.FileEditResult
+	err := c.execLua(`return require('gemini-cli.diff').open_multi_diff(...)`, &results, args...)
+	if err != nil {
+		logger.Error("OpenMultiDiff failed: %v", err)
+		return nil, fmt.Errorf("failed to open multi-file diff: %w", err)
+	}
+	logger.Info("OpenMultiDiff completed for %d files", len(edits))
+	return results, nil
 }
 
 // CloseDiff closes the diff view for the given file and returns the final content
@@ -45,7 +262,7 @@ func (c *Client) CloseDiff(filePath string) (string, error) {
 	logger.Debug("CloseDiff called for %s", filePath)
 
 	var content string
-	err := c.nvim.ExecLua(`return require('gemini-cli.diff').close_diff(...)`, &content, filePath)
+	err := c.execLua(`return require('gemini-cli.diff').close_diff(...)`, &content, filePath)
 
 	if err != nil {
 		logger.Error("CloseDiff failed: %v", err)
@@ -55,12 +272,23 @@ func (c *Client) CloseDiff(filePath string) (string, error) {
 	return content, nil
 }
 
-// AcceptDiff accepts the diff changes and applies them to the original file
-func (c *Client) AcceptDiff(filePath string) error {
-	logger.Debug("AcceptDiff called for %s", filePath)
+// AcceptDiff accepts the diff changes and applies them to the original file.
+// A non-empty encoding sets the buffer's 'fileencoding' before it is written,
+// so the file is saved in that encoding.
+func (c *Client) AcceptDiff(filePath, encoding string) error {
+	logger.Debug("AcceptDiff called for %s (encoding=%q)", filePath, encoding)
+
+	args := []interface{}{filePath}
+	if encoding != "" {
+		args = append(args, encoding)
+	}
 
 	var result interface{}
-	err := c.nvim.ExecLua(`return require('gemini-cli.diff').accept_diff(...)`, &result, filePath)
+	err := c.execLua(`return require('gemini-cli.diff').accept_diff(...)`, &result, args...)
+	if err != nil && isNotModifiable(err) {
+		logger.Warn("AcceptDiff refused, buffer is not modifiable: %s", filePath)
+		return fmt.Errorf("%w: %s", ErrNotModifiable, filePath)
+	}
 	if err != nil {
 		logger.Error("AcceptDiff failed: %v", err)
 		return fmt.Errorf("failed to accept diff: %w", err)
@@ -69,12 +297,23 @@ func (c *Client) AcceptDiff(filePath string) error {
 	return nil
 }
 
+// ErrNotModifiable is returned when a diff can't be applied because the
+// file's buffer is 'nomodifiable' or 'readonly'
+var ErrNotModifiable = errors.New("buffer is not modifiable")
+
+// isNotModifiable reports whether a Lua error came from changing a buffer that
+// can't be modified: the plugin's own check, or Neovim's E21
+func isNotModifiable(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "buffer is not modifiable") || strings.Contains(msg, "E21:")
+}
+
 // RejectDiff rejects the diff changes and closes the diff view
 func (c *Client) RejectDiff(filePath string) error {
 	logger.Debug("RejectDiff called for %s", filePath)
 
 	var result interface{}
-	err := c.nvim.ExecLua(`return require('gemini-cli.diff').reject_diff(...)`, &result, filePath)
+	err := c.execLua(`return require('gemini-cli.diff').reject_diff(...)`, &result, filePath)
 	if err != nil {
 		logger.Error("RejectDiff failed: %v", err)
 		return fmt.Errorf("failed to reject diff: %w", err)
@@ -83,20 +322,29 @@ func (c *Client) RejectDiff(filePath string) error {
 	return nil
 }
 
+// FocusDiff brings the diff window for filePath to the foreground, reporting
+// whether the diff was found with its window still open
+func (c *Client) FocusDiff(filePath string) (bool, error) {
+	logger.Debug("FocusDiff called for %s", filePath)
+
+	var focused bool
+	if err := c.execLua(`return require('gemini-cli.diff').focus_diff(...)`, &focused, filePath); err != nil {
+		logger.Error("FocusDiff failed: %v", err)
+		return false, fmt.Errorf("failed to focus diff: %w", err)
+	}
+	return focused, nil
+}
+
 // GetContext retrieves the current IDE context from Neovim
 func (c *Client) GetContext() (*types.IdeContext, error) {
-	var contextMap map[string]interface{}
-	err := c.nvim.ExecLua(`return require('gemini-cli.context').get_context()`, &contextMap)
+	// The Lua table decodes straight into IdeContext via its msgpack tags
+	context := &types.IdeContext{}
+	err := c.execLua(`return require('gemini-cli.context').get_context()`, context)
 	if err != nil {
 		logger.Error("GetContext failed: %v", err)
 		return nil, fmt.Errorf("failed to get context: %w", err)
 	}
-
-	// Convert map to IdeContext struct
-	// This is a simplified version; you may need more robust conversion
-	context := &types.IdeContext{}
-	// TODO: Implement proper map to struct conversion
-	logger.Debug("Got context: %+v", contextMap)
+	logger.Debug("Got context: %+v", context)
 
 	return context, nil
 }
@@ -126,6 +374,12 @@ func (c *Client) RegisterCallbacks(
 		if len(args) >= 2 {
 			filePath, _ := args[0].(string)
 			content, _ := args[1].(string)
+			// Restore the file's own line endings and BOM when the plugin reports them
+			if len(args) >= 4 {
+				fileformat, _ := args[2].(string)
+				bomb, _ := args[3].(bool)
+				content = ApplyFileFormat(content, fileformat, bomb)
+			}
 			logger.Info("Diff accepted: %s", filePath)
 			onDiffAccepted(filePath, content)
 		}
@@ -0,0 +1,49 @@
+package nvim
+
+import (
+	"errors"
+	"testing"
+)
+
+// servableRPC is an RPC connection whose Serve blocks until Close, then
+// fails the way a read on a closed socket does
+type servableRPC struct {
+	encodingRPC
+	closed chan struct{}
+}
+
+var errClosedConn = errors.New("use of closed network connection")
+
+func (r *servableRPC) Serve() error {
+	<-r.closed
+	return errClosedConn
+}
+
+func (r *servableRPC) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestServeAfterClose(t *testing.T) {
+	c := NewClient(&servableRPC{closed: make(chan struct{})})
+
+	done := make(chan error)
+	go func() { done <- c.Serve() }()
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Serve() after Close = %v, want nil", err)
+	}
+}
+
+func TestServeConnectionLost(t *testing.T) {
+	rpc := &servableRPC{closed: make(chan struct{})}
+	c := NewClient(rpc)
+
+	// The connection closing by itself is still reported
+	close(rpc.closed)
+	if err := c.Serve(); !errors.Is(err, errClosedConn) {
+		t.Errorf("Serve() = %v, want %v", err, errClosedConn)
+	}
+}
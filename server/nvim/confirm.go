@@ -0,0 +1,108 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"fmt"
+	"time"
+
+	"gemini-cli/logger"
+)
+
+// ConfirmChoice is the user's answer to a confirmation prompt
+type ConfirmChoice string
+
+// Possible answers to a confirmation prompt
+const (
+	ConfirmYes       ConfirmChoice = "yes"
+	ConfirmNo        ConfirmChoice = "no"
+	ConfirmCancelled ConfirmChoice = "cancelled"
+	ConfirmTimeout   ConfirmChoice = "timeout"
+)
+
+// choiceFromConfirm maps vim.fn.confirm's return value (1 = Yes, 2 = No,
+// 0 = dismissed) to a ConfirmChoice
+func choiceFromConfirm(choice int64) ConfirmChoice {
+	switch choice {
+	case 1:
+		return ConfirmYes
+	case 2:
+		return ConfirmNo
+	default:
+		return ConfirmCancelled
+	}
+}
+
+// Confirm asks the user a Yes/No question in Neovim. The prompt is shown
+// asynchronously; if no answer arrives within timeout, ConfirmTimeout is
+// returned and the eventual answer is discarded.
+func (c *Client) Confirm(prompt string, timeout time.Duration) (ConfirmChoice, error) {
+	logger.Debug("Confirm called: %q (timeout=%s)", prompt, timeout)
+
+	c.confirmOnce.Do(func() {
+		c.confirmErr = c.nvim.RegisterHandler("gemini_confirm_result", c.handleConfirmResult)
+	})
+	if c.confirmErr != nil {
+		return "", fmt.Errorf("failed to register confirm handler: %w", c.confirmErr)
+	}
+
+	answer := make(chan int64, 1)
+	c.confirmMu.Lock()
+	c.confirmSeq++
+	id := c.confirmSeq
+	if c.confirms == nil {
+		c.confirms = make(map[int64]chan int64)
+	}
+	c.confirms[id] = answer
+	c.confirmMu.Unlock()
+
+	defer func() {
+		c.confirmMu.Lock()
+		delete(c.confirms, id)
+		c.confirmMu.Unlock()
+	}()
+
+	err := c.execLua(`require('gemini-cli.confirm').request(...)`, nil, id, prompt)
+	if err != nil {
+		logger.Error("Confirm failed: %v", err)
+		return "", fmt.Errorf("failed to show confirmation: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case choice := <-answer:
+		return choiceFromConfirm(choice), nil
+	case <-timer.C:
+		logger.Info("Confirm timed out after %s", timeout)
+		return ConfirmTimeout, nil
+	}
+}
+
+// handleConfirmResult delivers a gemini_confirm_result notification to the
+// waiting Confirm call, if it is still waiting
+func (c *Client) handleConfirmResult(args ...interface{}) error {
+	if len(args) < 2 {
+		return nil
+	}
+	id, _ := toInt64(args[0])
+	choice, _ := toInt64(args[1])
+
+	c.confirmMu.Lock()
+	answer, ok := c.confirms[id]
+	c.confirmMu.Unlock()
+	if ok {
+		answer <- choice
+	}
+	return nil
+}
+
+// toInt64 converts a MessagePack integer, which may decode as signed or unsigned
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,52 @@
+package nvim
+
+import (
+	"testing"
+	"time"
+)
+
+// confirmRPC answers confirmation requests through the registered
+// gemini_confirm_result handler, or never when answer is negative
+type confirmRPC struct {
+	answer  int64
+	handler func(args ...interface{}) error
+}
+
+func (r *confirmRPC) ExecLua(code string, result interface{}, args ...interface{}) error {
+	if r.answer >= 0 {
+		go r.handler(args[0], r.answer)
+	}
+	return nil
+}
+
+func (r *confirmRPC) RegisterHandler(method string, fn interface{}) error {
+	r.handler = fn.(func(args ...interface{}) error)
+	return nil
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer int64
+		want   ConfirmChoice
+	}{
+		{name: "yes", answer: 1, want: ConfirmYes},
+		{name: "no", answer: 2, want: ConfirmNo},
+		{name: "dismissed", answer: 0, want: ConfirmCancelled},
+		{name: "no answer", answer: -1, want: ConfirmTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(&confirmRPC{answer: tt.answer})
+
+			choice, err := client.Confirm("Proceed?", 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Confirm failed: %v", err)
+			}
+			if choice != tt.want {
+				t.Errorf("Confirm() = %q, want %q", choice, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import "strings"
+
+// utf8BOM is the UTF-8 byte order mark
+const utf8BOM = "\uFEFF"
+
+// NormalizeContent strips a leading BOM and converts CRLF/CR line endings to LF,
+// which is how Neovim buffers hold lines regardless of 'fileformat'
+func NormalizeContent(content string) string {
+	content = strings.TrimPrefix(content, utf8BOM)
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.ReplaceAll(content, "\r", "\n")
+}
+
+// ApplyFileFormat converts LF-separated content to the line endings of a Neovim
+// 'fileformat' ("unix", "dos" or "mac") and prepends a BOM when bomb is set
+func ApplyFileFormat(content, fileformat string, bomb bool) string {
+	switch fileformat {
+	case "dos":
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	case "mac":
+		content = strings.ReplaceAll(content, "\n", "\r")
+	}
+	if bomb {
+		content = utf8BOM + content
+	}
+	return content
+}
@@ -0,0 +1,59 @@
+package nvim
+
+import "testing"
+
+func TestContentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		fileformat string
+		bomb       bool
+		wantLF     string
+	}{
+		{
+			name:       "unix",
+			content:    "line1\nline2\n",
+			fileformat: "unix",
+			wantLF:     "line1\nline2\n",
+		},
+		{
+			name:       "crlf",
+			content:    "line1\r\nline2\r\n",
+			fileformat: "dos",
+			wantLF:     "line1\nline2\n",
+		},
+		{
+			name:       "mac",
+			content:    "line1\rline2\r",
+			fileformat: "mac",
+			wantLF:     "line1\nline2\n",
+		},
+		{
+			name:       "bom",
+			content:    "\uFEFFline1\nline2",
+			fileformat: "unix",
+			bomb:       true,
+			wantLF:     "line1\nline2",
+		},
+		{
+			name:       "crlf with bom",
+			content:    "\uFEFFline1\r\nline2\r\n",
+			fileformat: "dos",
+			bomb:       true,
+			wantLF:     "line1\nline2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := NormalizeContent(tt.content)
+			if lf != tt.wantLF {
+				t.Errorf("NormalizeContent(%q) = %q, want %q", tt.content, lf, tt.wantLF)
+			}
+
+			if got := ApplyFileFormat(lf, tt.fileformat, tt.bomb); got != tt.content {
+				t.Errorf("ApplyFileFormat(%q, %q, %v) = %q, want %q", lf, tt.fileformat, tt.bomb, got, tt.content)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package nvim
+
+import (
+	"testing"
+
+	"gemini-cli/types"
+)
+
+// recordingRPC records the arguments of each Lua call and the registered
+// notification handlers
+type recordingRPC struct {
+	args     [][]interface{}
+	handlers map[string]func(args ...interface{}) error
+}
+
+func (r *recordingRPC) ExecLua(code string, result interface{}, args ...interface{}) error {
+	r.args = append(r.args, args)
+	return nil
+}
+
+func (r *recordingRPC) RegisterHandler(method string, fn interface{}) error {
+	if r.handlers == nil {
+		r.handlers = make(map[string]func(args ...interface{}) error)
+	}
+	r.handlers[method] = fn.(func(args ...interface{}) error)
+	return nil
+}
+
+func TestOpenDiffAcceptOnSave(t *testing.T) {
+	rpc := &recordingRPC{}
+	c := NewClient(rpc)
+
+	if _, err := c.OpenDiff("/tmp/a.go", "new", "go", false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.OpenDiff("/tmp/a.go", "new", "go", true, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the option the plugin's allow_w_to_accept decides, so no argument is passed
+	if len(rpc.args[0]) != 3 {
+		t.Errorf("OpenDiff(acceptOnSave=false) passed %v, want 3 arguments", rpc.args[0])
+	}
+	if len(rpc.args[1]) != 4 || rpc.args[1][3] != true {
+		t.Errorf("OpenDiff(acceptOnSave=true) passed %v, want a trailing true", rpc.args[1])
+	}
+}
+
+func TestOpenMultiDiffAcceptOnSave(t *testing.T) {
+	rpc := &recordingRPC{}
+	c := NewClient(rpc)
+
+	edits := []types.FileEdit{{FilePath: "/tmp/a.go", NewContent: "a"}, {FilePath: "/tmp/b.go", NewContent: "b"}}
+	if _, err := c.OpenMultiDiff(edits, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.OpenMultiDiff(edits, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rpc.args[0]) != 1 {
+		t.Errorf("OpenMultiDiff(acceptOnSave=false) passed %v, want only the edits", rpc.args[0])
+	}
+	if len(rpc.args[1]) != 2 || rpc.args[1][1] != true {
+		t.Errorf("OpenMultiDiff(acceptOnSave=true) passed %v, want a trailing true", rpc.args[1])
+	}
+}
+
+func TestOpenDiffLayout(t *testing.T) {
+	rpc := &recordingRPC{}
+	c := NewClient(rpc)
+
+	if _, err := c.OpenDiff("/tmp/a.go", "new", "go", false, DiffLayoutTab); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.OpenDiff("/tmp/a.go", "new", "go", true, DiffLayoutHorizontal); err != nil {
+		t.Fatal(err)
+	}
+
+	// The layout is positional, so a nil keeps acceptOnSave unset
+	if len(rpc.args[0]) != 5 || rpc.args[0][3] != nil || rpc.args[0][4] != "tab" {
+		t.Errorf("OpenDiff(layout=tab) passed %v, want nil then \"tab\"", rpc.args[0])
+	}
+	if len(rpc.args[1]) != 5 || rpc.args[1][3] != true || rpc.args[1][4] != "horizontal" {
+		t.Errorf("OpenDiff(acceptOnSave=true, layout=horizontal) passed %v", rpc.args[1])
+	}
+}
+
+func TestDiffAcceptedCallbackOnSave(t *testing.T) {
+	rpc := &recordingRPC{}
+	c := NewClient(rpc)
+
+	var gotPath, gotContent string
+	err := c.RegisterCallbacks(nil, func(filePath, content string) {
+		gotPath, gotContent = filePath, content
+	}, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What the diff buffer's BufWriteCmd sends through accept_diff on :w
+	if err := rpc.handlers["gemini_diff_accepted"]("/tmp/a.go", "one\ntwo", "dos", false); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/tmp/a.go" || gotContent != "one\r\ntwo" {
+		t.Errorf("onDiffAccepted(%q, %q), want /tmp/a.go with dos line endings", gotPath, gotContent)
+	}
+}
@@ -0,0 +1,306 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gemini-cli/logger"
+	"gemini-cli/types"
+)
+
+// GetMessages returns the last maxLines lines of Neovim's :messages history
+func (c *Client) GetMessages(maxLines int) ([]string, error) {
+	logger.Debug("GetMessages called (maxLines=%d)", maxLines)
+
+	var output string
+	err := c.execLua(`return vim.api.nvim_exec2('messages', { output = true }).output`, &output)
+	if err != nil {
+		logger.Error("GetMessages failed: %v", err)
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	if output == "" {
+		return []string{}, nil
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return lines, nil
+}
+
+// optionLua resolves the option scope for an optional file's buffer and window;
+// shared by GetOption and SetOption
+const optionLua = `
+local name, file_path = ...
+local opts = {}
+if file_path ~= '' then
+  local bufnr = require('gemini-cli.buffer').bufnr(file_path)
+  if not bufnr then
+    error('file is not open: ' .. file_path)
+  end
+  local scope = vim.api.nvim_get_option_info2(name, {}).scope
+  if scope == 'buf' then
+    opts.buf = bufnr
+  elseif scope == 'win' and vim.fn.bufwinid(bufnr) ~= -1 then
+    opts.win = vim.fn.bufwinid(bufnr)
+  end
+end
+`
+
+// GetOption returns the value of a Neovim option, scoped to filePath's buffer
+// (or window) for local options when filePath is not empty
+func (c *Client) GetOption(name, filePath string) (interface{}, error) {
+	logger.Debug("GetOption called for %s (%s)", name, filePath)
+
+	var value interface{}
+	err := c.execLua(optionLua+`return vim.api.nvim_get_option_value(name, opts)`, &value, name, filePath)
+	if err != nil {
+		logger.Error("GetOption failed: %v", err)
+		return nil, fmt.Errorf("failed to get option %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// SetOption sets a Neovim option, scoped like GetOption
+func (c *Client) SetOption(name, filePath string, value interface{}) error {
+	logger.Debug("SetOption called for %s (%s) = %v", name, filePath, value)
+
+	err := c.execLua(optionLua+`vim.api.nvim_set_option_value(name, select(3, ...), opts)`, nil, name, filePath, value)
+	if err != nil {
+		logger.Error("SetOption failed: %v", err)
+		return fmt.Errorf("failed to set option %s: %w", name, err)
+	}
+	logger.Info("SetOption completed for %s", name)
+	return nil
+}
+
+// GetRegister returns the content of a Neovim register
+func (c *Client) GetRegister(register string) (string, error) {
+	logger.Debug("GetRegister called for %q", register)
+
+	var content string
+	err := c.execLua(`return vim.fn.getreg(...)`, &content, register)
+	if err != nil {
+		logger.Error("GetRegister failed: %v", err)
+		return "", fmt.Errorf("failed to get register %s: %w", register, err)
+	}
+	return content, nil
+}
+
+// ErrNoClipboard is returned when Neovim has no clipboard provider
+var ErrNoClipboard = errors.New("no clipboard provider")
+
+// clipboardLua reads or, given content, writes a clipboard register. It
+// returns nil when no clipboard provider is available.
+const clipboardLua = `
+local register, content = ...
+if vim.fn.has('clipboard') == 0 then
+  return nil
+end
+if content ~= nil then
+  vim.fn.setreg(register, content)
+  return content
+end
+return vim.fn.getreg(register)
+`
+
+// GetClipboard returns the content of a clipboard register, "+" or "*"
+func (c *Client) GetClipboard(register string) (string, error) {
+	logger.Debug("GetClipboard called for %q", register)
+
+	var content *string
+	if err := c.execLua(clipboardLua, &content, register); err != nil {
+		logger.Error("GetClipboard failed: %v", err)
+		return "", fmt.Errorf("failed to get clipboard: %w", err)
+	}
+	if content == nil {
+		return "", ErrNoClipboard
+	}
+	return *content, nil
+}
+
+// SetClipboard puts content into a clipboard register, "+" or "*"
+func (c *Client) SetClipboard(register, content string) error {
+	logger.Debug("SetClipboard called for %q (%d bytes)", register, len(content))
+
+	var result *string
+	if err := c.execLua(clipboardLua, &result, register, content); err != nil {
+		logger.Error("SetClipboard failed: %v", err)
+		return fmt.Errorf("failed to set clipboard: %w", err)
+	}
+	if result == nil {
+		return ErrNoClipboard
+	}
+	return nil
+}
+
+// RunCommand executes an Ex command and returns its captured output
+func (c *Client) RunCommand(command string) (string, error) {
+	logger.Debug("RunCommand called: %q", command)
+
+	var output string
+	err := c.execLua(`return vim.api.nvim_exec2(..., { output = true }).output`, &output, command)
+	if err != nil {
+		logger.Error("RunCommand failed: %v", err)
+		return "", fmt.Errorf("failed to run command: %w", err)
+	}
+	return output, nil
+}
+
+// SetDiagnosticsDisplay turns diagnostic virtual text and signs on or off; nil
+// leaves a setting unchanged. It returns the settings from before the change.
+func (c *Client) SetDiagnosticsDisplay(virtualText, signs *bool) (*types.DiagnosticsDisplay, error) {
+	logger.Debug("SetDiagnosticsDisplay called")
+
+	opts := map[string]bool{}
+	if virtualText != nil {
+		opts["virtualText"] = *virtualText
+	}
+	if signs != nil {
+		opts["signs"] = *signs
+	}
+
+	previous := &types.DiagnosticsDisplay{}
+	err := c.execLua(`return require('gemini-cli.diagnostics').set_display(...)`, previous, opts)
+	if err != nil {
+		logger.Error("SetDiagnosticsDisplay failed: %v", err)
+		return nil, fmt.Errorf("failed to set diagnostics display: %w", err)
+	}
+	return previous, nil
+}
+
+// RestoreDiagnosticsDisplay restores the diagnostics display settings from
+// before the first SetDiagnosticsDisplay call
+func (c *Client) RestoreDiagnosticsDisplay() error {
+	err := c.execLua(`require('gemini-cli.diagnostics').restore()`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to restore diagnostics display: %w", err)
+	}
+	return nil
+}
+
+// GetDiagnosticCounts returns the diagnostic counts by severity of every
+// loaded file buffer that has diagnostics
+func (c *Client) GetDiagnosticCounts() ([]types.BufferDiagnosticCounts, error) {
+	logger.Debug("GetDiagnosticCounts called")
+
+	var counts []types.BufferDiagnosticCounts
+	err := c.execLua(`return require('gemini-cli.diagnostics').summary()`, &counts)
+	if err != nil {
+		logger.Error("GetDiagnosticCounts failed: %v", err)
+		return nil, fmt.Errorf("failed to count diagnostics: %w", err)
+	}
+	return counts, nil
+}
+
+// editorConfigLua reads the indentation and line ending options of the
+// buffer for a file, falling back to the global values when it isn't open
+const editorConfigLua = `
+local file_path = ...
+local bufnr = require('gemini-cli.buffer').bufnr(file_path)
+local opts, source = vim.go, 'global'
+if bufnr and vim.api.nvim_buf_is_loaded(bufnr) then
+  opts, source = vim.bo[bufnr], 'buffer'
+end
+
+local fileencoding = opts.fileencoding
+if fileencoding == '' then
+  fileencoding = vim.o.encoding
+end
+return {
+  path = file_path,
+  expandtab = opts.expandtab,
+  -- A shiftwidth of 0 means the tabstop is used
+  shiftwidth = opts.shiftwidth ~= 0 and opts.shiftwidth or opts.tabstop,
+  tabstop = opts.tabstop,
+  fileformat = opts.fileformat,
+  fileencoding = fileencoding,
+  source = source,
+}
+`
+
+// GetEditorConfig returns the indentation and line ending settings of the
+// buffer for filePath, or the global settings when the file isn't open
+func (c *Client) GetEditorConfig(filePath string) (*types.EditorConfig, error) {
+	logger.Debug("GetEditorConfig called for %s", filePath)
+
+	config := &types.EditorConfig{}
+	if err := c.execLua(editorConfigLua, config, filePath); err != nil {
+		logger.Error("GetEditorConfig failed: %v", err)
+		return nil, fmt.Errorf("failed to get editor config: %w", err)
+	}
+	return config, nil
+}
+
+// GotoDiagnostic moves the cursor to the next (or, when forward is false, the
+// previous) diagnostic in the current buffer, optionally only of severity
+// ("ERROR", "WARN", "INFO" or "HINT"). It returns nil when there are no more.
+func (c *Client) GotoDiagnostic(forward bool, severity string) (*types.DiagnosticLocation, error) {
+	logger.Debug("GotoDiagnostic called (forward=%v, severity=%q)", forward, severity)
+
+	var sev interface{}
+	if severity != "" {
+		sev = severity
+	}
+	var location *types.DiagnosticLocation
+	err := c.execLua(`return require('gemini-cli.diagnostics').jump(...)`, &location, forward, sev)
+	if err != nil {
+		logger.Error("GotoDiagnostic failed: %v", err)
+		return nil, fmt.Errorf("failed to move to diagnostic: %w", err)
+	}
+	return location, nil
+}
+
+// wordUnderCursorLua returns the <cword> under the cursor of the current
+// window and its byte columns. <cword> jumps ahead to the next word when the
+// cursor is on whitespace, so no word is reported there.
+const wordUnderCursorLua = `
+local win = vim.api.nvim_get_current_win()
+local cursor = vim.api.nvim_win_get_cursor(win)
+local text = vim.api.nvim_get_current_line()
+local result = {
+  path = vim.api.nvim_buf_get_name(vim.api.nvim_win_get_buf(win)),
+  word = '',
+  line = cursor[1],
+  startColumn = 0,
+  endColumn = 0,
+  lineText = text,
+}
+
+local col = cursor[2] + 1
+local char = text:sub(col, col)
+if char == '' or char:match('%s') then
+  return result
+end
+
+-- Find the occurrence of the word that covers the cursor
+local word = vim.fn.expand('<cword>')
+local init = 1
+while word ~= '' do
+  local first, last = text:find(word, init, true)
+  if not first or first > col then
+    break
+  end
+  if col <= last then
+    result.word, result.startColumn, result.endColumn = word, first, last
+    break
+  end
+  init = first + 1
+end
+return result
+`
+
+// WordUnderCursor returns the word under the cursor of the current window
+func (c *Client) WordUnderCursor() (*types.WordUnderCursor, error) {
+	logger.Debug("WordUnderCursor called")
+
+	word := &types.WordUnderCursor{}
+	if err := c.execLua(wordUnderCursorLua, word); err != nil {
+		logger.Error("WordUnderCursor failed: %v", err)
+		return nil, fmt.Errorf("failed to get word under cursor: %w", err)
+	}
+	return word, nil
+}
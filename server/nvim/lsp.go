@@ -0,0 +1,125 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"errors"
+	"fmt"
+
+	"gemini-cli/logger"
+	"gemini-cli/types"
+)
+
+// ErrNoLSPClient is returned when no attached language server supports a request
+var ErrNoLSPClient = errors.New("no LSP client available")
+
+// WorkspaceSymbols queries the attached language servers for symbols matching query,
+// returning at most limit entries
+func (c *Client) WorkspaceSymbols(query string, limit int) ([]types.Symbol, error) {
+	logger.Debug("WorkspaceSymbols called for %q", query)
+
+	var result struct {
+		Supported bool           `msgpack:"supported"`
+		Symbols   []types.Symbol `msgpack:"symbols"`
+	}
+	err := c.execLua(`return require('gemini-cli.lsp').workspace_symbols(...)`, &result, query, limit)
+	if err != nil {
+		logger.Error("WorkspaceSymbols failed: %v", err)
+		return nil, fmt.Errorf("failed to query workspace symbols: %w", err)
+	}
+	if !result.Supported {
+		return nil, ErrNoLSPClient
+	}
+
+	logger.Debug("WorkspaceSymbols found %d symbols", len(result.Symbols))
+	return result.Symbols, nil
+}
+
+// EnclosingSymbol returns the symbol containing the cursor in the current
+// buffer, or the whole file when no symbol provider finds one
+func (c *Client) EnclosingSymbol() (*types.EnclosingSymbol, error) {
+	logger.Debug("EnclosingSymbol called")
+
+	symbol := &types.EnclosingSymbol{}
+	err := c.execLua(`return require('gemini-cli.lsp').enclosing_symbol()`, symbol)
+	if err != nil {
+		logger.Error("EnclosingSymbol failed: %v", err)
+		return nil, fmt.Errorf("failed to find enclosing symbol: %w", err)
+	}
+	return symbol, nil
+}
+
+// DocumentSymbols returns the outline of the buffer for filePath, at most
+// limit symbols, from its language servers or else tree-sitter
+func (c *Client) DocumentSymbols(filePath string, limit int) (*types.DocumentOutline, error) {
+	logger.Debug("DocumentSymbols called for %s", filePath)
+
+	var outline *types.DocumentOutline
+	err := c.execLua(`return require('gemini-cli.lsp').document_symbols(...)`, &outline, filePath, limit)
+	if err != nil {
+		logger.Error("DocumentSymbols failed: %v", err)
+		return nil, fmt.Errorf("failed to get document symbols: %w", err)
+	}
+	if outline == nil {
+		return nil, ErrBufferNotOpen
+	}
+	return outline, nil
+}
+
+// LSPClients returns the language servers attached to the buffer for filePath
+func (c *Client) LSPClients(filePath string) ([]types.LSPClient, error) {
+	logger.Debug("LSPClients called for %s", filePath)
+
+	var result *struct {
+		Clients []types.LSPClient `msgpack:"clients"`
+	}
+	err := c.execLua(`return require('gemini-cli.lsp').clients(...)`, &result, filePath)
+	if err != nil {
+		logger.Error("LSPClients failed: %v", err)
+		return nil, fmt.Errorf("failed to list LSP clients: %w", err)
+	}
+	if result == nil {
+		return nil, ErrBufferNotOpen
+	}
+	return result.Clients, nil
+}
+
+// PrepareRename asks the language server to rename the symbol at a 1-based
+// line and byte column of the buffer for filePath, returning the files the
+// edit would change. Nothing is applied until ApplyRename is called with the
+// plan's ID; only the latest plan can be applied.
+func (c *Client) PrepareRename(filePath string, line, column int, newName string) (*types.RenamePlan, error) {
+	logger.Debug("PrepareRename called for %s:%d:%d -> %q", filePath, line, column, newName)
+
+	var result *struct {
+		Supported bool `msgpack:"supported"`
+		types.RenamePlan
+	}
+	err := c.execLua(`return require('gemini-cli.lsp').prepare_rename(...)`, &result, filePath, line, column, newName)
+	if err != nil {
+		logger.Error("PrepareRename failed: %v", err)
+		return nil, fmt.Errorf("failed to rename symbol: %w", err)
+	}
+	if result == nil {
+		return nil, ErrBufferNotOpen
+	}
+	if !result.Supported {
+		return nil, ErrNoLSPClient
+	}
+	return &result.RenamePlan, nil
+}
+
+// ApplyRename applies the rename planned by PrepareRename and saves the
+// changed buffers, returning the files left unsaved because they already had
+// unsaved edits
+func (c *Client) ApplyRename(id int) ([]string, error) {
+	logger.Debug("ApplyRename called for %d", id)
+
+	var result struct {
+		Unsaved []string `msgpack:"unsaved"`
+	}
+	if err := c.execLua(`return require('gemini-cli.lsp').apply_rename(...)`, &result, id); err != nil {
+		logger.Error("ApplyRename failed: %v", err)
+		return nil, fmt.Errorf("failed to apply rename: %w", err)
+	}
+	return result.Unsaved, nil
+}
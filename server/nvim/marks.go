@@ -0,0 +1,86 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"fmt"
+
+	"gemini-cli/logger"
+	"gemini-cli/types"
+)
+
+// getMarksLua lists the lettered marks: a-z of the current buffer and the
+// A-Z file marks
+const getMarksLua = `
+local marks = {}
+local function collect(items, path)
+  for _, item in ipairs(items) do
+    local name = item.mark:sub(2)
+    if name:match('^%a$') then
+      table.insert(marks, {
+        mark = name,
+        path = path or vim.fn.fnamemodify(item.file, ':p'),
+        line = item.pos[2],
+        column = item.pos[3],
+      })
+    end
+  end
+end
+
+local current = vim.api.nvim_get_current_buf()
+collect(vim.fn.getmarklist(current), vim.api.nvim_buf_get_name(current))
+collect(vim.fn.getmarklist())
+return marks
+`
+
+// setMarkLua sets a mark in the buffer for a file, or the current buffer when
+// the path is empty. It returns nil when the file is not loaded.
+const setMarkLua = `
+local name, file_path, line, column = ...
+local bufnr = vim.api.nvim_get_current_buf()
+if file_path ~= '' then
+  bufnr = require('gemini-cli.buffer').bufnr(file_path)
+  if not bufnr or not vim.api.nvim_buf_is_loaded(bufnr) then
+    return nil
+  end
+end
+if line > vim.api.nvim_buf_line_count(bufnr) then
+  error('line ' .. line .. ' is past the end of the buffer')
+end
+
+vim.api.nvim_buf_set_mark(bufnr, name, line, column - 1, {})
+return {
+  mark = name,
+  path = vim.api.nvim_buf_get_name(bufnr),
+  line = line,
+  column = column,
+}
+`
+
+// GetMarks returns the lettered marks: a-z of the current buffer and the A-Z
+// file marks
+func (c *Client) GetMarks() ([]types.Mark, error) {
+	logger.Debug("GetMarks called")
+
+	var marks []types.Mark
+	if err := c.execLua(getMarksLua, &marks); err != nil {
+		logger.Error("GetMarks failed: %v", err)
+		return nil, fmt.Errorf("failed to get marks: %w", err)
+	}
+	return marks, nil
+}
+
+// SetMark sets mark at a 1-based line and column of the buffer for filePath,
+// or of the current buffer when filePath is empty
+func (c *Client) SetMark(mark, filePath string, line, column int) (*types.Mark, error) {
+	logger.Debug("SetMark called: %s at %s:%d:%d", mark, filePath, line, column)
+
+	var result *types.Mark
+	if err := c.execLua(setMarkLua, &result, mark, filePath, line, column); err != nil {
+		logger.Error("SetMark failed: %v", err)
+		return nil, fmt.Errorf("failed to set mark %s: %w", mark, err)
+	}
+	if result == nil {
+		return nil, ErrBufferNotOpen
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"fmt"
+
+	"gemini-cli/logger"
+	"gemini-cli/types"
+)
+
+// quickfixLua converts the quickfix list, or the location list of window
+// winid when one is given, into QuickfixEntry tables
+const quickfixLua = `
+local winid = ...
+local items
+if winid == nil then
+  items = vim.fn.getqflist()
+else
+  if winid ~= 0 and not vim.api.nvim_win_is_valid(winid) then
+    error('invalid window: ' .. winid)
+  end
+  items = vim.fn.getloclist(winid)
+end
+
+local entries = {}
+for _, item in ipairs(items) do
+  local path = ''
+  if item.bufnr ~= 0 and vim.api.nvim_buf_is_valid(item.bufnr) then
+    path = vim.api.nvim_buf_get_name(item.bufnr)
+  end
+  table.insert(entries, {
+    path = path,
+    line = item.lnum,
+    column = item.col,
+    text = item.text,
+    type = item.type,
+  })
+end
+return entries
+`
+
+// GetQuickfix returns the entries of the quickfix list
+func (c *Client) GetQuickfix() ([]types.QuickfixEntry, error) {
+	logger.Debug("GetQuickfix called")
+
+	var entries []types.QuickfixEntry
+	if err := c.execLua(quickfixLua, &entries, nil); err != nil {
+		logger.Error("GetQuickfix failed: %v", err)
+		return nil, fmt.Errorf("failed to get quickfix list: %w", err)
+	}
+	return entries, nil
+}
+
+// GetLocList returns the entries of a window's location list; window 0 is
+// the current window
+func (c *Client) GetLocList(window int) ([]types.QuickfixEntry, error) {
+	logger.Debug("GetLocList called for window %d", window)
+
+	var entries []types.QuickfixEntry
+	if err := c.execLua(quickfixLua, &entries, window); err != nil {
+		logger.Error("GetLocList failed: %v", err)
+		return nil, fmt.Errorf("failed to get location list: %w", err)
+	}
+	return entries, nil
+}
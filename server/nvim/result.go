@@ -0,0 +1,56 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/neovim/go-client/msgpack"
+)
+
+// ResultTypeError reports a Lua entrypoint that returned a value of the wrong
+// type, which usually means the Lua plugin and the server are different versions
+type ResultTypeError struct {
+	Entrypoint string // e.g. "gemini-cli.diff.close_diff"
+	Expected   string // Go type the result decodes into
+	Got        string // MessagePack type Neovim returned
+}
+
+// Error implements the error interface
+func (e *ResultTypeError) Error() string {
+	return fmt.Sprintf("%s returned %s, expected %s (is the gemini-cli plugin the same version as the server?)",
+		e.Entrypoint, e.Got, e.Expected)
+}
+
+// entrypointPattern extracts "module.function" from require('module').function(...)
+var entrypointPattern = regexp.MustCompile(`require\('([^']+)'\)\.(\w+)`)
+
+// luaEntrypoint names the Lua function a chunk calls, for error messages
+func luaEntrypoint(code string) string {
+	if m := entrypointPattern.FindStringSubmatch(code); m != nil {
+		return m[1] + "." + m[2]
+	}
+	return "inline Lua"
+}
+
+// execLua runs code via ExecLua and turns result decoding failures (a nil or
+// wrongly typed return value) into a descriptive ResultTypeError
+func (c *Client) execLua(code string, result interface{}, args ...interface{}) error {
+	err := c.nvim.ExecLua(code, result, args...)
+
+	var convertErr *msgpack.DecodeConvertError
+	if errors.As(err, &convertErr) {
+		expected := "a value"
+		if result != nil {
+			expected = reflect.TypeOf(result).Elem().String()
+		}
+		got := convertErr.SrcType.String()
+		if convertErr.SrcType == msgpack.Nil {
+			got = "nil"
+		}
+		return &ResultTypeError{Entrypoint: luaEntrypoint(code), Expected: expected, Got: got}
+	}
+	return err
+}
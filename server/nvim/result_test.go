@@ -0,0 +1,119 @@
+package nvim
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/neovim/go-client/msgpack"
+)
+
+// encodingRPC round-trips a canned Lua return value through MessagePack so
+// results are decoded exactly as they would be over a real connection
+type encodingRPC struct {
+	value interface{}
+}
+
+func (r *encodingRPC) ExecLua(code string, result interface{}, args ...interface{}) error {
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).Encode(r.value); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return msgpack.NewDecoder(&buf).Decode(result)
+}
+
+func (r *encodingRPC) RegisterHandler(method string, fn interface{}) error {
+	return nil
+}
+
+func TestExecLuaResultTypeError(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		call       func(c *Client) error
+		entrypoint string
+		got        string
+	}{
+		{
+			name:  "close diff returns nil",
+			value: nil,
+			call: func(c *Client) error {
+				_, err := c.CloseDiff("/tmp/a.go")
+				return err
+			},
+			entrypoint: "gemini-cli.diff.close_diff",
+			got:        "nil",
+		},
+		{
+			name:  "context returns string",
+			value: "not a table",
+			call: func(c *Client) error {
+				_, err := c.GetContext()
+				return err
+			},
+			entrypoint: "gemini-cli.context.get_context",
+			got:        "String",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(NewClient(&encodingRPC{value: tt.value}))
+
+			var typeErr *ResultTypeError
+			if !errors.As(err, &typeErr) {
+				t.Fatalf("%s error = %v, want a *ResultTypeError", tt.name, err)
+			}
+			if typeErr.Entrypoint != tt.entrypoint {
+				t.Errorf("ResultTypeError.Entrypoint = %q, want %q", typeErr.Entrypoint, tt.entrypoint)
+			}
+			if typeErr.Got != tt.got {
+				t.Errorf("ResultTypeError.Got = %q, want %q", typeErr.Got, tt.got)
+			}
+			if !strings.Contains(err.Error(), "same version") {
+				t.Errorf("ResultTypeError.Error() = %q, want a version hint", err.Error())
+			}
+		})
+	}
+}
+
+func TestGetContextVisibleRange(t *testing.T) {
+	c := NewClient(&encodingRPC{value: map[string]interface{}{
+		"workspaceState": map[string]interface{}{
+			"openFiles": []interface{}{
+				map[string]interface{}{
+					"path":         "/tmp/a.go",
+					"isActive":     true,
+					"visibleRange": map[string]interface{}{"start": 10, "end": 52},
+				},
+			},
+		},
+	}})
+
+	context, err := c.GetContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := context.WorkspaceState.OpenFiles[0].VisibleRange
+	if got == nil || got.Start != 10 || got.End != 52 {
+		t.Errorf("VisibleRange = %+v, want lines 10-52", got)
+	}
+}
+
+func TestGetDiagnosticCountsDecodesCounts(t *testing.T) {
+	c := NewClient(&encodingRPC{value: []interface{}{
+		map[string]interface{}{"path": "/a.go", "error": 2, "warning": 0, "info": 1, "hint": 0},
+	}})
+
+	counts, err := c.GetDiagnosticCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 1 || counts[0].Path != "/a.go" || counts[0].Error != 2 || counts[0].Info != 1 {
+		t.Errorf("GetDiagnosticCounts() = %+v, want /a.go with 2 errors and 1 info", counts)
+	}
+}
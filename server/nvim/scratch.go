@@ -0,0 +1,35 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"fmt"
+
+	"gemini-cli/logger"
+)
+
+// ShowScratch shows content in a throwaway buffer opened in a split and
+// returns its buffer number. A non-zero buffer updates that scratch buffer
+// instead of creating a new one.
+func (c *Client) ShowScratch(title, content, filetype string, buffer int) (int, error) {
+	logger.Debug("ShowScratch called: %q (buffer=%d, filetype=%q)", title, buffer, filetype)
+
+	var bufnr int
+	err := c.execLua(`return require('gemini-cli.scratch').show(...)`, &bufnr, title, NormalizeContent(content), filetype, buffer)
+	if err != nil {
+		logger.Error("ShowScratch failed: %v", err)
+		return 0, fmt.Errorf("failed to show scratch buffer: %w", err)
+	}
+	return bufnr, nil
+}
+
+// CloseScratch closes a scratch buffer created by ShowScratch
+func (c *Client) CloseScratch(buffer int) error {
+	logger.Debug("CloseScratch called for buffer %d", buffer)
+
+	err := c.execLua(`require('gemini-cli.scratch').close(...)`, nil, buffer)
+	if err != nil {
+		logger.Error("CloseScratch failed: %v", err)
+		return fmt.Errorf("failed to close scratch buffer: %w", err)
+	}
+	return nil
+}
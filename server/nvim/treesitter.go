@@ -0,0 +1,68 @@
+// Package nvim provides a client for communicating with Neovim via RPC.
+package nvim
+
+import (
+	"fmt"
+
+	"gemini-cli/logger"
+	"gemini-cli/types"
+)
+
+// nodeAtLua finds the named tree-sitter node at a 1-based line and byte
+// column of a file's buffer, falling back to the whole line when the buffer
+// has no parser. It returns nil when the file is not loaded.
+const nodeAtLua = `
+local file_path, line, column = ...
+local bufnr = require('gemini-cli.buffer').bufnr(file_path)
+if not bufnr or not vim.api.nvim_buf_is_loaded(bufnr) then
+  return nil
+end
+if line > vim.api.nvim_buf_line_count(bufnr) then
+  error('line ' .. line .. ' is past the end of the buffer')
+end
+
+local has_parser, parser = pcall(vim.treesitter.get_parser, bufnr)
+if has_parser and parser then
+  parser:parse()
+  local ok, node = pcall(vim.treesitter.get_node, { bufnr = bufnr, pos = { line - 1, column - 1 } })
+  if ok and node then
+    local start_row, start_col, end_row, end_col = node:range()
+    return {
+      type = node:type(),
+      startLine = start_row + 1,
+      startColumn = start_col + 1,
+      endLine = end_row + 1,
+      endColumn = end_col,
+      text = vim.treesitter.get_node_text(node, bufnr),
+      source = 'treesitter',
+    }
+  end
+end
+
+local text = vim.api.nvim_buf_get_lines(bufnr, line - 1, line, false)[1] or ''
+return {
+  type = 'line',
+  startLine = line,
+  startColumn = 1,
+  endLine = line,
+  endColumn = #text,
+  text = text,
+  source = 'line',
+}
+`
+
+// NodeAt returns the syntax node at a 1-based line and byte column of the
+// buffer for filePath, or that line when tree-sitter can't parse the buffer
+func (c *Client) NodeAt(filePath string, line, column int) (*types.SyntaxNode, error) {
+	logger.Debug("NodeAt called for %s:%d:%d", filePath, line, column)
+
+	var node *types.SyntaxNode
+	if err := c.execLua(nodeAtLua, &node, filePath, line, column); err != nil {
+		logger.Error("NodeAt failed: %v", err)
+		return nil, fmt.Errorf("failed to get node: %w", err)
+	}
+	if node == nil {
+		return nil, ErrBufferNotOpen
+	}
+	return node, nil
+}
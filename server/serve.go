@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Listener restart policy: a failed HTTP listener is replaced on a new random
+// port up to maxListenerRestarts times, waiting a little longer each time
+const (
+	maxListenerRestarts    = 3
+	listenerRestartBackoff = 500 * time.Millisecond
+)
+
+// listen opens the HTTP listener on a random loopback port
+func listen() (net.Listener, int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, 0, err
+	}
+	return listener, listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// serveHTTP serves httpServer on listener until it is shut down. When serving
+// fails, the listener is recreated on a new port and restarted is called with
+// that port so clients can be pointed at it. It returns nil once the server
+// is shut down, or an error after maxListenerRestarts failed restarts.
+func serveHTTP(httpServer *http.Server, listener net.Listener, restarted func(port int)) error {
+	restarts := 0
+	for {
+		err := httpServer.Serve(listener)
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		log.Printf("HTTP server error: %v", err)
+
+		listener = nil
+		var port int
+		for listener == nil {
+			if restarts == maxListenerRestarts {
+				return fmt.Errorf("listener failed after %d restarts: %w", restarts, err)
+			}
+			restarts++
+			time.Sleep(listenerRestartBackoff * time.Duration(restarts))
+
+			listener, port, err = listen()
+			if err != nil {
+				log.Printf("Failed to recreate listener (attempt %d): %v", restarts, err)
+			}
+		}
+
+		log.Printf("MCP server listening on port %d", port)
+		restarted(port)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// failingListener fails its first Accept, as a broken network stack would
+type failingListener struct {
+	net.Listener
+	failed bool
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if !l.failed {
+		l.failed = true
+		return nil, errors.New("listener broke")
+	}
+	return l.Listener.Accept()
+}
+
+func TestServeHTTPRestartsOnNewPort(t *testing.T) {
+	listener, _, err := listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+
+	var restartedOn int
+	served := make(chan error, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- serveHTTP(httpServer, &failingListener{Listener: listener}, func(port int) {
+			restartedOn = port
+			// The new listener is open, so a request waits for Serve to accept it
+			go func() {
+				resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+				if err == nil {
+					_ = resp.Body.Close()
+					if resp.StatusCode != http.StatusNoContent {
+						err = fmt.Errorf("status %d", resp.StatusCode)
+					}
+				}
+				served <- err
+			}()
+		})
+	}()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("request to the restarted listener failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveHTTP never restarted the listener")
+	}
+	if restartedOn == 0 {
+		t.Error("restarted was not given the new port")
+	}
+
+	if err := httpServer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serveHTTP() after shutdown = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveHTTP did not return after shutdown")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// loadOrCreateToken returns the auth token stored in path, generating and
+// storing a new one (mode 0600) when the file doesn't exist yet
+func loadOrCreateToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", path)
+		}
+		if info, statErr := os.Stat(path); statErr == nil && info.Mode().Perm()&0o077 != 0 {
+			log.Printf("Warning: token file %s is readable by other users (mode %v); use chmod 600", path, info.Mode().Perm())
+		}
+		return token, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	token := uuid.New().String()
+	if err := writeFileAtomic(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write token file: %w", err)
+	}
+	log.Printf("Stored new auth token in %s", path)
+	return token, nil
+}
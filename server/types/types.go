@@ -3,34 +3,76 @@ package types //nolint:revive
 
 // IdeContext represents the current state of the IDE
 type IdeContext struct {
-	WorkspaceState *WorkspaceState `json:"workspaceState,omitempty"`
+	WorkspaceState *WorkspaceState `json:"workspaceState,omitempty" msgpack:"workspaceState"`
 }
 
 // WorkspaceState contains workspace-level information
 type WorkspaceState struct {
-	OpenFiles []File `json:"openFiles,omitempty"`
-	IsTrusted *bool  `json:"isTrusted,omitempty"`
+	OpenFiles []File `json:"openFiles,omitempty" msgpack:"openFiles"`
+	IsTrusted *bool  `json:"isTrusted,omitempty" msgpack:"isTrusted"`
 }
 
 // File represents an open file in the IDE
 type File struct {
-	Path         string  `json:"path"`
-	Timestamp    int64   `json:"timestamp"`
-	IsActive     *bool   `json:"isActive,omitempty"`
-	Cursor       *Cursor `json:"cursor,omitempty"`
-	SelectedText *string `json:"selectedText,omitempty"`
+	Path         string  `json:"path" msgpack:"path"`
+	Timestamp    int64   `json:"timestamp" msgpack:"timestamp"`
+	IsActive     *bool   `json:"isActive,omitempty" msgpack:"isActive"`
+	Cursor       *Cursor `json:"cursor,omitempty" msgpack:"cursor"`
+	SelectedText *string `json:"selectedText,omitempty" msgpack:"selectedText"`
+	// VisibleRange is the lines on screen in the active window
+	VisibleRange *LineRange `json:"visibleRange,omitempty" msgpack:"visibleRange"`
+}
+
+// LineRange is an inclusive range of lines
+type LineRange struct {
+	Start int `json:"start" msgpack:"start"` // 1-based
+	End   int `json:"end" msgpack:"end"`     // 1-based, inclusive
 }
 
 // Cursor represents cursor position in a file
 type Cursor struct {
-	Line      int `json:"line"`      // 1-based
-	Character int `json:"character"` // 1-based
+	Line      int `json:"line" msgpack:"line"`           // 1-based
+	Character int `json:"character" msgpack:"character"` // 1-based
 }
 
 // OpenDiffRequest is the request to open a diff view
 type OpenDiffRequest struct {
 	FilePath   string `json:"filePath"`
 	NewContent string `json:"newContent"`
+	Language   string `json:"language,omitempty"`
+}
+
+// FileEdit is the proposed new content for one file of a multi-file edit
+type FileEdit struct {
+	FilePath   string `json:"filePath" msgpack:"filePath"`
+	NewContent string `json:"newContent" msgpack:"newContent"`
+	Filetype   string `json:"filetype,omitempty" msgpack:"filetype"`
+}
+
+// FileEditResult reports the outcome of one file of a multi-file edit
+type FileEditResult struct {
+	FilePath string `json:"filePath" msgpack:"filePath"`
+	Success  bool   `json:"success" msgpack:"success"`
+	Error    string `json:"error,omitempty" msgpack:"error"`
+}
+
+// Hunk is a contiguous change between a file and its proposed content
+type Hunk struct {
+	OldStart int `json:"oldStart" msgpack:"oldStart"` // 1-based; for insertions, the line after which lines are added
+	OldCount int `json:"oldCount" msgpack:"oldCount"`
+	NewStart int `json:"newStart" msgpack:"newStart"` // 1-based; for deletions, the line after which lines are removed
+	NewCount int `json:"newCount" msgpack:"newCount"`
+}
+
+// DiffStats summarizes a diff when it is accepted, rejected or closed
+type DiffStats struct {
+	FilePath string `json:"filePath"`
+	// HunksKnown is false for diffs whose layout the server never saw
+	// (multi-file edits); the counts are then zero
+	HunksKnown   bool `json:"hunksKnown"`
+	Hunks        int  `json:"hunks"`
+	LinesAdded   int  `json:"linesAdded"`
+	LinesRemoved int  `json:"linesRemoved"`
 }
 
 // CloseDiffRequest is the request to close a diff view
@@ -79,6 +121,12 @@ type MCPResponse struct {
 	Error   *MCPError   `json:"error,omitempty"`
 }
 
+// ClientInfo identifies the MCP client, as sent in initialize
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
 // MCPError represents an MCP error
 type MCPError struct {
 	Code    int         `json:"code"`
@@ -97,10 +145,345 @@ type MCPNotification struct {
 type ToolCallResult struct {
 	Content []ContentBlock `json:"content"`
 	IsError bool           `json:"isError,omitempty"`
+	// Code classifies a failure so clients can branch on it (see ErrorCode*)
+	Code string `json:"code,omitempty"`
 }
 
+// Tool error codes carried in ToolCallResult.Code
+const (
+	ErrorCodeInvalidArgument = "invalid_argument"
+	ErrorCodeNotFound        = "not_found"
+	ErrorCodeOutOfWorkspace  = "out_of_workspace"
+	ErrorCodeNvimError       = "nvim_error"
+	ErrorCodeReadOnly        = "read_only"
+	ErrorCodeNotModifiable   = "not_modifiable"
+	ErrorCodeTooLarge        = "too_large"
+	ErrorCodeStale           = "stale"
+	ErrorCodeUnsupported     = "unsupported"
+)
+
 // ContentBlock represents content in MCP responses
 type ContentBlock struct {
 	Type string `json:"type"` // "text"
 	Text string `json:"text"`
 }
+
+// Symbol represents a code symbol reported by a language server
+type Symbol struct {
+	Name string `json:"name" msgpack:"name"`
+	Kind string `json:"kind" msgpack:"kind"`
+	Path string `json:"path" msgpack:"path"`
+	Line int    `json:"line" msgpack:"line"` // 1-based
+}
+
+// QuickfixEntry is an item of the quickfix or a location list
+type QuickfixEntry struct {
+	Path   string `json:"path" msgpack:"path"`
+	Line   int    `json:"line" msgpack:"line"`     // 1-based, 0 when the item has no line
+	Column int    `json:"column" msgpack:"column"` // 1-based, 0 when the item has no column
+	Text   string `json:"text" msgpack:"text"`
+	Type   string `json:"type" msgpack:"type"` // e.g. "E" or "W", empty when unset
+}
+
+// Mark is a named position in a file
+type Mark struct {
+	Mark   string `json:"mark" msgpack:"mark"` // a-z are buffer-local, A-Z are file marks
+	Path   string `json:"path" msgpack:"path"`
+	Line   int    `json:"line" msgpack:"line"`     // 1-based
+	Column int    `json:"column" msgpack:"column"` // 1-based
+}
+
+// EnclosingSymbol is the symbol (function, class, ...) containing the cursor
+type EnclosingSymbol struct {
+	Name       string `json:"name" msgpack:"name"`
+	Kind       string `json:"kind" msgpack:"kind"`
+	Path       string `json:"path" msgpack:"path"`
+	CursorLine int    `json:"cursorLine" msgpack:"cursorLine"` // 1-based
+	StartLine  int    `json:"startLine" msgpack:"startLine"`   // 1-based, inclusive
+	EndLine    int    `json:"endLine" msgpack:"endLine"`       // 1-based, inclusive
+	// Source is how the symbol was found: "lsp", "treesitter", or "file"
+	// when neither found one and the whole file is returned
+	Source string `json:"source" msgpack:"source"`
+}
+
+// DocumentSymbol is an entry of a file's outline
+type DocumentSymbol struct {
+	Name      string `json:"name" msgpack:"name"`
+	Kind      string `json:"kind" msgpack:"kind"`
+	StartLine int    `json:"startLine" msgpack:"startLine"` // 1-based, inclusive
+	EndLine   int    `json:"endLine" msgpack:"endLine"`     // 1-based, inclusive
+	Depth     int    `json:"depth" msgpack:"depth"`         // 0 for top-level symbols
+}
+
+// DocumentOutline is the symbols of a file in document order
+type DocumentOutline struct {
+	Path string `json:"path" msgpack:"-"`
+	// Source is how the symbols were found: "lsp", "treesitter", or "none"
+	// when neither is available for the file
+	Source  string           `json:"source" msgpack:"source"`
+	Symbols []DocumentSymbol `json:"symbols" msgpack:"symbols"`
+}
+
+// LSPClient is a language server attached to a buffer
+type LSPClient struct {
+	ID   int    `json:"id" msgpack:"id"`
+	Name string `json:"name" msgpack:"name"`
+	// Capabilities are the providers the server advertises, e.g. "renameProvider"
+	Capabilities []string `json:"capabilities" msgpack:"capabilities"`
+}
+
+// RenamePlan is a rename computed by a language server but not yet applied
+type RenamePlan struct {
+	ID    int      `msgpack:"id"`
+	Files []string `msgpack:"files"`
+}
+
+// RenameResult is the outcome of renameSymbol
+type RenameResult struct {
+	NewName string   `json:"newName"`
+	Files   []string `json:"files"`
+	// Unsaved are changed files whose buffers already had unsaved edits, so
+	// they were left modified instead of written
+	Unsaved []string `json:"unsaved,omitempty"`
+}
+
+// ContentMeasure is the size of a text or file as measured by measureContent
+type ContentMeasure struct {
+	Path       string `json:"path,omitempty"`
+	Bytes      int    `json:"bytes"`
+	Lines      int    `json:"lines"`
+	Characters int    `json:"characters"`
+	// EstimatedTokens is approximate; Tokenizer names how it was counted
+	EstimatedTokens int    `json:"estimatedTokens"`
+	Tokenizer       string `json:"tokenizer"`
+}
+
+// DiagnosticsDisplay is whether diagnostic virtual text and signs are shown
+type DiagnosticsDisplay struct {
+	VirtualText bool `json:"virtualText" msgpack:"virtualText"`
+	Signs       bool `json:"signs" msgpack:"signs"`
+}
+
+// RecentFile is a recently edited file
+type RecentFile struct {
+	Path      string `json:"path"`
+	Timestamp int64  `json:"timestamp"` // modification time, unix seconds
+}
+
+// DiagnosticLocation is a diagnostic the cursor was moved to
+type DiagnosticLocation struct {
+	Path     string `json:"path" msgpack:"path"`
+	Line     int    `json:"line" msgpack:"line"`         // 1-based
+	Column   int    `json:"column" msgpack:"column"`     // 1-based
+	Severity string `json:"severity" msgpack:"severity"` // "error", "warning", "info" or "hint"
+	Message  string `json:"message" msgpack:"message"`
+	Source   string `json:"source,omitempty" msgpack:"source"`
+}
+
+// DiagnosticCounts is the number of diagnostics of each severity
+type DiagnosticCounts struct {
+	Error   int `json:"error" msgpack:"error"`
+	Warning int `json:"warning" msgpack:"warning"`
+	Info    int `json:"info" msgpack:"info"`
+	Hint    int `json:"hint" msgpack:"hint"`
+}
+
+// BufferDiagnosticCounts is the diagnostic counts of one buffer
+type BufferDiagnosticCounts struct {
+	Path string `json:"path" msgpack:"path"`
+	DiagnosticCounts
+}
+
+// DiagnosticsSummary is the diagnostic counts of every open buffer that has
+// any, keyed by path, and their total
+type DiagnosticsSummary struct {
+	Files map[string]DiagnosticCounts `json:"files"`
+	Total DiagnosticCounts            `json:"total"`
+}
+
+// EditorConfig is the indentation and line ending settings for a file
+type EditorConfig struct {
+	Path         string `json:"path" msgpack:"path"`
+	ExpandTab    bool   `json:"expandtab" msgpack:"expandtab"`
+	ShiftWidth   int    `json:"shiftwidth" msgpack:"shiftwidth"`
+	TabStop      int    `json:"tabstop" msgpack:"tabstop"`
+	FileFormat   string `json:"fileformat" msgpack:"fileformat"`     // "unix", "dos" or "mac"
+	FileEncoding string `json:"fileencoding" msgpack:"fileencoding"` // e.g. "utf-8"
+	// Source is "buffer" for an open file, or "global" when the file isn't
+	// open and the global option values are returned
+	Source string `json:"source" msgpack:"source"`
+}
+
+// NumberedLine is a single line of a file along with its line number
+type NumberedLine struct {
+	Line int    `json:"line" msgpack:"line"` // 1-based
+	Text string `json:"text" msgpack:"text"`
+}
+
+// BufferInfo describes a Neovim buffer
+type BufferInfo struct {
+	Buffer   int    `json:"buffer" msgpack:"buffer"`
+	Path     string `json:"path" msgpack:"path"`
+	Filetype string `json:"filetype" msgpack:"filetype"`
+	Modified bool   `json:"modified" msgpack:"modified"`
+}
+
+// ContextWindow is a slice of a buffer centered on the cursor
+type ContextWindow struct {
+	Path       string         `json:"path" msgpack:"path"`
+	CursorLine int            `json:"cursorLine" msgpack:"cursorLine"` // 1-based
+	StartLine  int            `json:"startLine" msgpack:"startLine"`   // 1-based, inclusive
+	EndLine    int            `json:"endLine" msgpack:"endLine"`       // 1-based, inclusive
+	Lines      []NumberedLine `json:"lines" msgpack:"lines"`
+}
+
+// FileRange is a range of lines read from a buffer, or from disk when the
+// file isn't open
+type FileRange struct {
+	Path       string         `json:"path" msgpack:"path"`
+	StartLine  int            `json:"startLine" msgpack:"startLine"` // 1-based, inclusive
+	EndLine    int            `json:"endLine" msgpack:"endLine"`     // 1-based, inclusive
+	TotalLines int            `json:"totalLines" msgpack:"totalLines"`
+	Source     string         `json:"source" msgpack:"-"` // "buffer" or "disk"
+	Lines      []NumberedLine `json:"lines" msgpack:"lines"`
+	// Sha256 hashes the whole file, as getFileHash does
+	Sha256 string `json:"sha256,omitempty" msgpack:"-"`
+	// Encoding is what the lines were decoded from: the buffer's
+	// 'fileencoding', or the encoding used to read the file from disk
+	Encoding string `json:"encoding,omitempty" msgpack:"encoding"`
+}
+
+// FileContent is the content of a file read from a Neovim buffer
+type FileContent struct {
+	Path      string `json:"path" msgpack:"path"`
+	Content   string `json:"content" msgpack:"content"`
+	Truncated bool   `json:"truncated" msgpack:"truncated"`
+}
+
+// GitCommit identifies a commit in the history of a file
+type GitCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Date    string `json:"date"` // RFC 3339
+	Summary string `json:"summary"`
+}
+
+// GitContext is the version-control context of a file
+type GitContext struct {
+	IsGitRepo  bool       `json:"isGitRepo"`
+	Path       string     `json:"path"`
+	StartLine  int        `json:"startLine,omitempty"`
+	EndLine    int        `json:"endLine,omitempty"`
+	LastCommit *GitCommit `json:"lastCommit,omitempty"`
+	Diff       string     `json:"diff"`
+	Note       string     `json:"note,omitempty"`
+}
+
+// GitStatus is the branch and working tree state of a repository
+type GitStatus struct {
+	IsGitRepo bool   `json:"isGitRepo"`
+	Root      string `json:"root"`
+	Branch    string `json:"branch,omitempty"`
+	// Detached is set when HEAD is not on a branch; Head is then the commit
+	Detached  bool   `json:"detached,omitempty"`
+	Head      string `json:"head,omitempty"`
+	Staged    int    `json:"staged"`
+	Unstaged  int    `json:"unstaged"`
+	Untracked int    `json:"untracked"`
+	Note      string `json:"note,omitempty"`
+}
+
+// WorkspaceFiles is the files of one workspace root
+type WorkspaceFiles struct {
+	Root  string   `json:"root"`
+	Files []string `json:"files"` // relative to Root, slash-separated
+}
+
+// FileListing is the result of listFiles
+type FileListing struct {
+	Roots []WorkspaceFiles `json:"roots"`
+	// Truncated is set when more files matched than were returned
+	Truncated bool `json:"truncated"`
+}
+
+// ServerStatus is the server's own state, as reported by serverStatus
+type ServerStatus struct {
+	Version       string         `json:"version"`
+	UptimeSeconds int64          `json:"uptimeSeconds"`
+	Nvim          string         `json:"nvim"` // "connected", "unresponsive", or "error: ..."
+	Client        ClientInfo     `json:"client"`
+	ToolCalls     map[string]int `json:"toolCalls"`
+	ActiveDiffs   []string       `json:"activeDiffs"`
+	Subscribers   int            `json:"subscribers"`
+	Config        ServerConfig   `json:"config"`
+}
+
+// ServerConfig is the effective configuration reported by serverStatus
+type ServerConfig struct {
+	AuthToken              string   `json:"authToken"` // always redacted
+	WorkspaceRoots         []string `json:"workspaceRoots"`
+	CORSOrigin             string   `json:"corsOrigin"`
+	RelativePaths          bool     `json:"relativePaths"`
+	ReadOnly               bool     `json:"readOnly"`
+	MaxRequestBytes        int64    `json:"maxRequestBytes"`
+	MaxDiffBytes           int      `json:"maxDiffBytes"`
+	SSEWriteTimeout        string   `json:"sseWriteTimeout"`
+	Tools                  []string `json:"tools"`
+	AllowedCommands        []string `json:"allowedCommands"`
+	AcceptOnSave           bool     `json:"acceptOnSave"`
+	StrictContentType      bool     `json:"strictContentType"`
+	NotificationLog        bool     `json:"notificationLog"`
+	MaxConcurrentToolCalls int      `json:"maxConcurrentToolCalls"`
+	RejectWhenBusy         bool     `json:"rejectWhenBusy"`
+}
+
+// PreviewHunk is a change diffPreview found between a file and new content
+type PreviewHunk struct {
+	// StartLine is the 1-based line of the current file where the hunk
+	// begins; for a pure insertion, the line the new lines go before
+	StartLine int      `json:"startLine"`
+	OldLines  []string `json:"oldLines"`
+	NewLines  []string `json:"newLines"`
+}
+
+// ResolvedPath is an absolute path found by resolvePath
+type ResolvedPath struct {
+	Path   string `json:"path"`
+	Root   string `json:"root"` // the workspace root containing Path
+	Exists bool   `json:"exists"`
+}
+
+// SyntaxNode is the syntax node at a position, or the position's line when
+// the file has no tree-sitter parser
+type SyntaxNode struct {
+	Path        string `json:"path" msgpack:"-"`
+	Type        string `json:"type" msgpack:"type"`               // the node type, or "line"
+	StartLine   int    `json:"startLine" msgpack:"startLine"`     // 1-based
+	StartColumn int    `json:"startColumn" msgpack:"startColumn"` // 1-based byte column
+	EndLine     int    `json:"endLine" msgpack:"endLine"`         // 1-based, inclusive
+	EndColumn   int    `json:"endColumn" msgpack:"endColumn"`     // 1-based byte column, inclusive
+	Text        string `json:"text" msgpack:"text"`
+	Truncated   bool   `json:"truncated,omitempty" msgpack:"-"`
+	Source      string `json:"source" msgpack:"source"` // "treesitter" or "line"
+}
+
+// WordUnderCursor is the identifier under the cursor of the current window,
+// with the cursor's line for context. Word is empty on whitespace.
+type WordUnderCursor struct {
+	Path        string `json:"path" msgpack:"path"`
+	Word        string `json:"word" msgpack:"word"`
+	Line        int    `json:"line" msgpack:"line"`               // 1-based
+	StartColumn int    `json:"startColumn" msgpack:"startColumn"` // 1-based byte column, 0 without a word
+	EndColumn   int    `json:"endColumn" msgpack:"endColumn"`     // 1-based byte column, inclusive
+	LineText    string `json:"lineText" msgpack:"lineText"`
+}
+
+// IgnoreStatus is whether git ignores a path, and the rule that decides it
+type IgnoreStatus struct {
+	Path    string `json:"path"`
+	Ignored bool   `json:"ignored"`
+	Pattern string `json:"pattern,omitempty"`
+	Source  string `json:"source,omitempty"` // the file holding Pattern, e.g. ".gitignore"
+	Line    int    `json:"line,omitempty"`   // line of Pattern in Source
+	Note    string `json:"note,omitempty"`
+}